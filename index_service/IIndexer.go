@@ -1,12 +1,30 @@
 package index_service
 
-import types "github.com/kisaragi77/TinyES/types"
+import (
+	"context"
+
+	types "github.com/kisaragi77/TinyES/types"
+)
 
 // Interface Of Indexer (Can be implemented by Sentinel and Indexer)
 type IIndexer interface {
 	AddDoc(doc types.Document) (int, error)
 	DeleteDoc(docId string) int
-	Search(query *types.TermQuery, onFlag uint64, offFlag uint64, orFlags []uint64) []*types.Document
+	Search(request *SearchRequest) *SearchResult
 	Count() int
+	GetDoc(docId string) *types.Document           // Get document by Id, return nil if not exists
+	MultiGetDoc(docIds []string) []*types.Document // Get documents by Ids, the documents not exist are skipped
+	Close() error
+}
+
+// Context-aware variant of IIndexer (Implemented by Sentinel and Indexer). The methods give up and return ctx.Err()
+// when ctx is canceled or its deadline is exceeded
+type IContextIndexer interface {
+	AddDocContext(ctx context.Context, doc types.Document) (int, error)
+	DeleteDocContext(ctx context.Context, docId string) (int, error)
+	SearchContext(ctx context.Context, request *SearchRequest) (*SearchResult, error)
+	CountContext(ctx context.Context) (int, error)
+	GetDocContext(ctx context.Context, docId string) (*types.Document, error)
+	MultiGetDocContext(ctx context.Context, docIds []string) ([]*types.Document, error)
 	Close() error
 }
@@ -0,0 +1,199 @@
+package index_service
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// State of a circuit breaker
+type BreakerState int
+
+const (
+	BREAKER_CLOSED    BreakerState = iota // Requests are sent to the endpoint
+	BREAKER_OPEN                          // Requests are rejected without connecting to the endpoint
+	BREAKER_HALF_OPEN                     // A probe request is sent, the breaker is closed if it succeeds, opened again if it fails
+)
+
+func (state BreakerState) String() string {
+	switch state {
+	case BREAKER_CLOSED:
+		return "closed"
+	case BREAKER_OPEN:
+		return "open"
+	case BREAKER_HALF_OPEN:
+		return "half-open"
+	}
+	return "unknown"
+}
+
+// Returned when the circuit breaker of the endpoint is open
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+type CircuitBreakerConfig struct {
+	FailureThreshold int           // The breaker is opened after so many consecutive failures, 5 if 0
+	OpenTimeout      time.Duration // A probe is allowed after the breaker has been open for so long, 5s if 0
+}
+
+// Snapshot of a circuit breaker, for monitoring
+type BreakerStatus struct {
+	State    BreakerState
+	Failures int       // Consecutive failures
+	OpenedAt time.Time // When the breaker was opened last time, zero if never opened
+}
+
+type circuitBreaker struct {
+	status  BreakerStatus
+	probeAt time.Time // When the probe of half-open state was allowed
+}
+
+// Circuit breakers of endpoints. An endpoint failed too many times in a row is skipped until a probe succeeds,
+// so a known-bad worker is not dialed on every request.
+type CircuitBreakers struct {
+	config   CircuitBreakerConfig
+	lock     sync.Mutex
+	breakers map[string]*circuitBreaker
+}
+
+func NewCircuitBreakers(config CircuitBreakerConfig) *CircuitBreakers {
+	if config.FailureThreshold <= 0 {
+		config.FailureThreshold = 5
+	}
+	if config.OpenTimeout <= 0 {
+		config.OpenTimeout = 5 * time.Second
+	}
+	return &CircuitBreakers{config: config, breakers: make(map[string]*circuitBreaker)}
+}
+
+func (cb *CircuitBreakers) get(endpoint string) *circuitBreaker {
+	breaker, exists := cb.breakers[endpoint]
+	if !exists {
+		breaker = &circuitBreaker{}
+		cb.breakers[endpoint] = breaker
+	}
+	return breaker
+}
+
+// Whether a request can be sent to endpoint. In half-open state only one probe is allowed at a time, another probe
+// is allowed if the result of the last one is not reported within OpenTimeout.
+func (cb *CircuitBreakers) Allow(endpoint string) bool {
+	cb.lock.Lock()
+	defer cb.lock.Unlock()
+	breaker := cb.get(endpoint)
+	now := time.Now()
+	switch breaker.status.State {
+	case BREAKER_OPEN:
+		if now.Sub(breaker.status.OpenedAt) < cb.config.OpenTimeout {
+			return false
+		}
+		breaker.status.State = BREAKER_HALF_OPEN
+		breaker.probeAt = now
+		return true
+	case BREAKER_HALF_OPEN:
+		if now.Sub(breaker.probeAt) < cb.config.OpenTimeout {
+			return false
+		}
+		breaker.probeAt = now
+		return true
+	}
+	return true
+}
+
+// Same as Allow, but doesn't take the probe of half-open state
+func (cb *CircuitBreakers) Available(endpoint string) bool {
+	cb.lock.Lock()
+	defer cb.lock.Unlock()
+	breaker, exists := cb.breakers[endpoint]
+	if !exists {
+		return true
+	}
+	switch breaker.status.State {
+	case BREAKER_OPEN:
+		return time.Since(breaker.status.OpenedAt) >= cb.config.OpenTimeout
+	case BREAKER_HALF_OPEN:
+		return time.Since(breaker.probeAt) >= cb.config.OpenTimeout
+	}
+	return true
+}
+
+// Report a successful request to endpoint, the breaker is closed
+func (cb *CircuitBreakers) Success(endpoint string) {
+	cb.lock.Lock()
+	defer cb.lock.Unlock()
+	breaker := cb.get(endpoint)
+	breaker.status.State = BREAKER_CLOSED
+	breaker.status.Failures = 0
+}
+
+// Report a failed request to endpoint. The breaker is opened if the probe failed or there are too many consecutive failures
+func (cb *CircuitBreakers) Failure(endpoint string) {
+	cb.lock.Lock()
+	defer cb.lock.Unlock()
+	breaker := cb.get(endpoint)
+	if breaker.status.State == BREAKER_OPEN { //Requests sent before the breaker was opened
+		return
+	}
+	breaker.status.Failures++
+	if breaker.status.State == BREAKER_HALF_OPEN || breaker.status.Failures >= cb.config.FailureThreshold {
+		breaker.status.State = BREAKER_OPEN
+		breaker.status.OpenedAt = time.Now()
+	}
+}
+
+// Status of the breaker of endpoint
+func (cb *CircuitBreakers) Status(endpoint string) BreakerStatus {
+	cb.lock.Lock()
+	defer cb.lock.Unlock()
+	if breaker, exists := cb.breakers[endpoint]; exists {
+		return breaker.status
+	}
+	return BreakerStatus{}
+}
+
+// Status of all breakers
+func (cb *CircuitBreakers) Statuses() map[string]BreakerStatus {
+	cb.lock.Lock()
+	defer cb.lock.Unlock()
+	statuses := make(map[string]BreakerStatus, len(cb.breakers))
+	for endpoint, breaker := range cb.breakers {
+		statuses[endpoint] = breaker.status
+	}
+	return statuses
+}
+
+// A LoadBalancer skipping the endpoints rejected by their breakers. If all of them are rejected, choose from all endpoints.
+type BreakerBalancer struct {
+	LoadBalancer
+	Breakers *CircuitBreakers
+}
+
+func (b *BreakerBalancer) Take(endpoints []string) string {
+	available := make([]string, 0, len(endpoints))
+	for _, endpoint := range endpoints {
+		if b.Breakers.Available(endpoint) {
+			available = append(available, endpoint)
+		}
+	}
+	if len(available) == 0 {
+		available = endpoints
+	}
+	return b.LoadBalancer.Take(available)
+}
+
+func (b *BreakerBalancer) SetWeights(weights map[string]int) {
+	if weighted, ok := b.LoadBalancer.(WeightedLoadBalancer); ok {
+		weighted.SetWeights(weights)
+	}
+}
+
+func (b *BreakerBalancer) Begin(endpoint string) {
+	if feedback, ok := b.LoadBalancer.(FeedbackLoadBalancer); ok {
+		feedback.Begin(endpoint)
+	}
+}
+
+func (b *BreakerBalancer) End(endpoint string, latency time.Duration, err error) {
+	if feedback, ok := b.LoadBalancer.(FeedbackLoadBalancer); ok {
+		feedback.End(endpoint, latency, err)
+	}
+}
@@ -0,0 +1,104 @@
+package index_service
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	farmhash "github.com/leemcloughlin/gofarmhash"
+)
+
+// Number of virtual nodes of each endpoint on the hash ring
+const VIRTUAL_NODES = 160
+
+// Consistent hash ring of endpoints. A key is owned by the first virtual node clockwise from its hash,
+// so adding or removing an endpoint only moves the keys owned by that endpoint.
+//
+// The ring is immutable, build a new one when endpoints change.
+type ConsistentHash struct {
+	hashes    []uint32          // Sorted hashes of virtual nodes
+	owners    map[uint32]string // Hash of virtual node -> endpoint
+	endpoints []string          // Sorted endpoints
+}
+
+// Build a hash ring with virtualNodes virtual nodes for each endpoint
+func NewConsistentHash(endpoints []string, virtualNodes int) *ConsistentHash {
+	ring := &ConsistentHash{
+		hashes:    make([]uint32, 0, len(endpoints)*virtualNodes),
+		owners:    make(map[uint32]string, len(endpoints)*virtualNodes),
+		endpoints: make([]string, len(endpoints)),
+	}
+	copy(ring.endpoints, endpoints)
+	sort.Strings(ring.endpoints)
+	for _, endpoint := range ring.endpoints {
+		for i := 0; i < virtualNodes; i++ {
+			hash := farmhash.Hash32([]byte(endpoint + "#" + strconv.Itoa(i)))
+			if _, exists := ring.owners[hash]; exists { //Hash collision, the smaller endpoint wins
+				continue
+			}
+			ring.owners[hash] = endpoint
+			ring.hashes = append(ring.hashes, hash)
+		}
+	}
+	sort.Slice(ring.hashes, func(i, j int) bool { return ring.hashes[i] < ring.hashes[j] })
+	return ring
+}
+
+// Return the endpoint owning the key, empty if the ring is empty
+func (ring *ConsistentHash) Get(key string) string {
+	if len(ring.hashes) == 0 {
+		return ""
+	}
+	return ring.owners[ring.hashes[ring.search(farmhash.Hash32([]byte(key)))]]
+}
+
+// Return the n endpoints storing the key: its owner and the n-1 endpoints following the owner in sorted order.
+// Fewer endpoints are returned if there are less than n endpoints on the ring, n is 1 if <= 0.
+func (ring *ConsistentHash) GetN(key string, n int) []string {
+	return ring.Replicas(ring.Get(key), n)
+}
+
+// Return the n endpoints storing the documents owned by owner, which are called a shard. The replicas of a shard
+// are fixed, so a search can fail over shard by shard.
+func (ring *ConsistentHash) Replicas(owner string, n int) []string {
+	i := sort.SearchStrings(ring.endpoints, owner)
+	if i == len(ring.endpoints) || ring.endpoints[i] != owner {
+		return nil
+	}
+	if n <= 0 {
+		n = 1
+	}
+	if n > len(ring.endpoints) {
+		n = len(ring.endpoints)
+	}
+	replicas := make([]string, 0, n)
+	for j := 0; j < n; j++ {
+		replicas = append(replicas, ring.endpoints[(i+j)%len(ring.endpoints)])
+	}
+	return replicas
+}
+
+// Index of the first virtual node clockwise from hash
+func (ring *ConsistentHash) search(hash uint32) int {
+	i := sort.Search(len(ring.hashes), func(i int) bool { return ring.hashes[i] >= hash })
+	if i == len(ring.hashes) {
+		i = 0
+	}
+	return i
+}
+
+// Sorted endpoints on the ring
+func (ring *ConsistentHash) Endpoints() []string {
+	return ring.endpoints
+}
+
+// Whether the ring is built from the same set of endpoints
+func (ring *ConsistentHash) Same(endpoints []string) bool {
+	if len(endpoints) != len(ring.endpoints) {
+		return false
+	}
+	sorted := make([]string, len(endpoints))
+	copy(sorted, endpoints)
+	sort.Strings(sorted)
+	return strings.Join(sorted, ",") == strings.Join(ring.endpoints, ",")
+}
@@ -2,11 +2,14 @@ package index_service
 
 import (
 	context "context"
+	"errors"
 	"fmt"
+	"sort"
 	"sync"
 	"sync/atomic"
 	"time"
 
+	"github.com/gogo/protobuf/proto"
 	types "github.com/kisaragi77/TinyES/types"
 	"github.com/kisaragi77/TinyES/util"
 	"google.golang.org/grpc"
@@ -15,19 +18,175 @@ import (
 )
 
 type Sentinel struct {
-	hub      IServiceHub // 从Hub上获取IndexServiceWorker集合。可能是直接访问ServiceHub，也可能是走代理
-	connPool sync.Map    // 与各个IndexServiceWorker建立的连接。把连接缓存起来，避免每次都重建连接
+	hub        IServiceHub                     // 从Hub上获取IndexServiceWorker集合。可能是直接访问ServiceHub，也可能是走代理
+	balancer   LoadBalancer                    // 决定每个分片先访问哪个副本：用熔断器包装的hub的负载均衡策略，hub没有负载均衡策略时按哈希环上的顺序
+	ownHub     bool                            // hub是NewSentinel创建的，随sentinel一起关闭。WithServiceHub传入的hub可能被共享，不关闭
+	connPool   sync.Map                        // 与各个IndexServiceWorker建立的连接。把连接缓存起来，避免每次都重建连接
+	ring       atomic.Pointer[ConsistentHash]  // 由当前的IndexServiceWorker集合构建的一致性哈希环，worker集合变化时重建
+	notReady   atomic.Pointer[map[string]bool] // 没有就绪的worker，它们在哈希环上照常接收写入，但不处理查询
+	rebalancer *Rebalancer                     // 哈希环变化时把doc迁移到新的owner上
+	replicas   int                             // 副本数，每个doc写入哈希环上的replicas台worker
+	minShards  int                             // 检索时至少要有这么多分片成功返回，否则整个请求失败
+
+	retryPolicy *RetryPolicy // Search、Count、GetDoc等幂等请求的重试策略，nil时不重试
+	hedgePolicy *HedgePolicy // 幂等请求的对冲策略，nil时不发对冲请求
+	latency     sync.Map     // RPC方法名 -> *latencyTracker，用于计算对冲请求的延迟
+
+	breakers *CircuitBreakers // 各个worker的熔断器，连续失败的worker在探测成功之前直接跳过，不再每次都重新建连接
+
+	autoRebalance    bool          // 哈希环变化时自动迁移doc，只能在一个sentinel上开启
+	rebalanceDelay   time.Duration // 哈希环变化后等这么久再开始迁移，期间哈希环又变化时重新计时
+	rebalanceLock    sync.Mutex    // 保护rebalanceTimer、rebalanceSources和closed
+	rebalanceTimer   *time.Timer
+	rebalanceSources []string // 等待迁移期间在哈希环上出现过的worker，迁移时都要扫描
+	closed           bool
+
+	hubOptions []HubOption    // 没有指定IServiceHub时，创建HubProxy的选项
+	filter     EndpointFilter // 按worker发布的元数据筛选哈希环上的worker
+}
+
+type SentinelOption func(sentinel *Sentinel)
+
+// 副本数，默认为1。每个doc写入n台worker，多数副本写成功才算成功；检索时每个分片只查一个副本，失败时换另一个副本
+func WithReplicationFactor(n int) SentinelOption {
+	return func(sentinel *Sentinel) {
+		if n > 0 {
+			sentinel.replicas = n
+		}
+	}
+}
+
+// 检索时至少要有n个分片成功返回，否则整个请求失败，不返回部分结果。默认为0，即总是返回部分结果
+func WithMinSuccessfulShards(n int) SentinelOption {
+	return func(sentinel *Sentinel) {
+		sentinel.minShards = n
+	}
+}
+
+// 幂等请求(Search、Count、GetDoc、MultiGetDoc)在所有副本都失败之后，按照policy指数退避重试
+func WithRetryPolicy(policy RetryPolicy) SentinelOption {
+	return func(sentinel *Sentinel) {
+		sentinel.retryPolicy = &policy
+	}
+}
+
+// 幂等请求的某个副本超过最近延迟的百分位数还没返回时，把同样的请求发给下一个副本，用先返回的结果
+func WithHedgePolicy(policy HedgePolicy) SentinelOption {
+	return func(sentinel *Sentinel) {
+		sentinel.hedgePolicy = &policy
+	}
+}
+
+// 熔断器的配置，默认连续失败5次熔断，5秒后探测
+func WithCircuitBreaker(config CircuitBreakerConfig) SentinelOption {
+	return func(sentinel *Sentinel) {
+		sentinel.breakers = NewCircuitBreakers(config)
+	}
+}
+
+// 哈希环变化时自动把doc迁移到新的owner上，默认不开启，只能调用Rebalance手动迁移。
+// 多个sentinel之间不做协调，同时迁移会重复扫描和导入，所以集群里只能有一个sentinel开启自动迁移
+func WithAutoRebalance() SentinelOption {
+	return func(sentinel *Sentinel) {
+		sentinel.autoRebalance = true
+	}
+}
+
+// 开启自动迁移时，哈希环变化后等d再开始迁移doc，默认REBALANCE_DELAY，0表示立即迁移。worker重启时很快会重新注册，不必把它的doc迁走再迁回来
+func WithRebalanceDelay(d time.Duration) SentinelOption {
+	return func(sentinel *Sentinel) {
+		sentinel.rebalanceDelay = d
+	}
+}
+
+// 指定从哪个IServiceHub上获取IndexServiceWorker集合，不指定时使用etcd上的HubProxy。hub由调用方关闭，sentinel关闭时不关闭它
+func WithServiceHub(hub IServiceHub) SentinelOption {
+	return func(sentinel *Sentinel) {
+		sentinel.hub = hub
+	}
+}
+
+// 没有指定IServiceHub时，用这些选项创建连接etcd的HubProxy，比如WithRootPath、WithRateLimit
+func WithHubOptions(options ...HubOption) SentinelOption {
+	return func(sentinel *Sentinel) {
+		sentinel.hubOptions = append(sentinel.hubOptions, options...)
+	}
+}
+
+// 只使用filter接受的worker，比如InZone("zone-a")只使用同一个可用区的worker。
+// 哈希环只由注册和filter决定，没有就绪(Ready)的worker照常接收写入，只是不处理查询
+func WithEndpointFilter(filter EndpointFilter) SentinelOption {
+	return func(sentinel *Sentinel) {
+		sentinel.filter = filter
+	}
+}
+
+// 可以监听服务节点变化的IServiceHub，比如HubProxy
+type endpointsWatcher interface {
+	OnEndpointsChange(service string, fn func(endpoints []string))
+}
+
+// 有负载均衡策略的IServiceHub，比如ServiceHub、HubProxy、MemoryHub
+type balancedHub interface {
+	getLoadBalancer() LoadBalancer
 }
 
-func NewSentinel(etcdServers []string) *Sentinel {
-	return &Sentinel{
-		// hub: GetServiceHub(etcdServers, 10), //直接访问ServiceHub
-		hub:      GetServiceHubProxy(etcdServers, 10, 100), //走代理HubProxy
-		connPool: sync.Map{},
+// 没有指定IServiceHub时连接etcdServers上的HubProxy，连不上时返回error
+func NewSentinel(etcdServers []string, options ...SentinelOption) (*Sentinel, error) {
+	sentinel := &Sentinel{
+		connPool:       sync.Map{},
+		replicas:       1,
+		rebalanceDelay: REBALANCE_DELAY,
+		breakers:       NewCircuitBreakers(CircuitBreakerConfig{}),
+	}
+	for _, option := range options {
+		option(sentinel)
+	}
+	if sentinel.hub == nil {
+		options := append([]HubOption{WithEtcdServers(etcdServers), WithHeartbeat(10), WithRateLimit(100)}, sentinel.hubOptions...)
+		// hub, err := NewServiceHub(options...) //直接访问ServiceHub
+		hub, err := NewHubProxy(options...) //走代理HubProxy
+		if err != nil {
+			return nil, fmt.Errorf("can't connect to etcd server: %w", err)
+		}
+		sentinel.hub = hub
+		sentinel.ownHub = true
 	}
+	var balancer LoadBalancer = firstEndpoint{}
+	if hub, ok := sentinel.hub.(balancedHub); ok {
+		balancer = hub.getLoadBalancer()
+	}
+	sentinel.balancer = &BreakerBalancer{LoadBalancer: balancer, Breakers: sentinel.breakers} //先访问没有熔断的副本
+	sentinel.rebalancer = NewRebalancer(sentinel, REBALANCE_DOCS_PER_SECOND).WithReplicas(sentinel.replicas)
+	if watcher, ok := sentinel.hub.(endpointsWatcher); ok {
+		watcher.OnEndpointsChange(INDEX_SERVICE, func(endpoints []string) { //worker加入、离开或者就绪状态变化时立即更新哈希环和就绪状态
+			sentinel.getRing()
+		})
+	}
+	return sentinel, nil
 }
 
+// 获取与endpoint的连接，连接失败时返回nil。endpoint熔断时直接返回nil
 func (sentinel *Sentinel) GetGrpcConn(endpoint string) *grpc.ClientConn {
+	if sentinel.breakers != nil && !sentinel.breakers.Allow(endpoint) {
+		return nil
+	}
+	return sentinel.getConn(endpoint)
+}
+
+// 获取endpoint的client，endpoint熔断时返回ErrCircuitOpen，连接失败时返回ErrConnectFailed
+func (sentinel *Sentinel) getClient(endpoint string) (IndexServiceClient, error) {
+	if sentinel.breakers != nil && !sentinel.breakers.Allow(endpoint) {
+		return nil, fmt.Errorf("%w: %s", ErrCircuitOpen, endpoint)
+	}
+	conn := sentinel.getConn(endpoint)
+	if conn == nil {
+		return nil, fmt.Errorf("%w: %s", ErrConnectFailed, endpoint)
+	}
+	return NewIndexServiceClient(conn), nil
+}
+
+func (sentinel *Sentinel) getConn(endpoint string) *grpc.ClientConn {
 	if v, exists := sentinel.connPool.Load(endpoint); exists {
 		conn := v.(*grpc.ClientConn)
 		//如果连接状态不可用，则从连接缓存中删除
@@ -51,6 +210,9 @@ func (sentinel *Sentinel) GetGrpcConn(endpoint string) *grpc.ClientConn {
 	)
 	if err != nil {
 		util.Log.Printf("dial %s failed: %s", endpoint, err)
+		if sentinel.breakers != nil {
+			sentinel.breakers.Failure(endpoint)
+		}
 		return nil
 	}
 	util.Log.Printf("connect to grpc server %s", endpoint)
@@ -58,138 +220,516 @@ func (sentinel *Sentinel) GetGrpcConn(endpoint string) *grpc.ClientConn {
 	return conn
 }
 
-// 向集群中添加文档(如果已存在，会先删除)
-func (sentinel *Sentinel) AddDoc(doc types.Document) (int, error) {
-	endpoint := sentinel.hub.GetServiceEndpoint(INDEX_SERVICE) // 根据负载均衡策略，选择一台index worker，把doc添加到它上面去
-	if len(endpoint) == 0 {
-		return 0, fmt.Errorf("there is no alive index worker")
+// 向熔断器报告对endpoint的请求结果。worker不可用或者超时算作失败，ctx本身结束(比如对冲请求被取消)导致的失败不算
+func (sentinel *Sentinel) report(ctx context.Context, endpoint string, err error) {
+	if sentinel.breakers == nil || ctx.Err() != nil {
+		return
 	}
-	conn := sentinel.GetGrpcConn(endpoint)
-	if conn == nil {
-		return 0, fmt.Errorf("connect to worker %s failed", endpoint)
+	if err == nil || !retryable(err) {
+		sentinel.breakers.Success(endpoint) //业务上的错误说明worker是可用的
+	} else {
+		sentinel.breakers.Failure(endpoint)
 	}
-	client := NewIndexServiceClient(conn)
-	affected, err := client.AddDoc(context.Background(), &doc)
-	if err != nil {
+}
+
+// 按负载均衡策略排列一个分片的副本：第一个副本由balancer从没有熔断的副本中选出，其余的保持哈希环上的顺序，用于失败时换副本
+func (sentinel *Sentinel) orderReplicas(replicas []string) []string {
+	if len(replicas) < 2 {
+		return replicas
+	}
+	first := sentinel.balancer.Take(replicas)
+	ordered := make([]string, 0, len(replicas))
+	ordered = append(ordered, first)
+	for _, endpoint := range replicas {
+		if endpoint != first {
+			ordered = append(ordered, endpoint)
+		}
+	}
+	if len(ordered) != len(replicas) { //balancer返回了不在replicas里的节点
+		return replicas
+	}
+	return ordered
+}
+
+// 向负载均衡策略报告发往endpoint的请求，请求返回时用结果调用返回的函数。LeastOutstanding、P2CEWMA依靠它统计负载和延迟
+func (sentinel *Sentinel) track(endpoint string) func(err error) {
+	return trackRequest(sentinel.balancer, endpoint)
+}
+
+// 各个worker熔断器的状态，用于监控
+func (sentinel *Sentinel) BreakerStatuses() map[string]BreakerStatus {
+	if sentinel.breakers == nil {
+		return nil
+	}
+	return sentinel.breakers.Statuses()
+}
+
+// 获取最新的一致性哈希环。worker集合发生变化时重建哈希环，同时更新各个worker的就绪状态
+func (sentinel *Sentinel) getRing() *ConsistentHash {
+	infos := GetServiceEndpointInfos(sentinel.hub, INDEX_SERVICE)
+	if infos == nil { //查询失败(比如被限流)时沿用老的哈希环和就绪状态。查到的worker为空时清空哈希环
+		if ring := sentinel.ring.Load(); ring != nil {
+			return ring
+		}
+	}
+	notReady := make(map[string]bool)
+	for _, info := range infos {
+		if !info.Ready {
+			notReady[info.Endpoint] = true
+		}
+	}
+	sentinel.notReady.Store(&notReady)
+	return sentinel.updateRing(filterEndpoints(infos, sentinel.filter))
+}
+
+// 一个分片中已经就绪、可以处理查询的副本
+func (sentinel *Sentinel) readyReplicas(replicas []string) []string {
+	notReady := sentinel.notReady.Load()
+	if notReady == nil || len(*notReady) == 0 {
+		return replicas
+	}
+	ready := make([]string, 0, len(replicas))
+	for _, endpoint := range replicas {
+		if !(*notReady)[endpoint] {
+			ready = append(ready, endpoint)
+		}
+	}
+	return ready
+}
+
+// 用最新的worker集合更新哈希环，返回更新后的哈希环。开启自动迁移时，哈希环变化后把新老worker上不归自己所有的doc迁移到新的owner上
+func (sentinel *Sentinel) updateRing(endpoints []string) *ConsistentHash {
+	for {
+		old := sentinel.ring.Load()
+		if old != nil && old.Same(endpoints) {
+			return old
+		}
+		ring := NewConsistentHash(endpoints, VIRTUAL_NODES)
+		if !sentinel.ring.CompareAndSwap(old, ring) {
+			continue //被别的协程抢先更新了
+		}
+		if old != nil && len(old.Endpoints()) > 0 && sentinel.autoRebalance {
+			sentinel.scheduleRebalance(old.Endpoints(), endpoints)
+		}
+		return ring
+	}
+}
+
+// 哈希环变化后过rebalanceDelay再开始迁移，期间哈希环又变化时重新计时。正在进行的迁移立即停止，它的目标已经过时了。
+// 离开的worker如果还能连上，也要把它上面的doc迁走；等待期间写入可能落在临时的owner上，所以等待期间出现过的worker都要扫描
+func (sentinel *Sentinel) scheduleRebalance(old, endpoints []string) {
+	sentinel.rebalancer.Stop()
+	sentinel.rebalanceLock.Lock()
+	defer sentinel.rebalanceLock.Unlock()
+	if sentinel.closed {
+		return
+	}
+	sources := append(append(sentinel.rebalanceSources, old...), endpoints...)
+	for _, source := range sentinel.rebalancer.Progress().Sources { //被停止的迁移还没扫描完的worker
+		if !source.Done {
+			sources = append(sources, source.Endpoint)
+		}
+	}
+	sentinel.rebalanceSources = unique(sources)
+	if sentinel.rebalanceTimer != nil {
+		sentinel.rebalanceTimer.Stop()
+	}
+	sentinel.rebalanceTimer = time.AfterFunc(sentinel.rebalanceDelay, sentinel.startRebalance)
+}
+
+// 用最新的哈希环开始迁移等待中的worker
+func (sentinel *Sentinel) startRebalance() {
+	sentinel.rebalanceLock.Lock()
+	defer sentinel.rebalanceLock.Unlock()
+	endpoints := sentinel.ring.Load().Endpoints()
+	if sentinel.closed || len(sentinel.rebalanceSources) == 0 || len(endpoints) == 0 {
+		return
+	}
+	sentinel.rebalancer.Start(sentinel.rebalanceSources, endpoints)
+	sentinel.rebalanceSources, sentinel.rebalanceTimer = nil, nil
+}
+
+// 把集群上所有不在owner上的doc迁移到owner上，比如worker集合在没有sentinel运行时发生了变化
+func (sentinel *Sentinel) Rebalance() {
+	endpoints := sentinel.getRing().Endpoints()
+	if len(endpoints) > 0 && sentinel.rebalancer != nil {
+		sentinel.rebalancer.Start(endpoints, endpoints)
+	}
+}
+
+// 迁移进度
+func (sentinel *Sentinel) RebalanceProgress() RebalanceProgress {
+	if sentinel.rebalancer == nil {
+		return RebalanceProgress{}
+	}
+	return sentinel.rebalancer.Progress()
+}
+
+// RPC方法最近的延迟
+func (sentinel *Sentinel) latencies(method string) *latencyTracker {
+	if v, exists := sentinel.latency.Load(method); exists {
+		return v.(*latencyTracker)
+	}
+	v, _ := sentinel.latency.LoadOrStore(method, newLatencyTracker())
+	return v.(*latencyTracker)
+}
+
+func unique(ss []string) []string {
+	seen := make(map[string]bool, len(ss))
+	result := make([]string, 0, len(ss))
+	for _, s := range ss {
+		if !seen[s] {
+			seen[s] = true
+			result = append(result, s)
+		}
+	}
+	return result
+}
+
+// 多副本写入的结果
+type WriteResult struct {
+	Replicas []string          // doc所在的各个worker
+	Acks     int               // 写成功的副本数
+	Quorum   int               // 至少要写成功的副本数，即副本数的多数
+	Affected int               // 各副本返回的影响条数的最大值
+	Failures map[string]string // 写失败的副本 -> 失败原因
+	TimedOut []string          // 截止时间之前没有返回的副本
+}
+
+// 是否有多数副本写成功
+func (result *WriteResult) Ok() bool {
+	return result.Quorum > 0 && result.Acks >= result.Quorum
+}
+
+// 没有多数副本写成功时返回error
+func (result *WriteResult) Err() error {
+	if result.Ok() {
+		return nil
+	}
+	if len(result.Replicas) == 0 {
+		return fmt.Errorf("there is no alive index worker")
+	}
+	return fmt.Errorf("write quorum not reached, %d of %d replicas succeeded, %d required: %v", result.Acks, len(result.Replicas), result.Quorum, result.Failures)
+}
+
+// 并行地在docId的各个副本上执行写操作，统计写成功的副本数。ctx结束时不再等待还没返回的副本
+func (sentinel *Sentinel) replicate(ctx context.Context, docId string, write func(ctx context.Context, client IndexServiceClient) (*AffectedCount, error)) *WriteResult {
+	replicas := sentinel.getRing().GetN(docId, sentinel.replicas)
+	result := &WriteResult{
+		Replicas: replicas,
+		Quorum:   len(replicas)/2 + 1,
+		Failures: make(map[string]string),
+	}
+	if len(replicas) == 0 {
+		result.Quorum = 0
+		return result
+	}
+	acks, failures := fanOut(ctx, sentinel, replicas, func(ctx context.Context, endpoint string, client IndexServiceClient) (*AffectedCount, error) {
+		return write(ctx, client)
+	})
+	for _, affected := range acks {
+		if int(affected.Count) > result.Affected {
+			result.Affected = int(affected.Count)
+		}
+	}
+	result.Acks = len(acks)
+	result.TimedOut = collectFailures(failures, result.Failures)
+	return result
+}
+
+// 向集群中添加文档(如果已存在，会先删除)。doc被添加到按Id哈希得到的那几台worker上，同一个Id重复添加不会产生多余的副本。
+// 多数副本写成功才算成功
+func (sentinel *Sentinel) AddDoc(doc types.Document) (int, error) {
+	result := sentinel.AddDocWithQuorum(context.Background(), doc)
+	if err := result.Err(); err != nil {
+		return 0, err
+	}
+	return result.Affected, nil
+}
+
+// 向集群中添加文档，最多等到ctx结束，返回各副本的写入情况
+func (sentinel *Sentinel) AddDocWithQuorum(ctx context.Context, doc types.Document) *WriteResult {
+	return sentinel.replicate(ctx, doc.Id, func(ctx context.Context, client IndexServiceClient) (*AffectedCount, error) {
+		return client.AddDoc(ctx, &doc)
+	})
+}
+
+// 向集群中添加文档，最多等到ctx结束。没有多数副本写成功时返回error
+func (sentinel *Sentinel) AddDocContext(ctx context.Context, doc types.Document) (int, error) {
+	result := sentinel.AddDocWithQuorum(ctx, doc)
+	if err := result.Err(); err != nil {
 		return 0, err
 	}
-	util.Log.Printf("add %d doc to worker %s", affected.Count, endpoint)
-	return int(affected.Count), nil
+	return result.Affected, nil
 }
 
-// 从集群上删除docId，返回成功删除的doc数（正常情况下不会超过1）
+// 从集群上删除docId，返回成功删除的doc数（正常情况下不会超过1）。只需要到docId所在的几台worker上删除，多数副本删除成功才算成功
 func (sentinel *Sentinel) DeleteDoc(docId string) int {
-	endpoints := sentinel.hub.GetServiceEndpoints(INDEX_SERVICE)
-	if len(endpoints) == 0 {
+	result := sentinel.DeleteDocWithQuorum(context.Background(), docId)
+	if err := result.Err(); err != nil {
+		util.Log.Printf("delete doc %s failed: %s", docId, err)
 		return 0
 	}
-	var n int32
-	wg := sync.WaitGroup{}
-	wg.Add(len(endpoints))
-	for _, endpoint := range endpoints {
-		go func(endpoint string) { //并行到各个IndexServiceWorker上把docId删除。正常情况下只有一个worker上有该doc
-			defer wg.Done()
-			conn := sentinel.GetGrpcConn(endpoint)
-			if conn != nil {
-				client := NewIndexServiceClient(conn)
-				affected, err := client.DeleteDoc(context.Background(), &DocId{docId})
-				if err != nil {
-					util.Log.Printf("delete doc %s from worker %s failed: %s", docId, endpoint, err)
-				} else {
-					if affected.Count > 0 {
-						atomic.AddInt32(&n, affected.Count)
-						util.Log.Printf("delete %d from worker %s", affected.Count, endpoint)
-					}
-				}
-			}
-		}(endpoint)
+	return result.Affected
+}
+
+// 从集群上删除docId，最多等到ctx结束。没有多数副本删除成功时返回error
+func (sentinel *Sentinel) DeleteDocContext(ctx context.Context, docId string) (int, error) {
+	result := sentinel.DeleteDocWithQuorum(ctx, docId)
+	if err := result.Err(); err != nil {
+		return 0, err
 	}
-	wg.Wait()
-	return int(atomic.LoadInt32(&n))
+	return result.Affected, nil
 }
 
-func (sentinel *Sentinel) Search(query *types.TermQuery, onFlag uint64, offFlag uint64, orFlags []uint64) []*types.Document {
-	endpoints := sentinel.hub.GetServiceEndpoints(INDEX_SERVICE)
-	if len(endpoints) == 0 {
-		return nil
+// 从集群上删除docId，最多等到ctx结束，返回各副本的删除情况
+func (sentinel *Sentinel) DeleteDocWithQuorum(ctx context.Context, docId string) *WriteResult {
+	return sentinel.replicate(ctx, docId, func(ctx context.Context, client IndexServiceClient) (*AffectedCount, error) {
+		return client.DeleteDoc(ctx, &DocId{docId})
+	})
+}
+
+// 从集群上获取docId对应的文档，不存在时返回nil。依次访问docId的各个副本，直到有一个副本成功返回
+func (sentinel *Sentinel) GetDoc(docId string) *types.Document {
+	doc, _ := sentinel.GetDocContext(context.Background(), docId)
+	return doc
+}
+
+// 从集群上获取docId对应的文档，不存在时返回nil。所有副本都失败或者ctx结束之前还没有副本成功返回时，返回最后一个错误
+func (sentinel *Sentinel) GetDocContext(ctx context.Context, docId string) (*types.Document, error) {
+	inv := invoke(ctx, sentinel, "GetDoc", sentinel.getRing().GetN(docId, sentinel.replicas), func(ctx context.Context, client IndexServiceClient) (*types.Document, error) {
+		return client.GetDoc(ctx, &DocId{docId})
+	})
+	if inv.err != nil {
+		return nil, inv.err
 	}
-	docs := make([]*types.Document, 0, 1000)
-	resultCh := make(chan *types.Document, 1000)
-	wg := sync.WaitGroup{}
-	wg.Add(len(endpoints))
-	for _, endpoint := range endpoints {
-		go func(endpoint string) {
-			defer wg.Done()
-			conn := sentinel.GetGrpcConn(endpoint)
-			if conn != nil {
-				client := NewIndexServiceClient(conn)
-				result, err := client.Search(context.Background(), &SearchRequest{Query: query, OnFlag: onFlag, OffFlag: offFlag, OrFlags: orFlags})
-				if err != nil {
-					util.Log.Printf("search from cluster failed: %s", err)
-				} else {
-					if len(result.Results) > 0 {
-						util.Log.Printf("search %d doc from worker %s", len(result.Results), endpoint)
-						for _, doc := range result.Results {
-							resultCh <- doc
-						}
-					}
-				}
-			}
-		}(endpoint)
+	if len(inv.result.Id) == 0 {
+		return nil, nil
+	}
+	return inv.result, nil
+}
+
+// 从集群上批量获取文档，按docIds的顺序返回找到的文档。docIds按分片分组，并行地到各个分片上获取，某个副本失败时换下一个副本
+func (sentinel *Sentinel) MultiGetDoc(docIds []string) []*types.Document {
+	docs, _ := sentinel.MultiGetDocContext(context.Background(), docIds)
+	return docs
+}
+
+// 从集群上批量获取文档。有分片获取失败时(包括ctx结束时还没获取到)，返回已经获取到的文档和ErrShardsFailed，ctx结束时还包含ctx.Err()
+func (sentinel *Sentinel) MultiGetDocContext(ctx context.Context, docIds []string) ([]*types.Document, error) {
+	if len(docIds) == 0 {
+		return nil, nil
+	}
+	ring := sentinel.getRing()
+	groups := make(map[string][]string) // 分片 -> docIds
+	for _, docId := range docIds {
+		if shard := ring.Get(docId); len(shard) > 0 {
+			groups[shard] = append(groups[shard], docId)
+		}
 	}
 
-	receiveFinish := make(chan struct{})
-	go func() { //为什么要放到一个子协程里？因为里面有个无限for循环，只有“//1”执行了该for循环才能退出
-		for {
-			doc, ok := <-resultCh
-			if !ok {
-				break //2
+	shards := make([]string, 0, len(groups))
+	for shard := range groups {
+		shards = append(shards, shard)
+	}
+	found := make(map[string]*types.Document, len(docIds))
+	_, shardFailures := fanOutShards(ctx, sentinel, "MultiGetDoc", ring, shards, func(ctx context.Context, client IndexServiceClient, shard string) (*Documents, error) {
+		return client.MultiGetDoc(ctx, &DocIds{DocIds: groups[shard]})
+	}, func(shard string, endpoint string, docs *Documents) {
+		for _, doc := range docs.Docs {
+			found[doc.Id] = doc
+		}
+	})
+
+	result := make([]*types.Document, 0, len(found))
+	for _, docId := range docIds {
+		if doc, ok := found[docId]; ok {
+			result = append(result, doc)
+		}
+	}
+	if len(shardFailures) > 0 {
+		failed := make([]string, 0, len(shardFailures))
+		for shard := range shardFailures {
+			failed = append(failed, shard)
+		}
+		sort.Strings(failed)
+		return result, shardsError(ctx, failed)
+	}
+	return result, nil
+}
+
+// 文档与它的BM25得分
+type scoredDoc struct {
+	doc   *types.Document
+	score float64
+}
+
+// 到各个分片上检索，合并各分片的top-K得到请求的那一页。
+//
+// 每个分片只查一个副本，失败时换下一个副本。可以用WithRetryPolicy配置所有副本都失败后的重试，
+// 用WithHedgePolicy配置对冲请求：某个副本迟迟不返回时，把同样的请求发给下一个副本，用先返回的结果
+func (sentinel *Sentinel) Search(request *SearchRequest) *SearchResult {
+	result, _ := sentinel.SearchContext(context.Background(), request)
+	return result
+}
+
+// 到各个分片上检索，最多等到ctx结束。结果里的TotalShards、SuccessfulShards、ShardFailures说明了有哪些分片没有检索到。
+//
+// 成功的分片数少于WithMinSuccessfulShards指定的数目时，只返回分片信息，不返回部分结果，error是ErrTooFewShards；
+// 否则ctx结束时有分片还没检索到，返回部分结果和ctx.Err()
+func (sentinel *Sentinel) SearchContext(ctx context.Context, request *SearchRequest) (*SearchResult, error) {
+	result := sentinel.search(ctx, request)
+	if int(result.SuccessfulShards) < sentinel.minShards {
+		err := fmt.Errorf("%w, %d of %d shards succeeded, %d required", ErrTooFewShards, result.SuccessfulShards, result.TotalShards, sentinel.minShards)
+		util.Log.Printf("search failed: %s", err)
+		return &SearchResult{TotalShards: result.TotalShards, SuccessfulShards: result.SuccessfulShards, ShardFailures: result.ShardFailures}, err
+	}
+	if len(result.ShardFailures) > 0 {
+		return result, ctx.Err()
+	}
+	return result, nil
+}
+
+// 成功返回的分片太少
+var ErrTooFewShards = errors.New("too few shards succeeded")
+
+// 有分片失败，结果不完整
+var ErrShardsFailed = errors.New("shards failed")
+
+// 结果不完整时的错误，列出失败的分片。ctx结束时也包含ctx.Err()，调用方可以区分超时
+func shardsError(ctx context.Context, shards []string) error {
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("%w, %w: %v", err, ErrShardsFailed, shards)
+	}
+	return fmt.Errorf("%w: %v", ErrShardsFailed, shards)
+}
+
+// 到各个分片上检索，返回合并后的结果
+func (sentinel *Sentinel) search(ctx context.Context, request *SearchRequest) *SearchResult {
+	ring := sentinel.getRing()
+	shards := ring.Endpoints()
+	if len(shards) == 0 {
+		return &SearchResult{}
+	}
+	// 每个worker都返回自己的前From+PageSize个文档，全局的这一页必然在其中
+	from, size := pageOf(request)
+	workerRequest := proto.Clone(request).(*SearchRequest) //生成的消息不能按值复制
+	workerRequest.From = 0
+	if size > 0 {
+		workerRequest.PageSize = int32(from + size)
+	}
+	collector := newPageCollector(request, func(hit scoredDoc) rankKey {
+		return rankKey{Score: hit.score, Id: hit.doc.Id}
+	})
+	var totalHits int64
+
+	_, shardFailures := fanOutShards(ctx, sentinel, "Search", ring, shards, func(ctx context.Context, client IndexServiceClient, shard string) (*SearchResult, error) {
+		shardRequest := proto.Clone(workerRequest).(*SearchRequest)
+		if sentinel.replicas > 1 { //有多个副本时，worker只检索请求的分片，避免同一个doc被多个副本重复返回
+			shardRequest.Endpoints = shards
+			shardRequest.Shards = []string{shard}
+		}
+		return client.Search(ctx, shardRequest)
+	}, func(shard string, endpoint string, result *SearchResult) {
+		totalHits += result.TotalHits
+		if len(result.Results) > 0 {
+			util.Log.Printf("search %d doc from worker %s", len(result.Results), endpoint)
+		}
+		for i, doc := range result.Results {
+			hit := scoredDoc{doc: doc}
+			if i < len(result.Scores) {
+				hit.score = result.Scores[i]
 			}
-			docs = append(docs, doc)
+			collector.Push(hit)
 		}
-		receiveFinish <- struct{}{} //3
-	}()
-	wg.Wait()
-	close(resultCh) //1
-	<-receiveFinish //4
-	return docs
+	})
+
+	result := &SearchResult{
+		TotalHits:        totalHits,
+		TotalShards:      int32(len(shards)),
+		SuccessfulShards: int32(len(shards) - len(shardFailures)),
+	}
+	for _, shard := range shards {
+		if err, failed := shardFailures[shard]; failed {
+			result.ShardFailures = append(result.ShardFailures, &ShardFailure{Shard: shard, Reason: err.Error()})
+		}
+	}
+	hits := collector.Sorted()
+	if len(hits) <= from {
+		return result
+	}
+	hits = hits[from:]
+	result.Results = make([]*types.Document, 0, len(hits))
+	result.Scores = make([]float64, 0, len(hits))
+	for _, hit := range hits {
+		result.Results = append(result.Results, hit.doc)
+		result.Scores = append(result.Scores, hit.score)
+	}
+	return result
 }
+
+// 集群上的文档数，有分片统计失败时返回的是不完整的结果
 func (sentinel *Sentinel) Count() int {
-	var n int32
-	endpoints := sentinel.hub.GetServiceEndpoints(INDEX_SERVICE)
-	if len(endpoints) == 0 {
-		return 0
+	return sentinel.ClusterCount(context.Background()).Total
+}
+
+// 集群上的文档数，最多等到ctx结束。有分片统计失败时(包括ctx结束时还没统计到)，返回不完整的结果和ErrShardsFailed，ctx结束时还包含ctx.Err()
+func (sentinel *Sentinel) CountContext(ctx context.Context) (int, error) {
+	result := sentinel.ClusterCount(ctx)
+	if !result.Complete() {
+		return result.Total, shardsError(ctx, result.FailedShards)
 	}
-	wg := sync.WaitGroup{}
-	wg.Add(len(endpoints))
-	for _, endpoint := range endpoints {
-		go func(endpoint string) {
-			defer wg.Done()
-			conn := sentinel.GetGrpcConn(endpoint)
-			if conn != nil {
-				client := NewIndexServiceClient(conn)
-				affected, err := client.Count(context.Background(), new(CountRequest))
-				if err != nil {
-					util.Log.Printf("get doc count from worker %s failed: %s", endpoint, err)
-				} else {
-					if affected.Count > 0 {
-						atomic.AddInt32(&n, affected.Count)
-						util.Log.Printf("worker %s have %d documents", endpoint, affected.Count)
-					}
-				}
-			}
-		}(endpoint)
+	return result.Total, nil
+}
+
+// 统计集群上的文档数，最多等到ctx结束，返回各worker上的文档数以及失败或超时的worker。
+//
+// 和检索一样，每个分片只统计一个副本，失败时换下一个副本，并按照重试和对冲策略重发请求
+func (sentinel *Sentinel) ClusterCount(ctx context.Context) *CountResult {
+	ring := sentinel.getRing()
+	shards := ring.Endpoints()
+	result := &CountResult{
+		Workers:  make(map[string]int),
+		Failures: make(map[string]string),
+	}
+	workerFailures, shardFailures := fanOutShards(ctx, sentinel, "Count", ring, shards, func(ctx context.Context, client IndexServiceClient, shard string) (*AffectedCount, error) {
+		request := &CountRequest{}
+		if sentinel.replicas > 1 { //有多个副本时，worker只统计请求的分片，避免重复计数
+			request.Endpoints = shards
+			request.Shards = []string{shard}
+		}
+		return client.Count(ctx, request)
+	}, func(shard string, endpoint string, affected *AffectedCount) {
+		result.Workers[endpoint] += int(affected.Count)
+		result.Total += int(affected.Count)
+	})
+
+	result.TimedOut = collectFailures(workerFailures, result.Failures)
+	for shard := range shardFailures {
+		result.FailedShards = append(result.FailedShards, shard)
 	}
-	return int(n)
+	sort.Strings(result.FailedShards)
+	return result
 }
 
-// 关闭各个grpc client connection，关闭etcd client connection
+// 关闭各个grpc client connection。hub是sentinel自己创建的时，关闭etcd client connection
 func (sentinel *Sentinel) Close() (err error) {
+	sentinel.rebalanceLock.Lock()
+	sentinel.closed = true
+	if sentinel.rebalanceTimer != nil {
+		sentinel.rebalanceTimer.Stop()
+	}
+	sentinel.rebalanceLock.Unlock()
+	if sentinel.rebalancer != nil {
+		sentinel.rebalancer.Stop()
+	}
 	sentinel.connPool.Range(func(key, value any) bool {
 		conn := value.(*grpc.ClientConn)
 		err = conn.Close()
 		return true
 	})
-	sentinel.hub.Close()
+	if sentinel.ownHub {
+		sentinel.hub.Close()
+	}
 	return
 }
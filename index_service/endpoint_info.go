@@ -0,0 +1,139 @@
+package index_service
+
+import (
+	"encoding/json"
+	"sort"
+	"strconv"
+
+	"github.com/kisaragi77/TinyES/util"
+)
+
+// Metadata published by a worker when it registers, stored as JSON in the value of its etcd key
+type EndpointInfo struct {
+	Endpoint string   `json:"-"`                 // Address of the worker, taken from the etcd key
+	Shards   []string `json:"shards,omitempty"`  // Shards(hash ranges) owned by the worker, empty if decided by the hash ring of Sentinel
+	DocCount int      `json:"doc_count"`         // Number of documents on the worker, refreshed periodically
+	Version  string   `json:"version,omitempty"` // Build version of the worker
+	Zone     string   `json:"zone,omitempty"`    // Availability zone of the worker
+	Weight   int      `json:"weight,omitempty"`  // Capacity weight for WeightedRoundRobin, 0 means the default weight
+	Ready    bool     `json:"ready"`             // Whether the worker is ready to serve, false while loading index
+}
+
+func (info *EndpointInfo) encode() string {
+	bs, _ := json.Marshal(info)
+	return string(bs)
+}
+
+// Parse the value registered by endpoint. Workers registered without metadata publish an empty value or only a weight,
+// they are taken as ready.
+func parseEndpointInfo(endpoint string, value []byte) EndpointInfo {
+	info := EndpointInfo{Endpoint: endpoint, Ready: true}
+	if len(value) == 0 {
+		return info
+	}
+	if weight, err := strconv.Atoi(string(value)); err == nil {
+		info.Weight = weight
+		return info
+	}
+	if err := json.Unmarshal(value, &info); err != nil {
+		util.Log.Printf("invalid metadata of %s: %s", endpoint, err)
+		return EndpointInfo{Endpoint: endpoint, Ready: true}
+	}
+	info.Endpoint = endpoint
+	return info
+}
+
+// Registries providing metadata of endpoints
+type IEndpointInfoHub interface {
+	GetServiceEndpointInfos(service string) []EndpointInfo // Metadata of all endpoints of a service. nil if the lookup failed(e.g. throttled), empty if there is no endpoint
+}
+
+// Decide whether an endpoint is used by its metadata
+type EndpointFilter func(info EndpointInfo) bool
+
+// Endpoints ready to serve
+func Ready(info EndpointInfo) bool {
+	return info.Ready
+}
+
+// Endpoints in zone
+func InZone(zone string) EndpointFilter {
+	return func(info EndpointInfo) bool {
+		return info.Zone == zone
+	}
+}
+
+// Endpoints of build version
+func OfVersion(version string) EndpointFilter {
+	return func(info EndpointInfo) bool {
+		return info.Version == version
+	}
+}
+
+// Endpoints owning shard
+func OwnsShard(shard string) EndpointFilter {
+	return func(info EndpointInfo) bool {
+		for _, s := range info.Shards {
+			if s == shard {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// Endpoints accepted by all of filters, nil filters are ignored
+func MatchAll(filters ...EndpointFilter) EndpointFilter {
+	return func(info EndpointInfo) bool {
+		for _, filter := range filters {
+			if filter != nil && !filter(info) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// Metadata of the endpoints of service. For registries without metadata, each endpoint is taken as ready with only its address.
+func GetServiceEndpointInfos(hub IServiceHub, service string) []EndpointInfo {
+	if infoHub, ok := hub.(IEndpointInfoHub); ok {
+		return infoHub.GetServiceEndpointInfos(service)
+	}
+	endpoints := hub.GetServiceEndpoints(service)
+	if endpoints == nil { //查询失败
+		return nil
+	}
+	infos := make([]EndpointInfo, 0, len(endpoints))
+	for _, endpoint := range endpoints {
+		infos = append(infos, EndpointInfo{Endpoint: endpoint, Ready: true})
+	}
+	return infos
+}
+
+// Endpoints of service accepted by filter, all endpoints if filter is nil
+func GetServiceEndpointsBy(hub IServiceHub, service string, filter EndpointFilter) []string {
+	if filter == nil {
+		return hub.GetServiceEndpoints(service)
+	}
+	return filterEndpoints(GetServiceEndpointInfos(hub, service), filter)
+}
+
+func filterEndpoints(infos []EndpointInfo, filter EndpointFilter) []string {
+	endpoints := make([]string, 0, len(infos))
+	for _, info := range infos {
+		if filter == nil || filter(info) {
+			endpoints = append(endpoints, info.Endpoint)
+		}
+	}
+	sort.Strings(endpoints)
+	return endpoints
+}
+
+// Weights of endpoints, for WeightedLoadBalancer
+func endpointWeights(infos []EndpointInfo) map[string]int {
+	weights := make(map[string]int, len(infos))
+	for _, info := range infos {
+		weights[info.Endpoint] = info.Weight
+	}
+	return weights
+}
@@ -0,0 +1,131 @@
+package index_service
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+
+	"github.com/kisaragi77/TinyES/util"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Whether the error is caused by deadline of the context
+func isTimeout(err error) bool {
+	return errors.Is(err, context.DeadlineExceeded) || status.Code(err) == codes.DeadlineExceeded
+}
+
+// Call the workers in parallel, wait until all of them return or ctx is done. Return the results of succeeded workers and
+// the errors of failed workers, workers not returned before ctx is done fail with ctx.Err() and their calls are canceled.
+func fanOut[T any](ctx context.Context, sentinel *Sentinel, endpoints []string, call func(ctx context.Context, endpoint string, client IndexServiceClient) (T, error)) (map[string]T, map[string]error) {
+	results := make(map[string]T, len(endpoints))
+	failures := make(map[string]error)
+	if len(endpoints) == 0 {
+		return results, failures
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel() //返回之后还没结束的调用都取消掉
+
+	type reply struct {
+		endpoint string
+		result   T
+		err      error
+	}
+	replies := make(chan reply, len(endpoints)) //有缓冲，返回之后才结束的调用不会阻塞
+	for _, endpoint := range endpoints {
+		go func(endpoint string) {
+			r := reply{endpoint: endpoint}
+			done := sentinel.track(endpoint)
+			if client, err := sentinel.getClient(endpoint); err != nil {
+				r.err = err
+			} else {
+				r.result, r.err = call(ctx, endpoint, client)
+				sentinel.report(ctx, endpoint, r.err)
+			}
+			done(r.err)
+			replies <- r
+		}(endpoint)
+	}
+	for range endpoints {
+		select {
+		case r := <-replies:
+			if r.err != nil {
+				util.Log.Printf("call worker %s failed: %s", r.endpoint, r.err)
+				failures[r.endpoint] = r.err
+			} else {
+				results[r.endpoint] = r.result
+			}
+		case <-ctx.Done():
+			for _, endpoint := range endpoints {
+				_, succeeded := results[endpoint]
+				if _, failed := failures[endpoint]; !succeeded && !failed {
+					failures[endpoint] = ctx.Err()
+				}
+			}
+			return results, failures
+		}
+	}
+	return results, failures
+}
+
+// Call one replica of each of the shards in parallel, with the retry and hedging policy of sentinel. collect is called with
+// the result of each shard and the replica answered, in the calling goroutine. Return the errors of failed workers,
+// and the shards failed on all replicas(or not answered before ctx is done) with their last errors.
+func fanOutShards[T any](ctx context.Context, sentinel *Sentinel, method string, ring *ConsistentHash, shards []string,
+	call func(ctx context.Context, client IndexServiceClient, shard string) (T, error),
+	collect func(shard string, endpoint string, result T)) (map[string]error, map[string]error) {
+	invocations := make([]*invocation[T], len(shards))
+	wg := sync.WaitGroup{}
+	wg.Add(len(shards))
+	for i, shard := range shards {
+		go func(i int, shard string) {
+			defer wg.Done()
+			invocations[i] = invoke(ctx, sentinel, method, ring.Replicas(shard, sentinel.replicas), func(ctx context.Context, client IndexServiceClient) (T, error) {
+				return call(ctx, client, shard)
+			})
+		}(i, shard)
+	}
+	wg.Wait() //invoke在ctx结束时立即返回，不会超过ctx的截止时间
+
+	workerFailures := make(map[string]error)
+	shardFailures := make(map[string]error)
+	for i, inv := range invocations {
+		for endpoint, err := range inv.failures {
+			workerFailures[endpoint] = err
+		}
+		if inv.err != nil {
+			util.Log.Printf("all replicas of shard %s failed: %s", shards[i], inv.err)
+			shardFailures[shards[i]] = inv.err
+		} else {
+			collect(shards[i], inv.endpoint, inv.result)
+		}
+	}
+	return workerFailures, shardFailures
+}
+
+// Result of counting documents in the cluster
+type CountResult struct {
+	Total        int               // Sum of the counts returned by workers
+	Workers      map[string]int    // Worker -> number of documents counted on it
+	Failures     map[string]string // Failed worker -> error, including the timed out ones
+	TimedOut     []string          // Workers not returned before the deadline
+	FailedShards []string          // Shards not counted on any replica, Total is less than the real number if not empty
+}
+
+// Whether all shards are counted
+func (result *CountResult) Complete() bool {
+	return len(result.FailedShards) == 0
+}
+
+// Collect the failures of workers into failures and timedOut
+func collectFailures(errs map[string]error, failures map[string]string) (timedOut []string) {
+	for endpoint, err := range errs {
+		failures[endpoint] = err.Error()
+		if isTimeout(err) {
+			timedOut = append(timedOut, endpoint)
+		}
+	}
+	sort.Strings(timedOut)
+	return
+}
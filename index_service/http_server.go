@@ -0,0 +1,363 @@
+package index_service
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/kisaragi77/TinyES/types"
+	"github.com/kisaragi77/TinyES/util"
+)
+
+const (
+	MAX_BULK_LINE_SIZE           = 16 << 20 // Max size of a line in _bulk body
+	STATUS_CLIENT_CLOSED_REQUEST = 499      // The client went away before the response was written
+)
+
+// HTTP/JSON gateway of an IIndexer, which can be a single Indexer or the Sentinel of a cluster.
+//
+// Endpoints:
+//
+//	GET|POST   /_search    search documents, see searchBody
+//	GET|POST   /_count     count all documents, or documents matching the query in body
+//	PUT|POST   /_doc/{id}  add or update a document
+//	GET        /_doc/{id}  get a document
+//	DELETE     /_doc/{id}  delete a document
+//	POST       /_bulk      index or delete documents in batch, the body is newline delimited JSON
+//
+// Serve it alongside the grpc server: http.ListenAndServe(addr, NewHttpServer(indexer)). If the indexer implements
+// IContextIndexer, the context of the http request is passed down, so a client disconnect cancels the call.
+//
+// Searches of a Sentinel answer 503 with the shard failures when fewer shards succeeded than WithMinSuccessfulShards.
+type HttpServer struct {
+	indexer    IIndexer
+	ctxIndexer IContextIndexer // nil if indexer is not context-aware
+	mux        *http.ServeMux
+}
+
+func NewHttpServer(indexer IIndexer) *HttpServer {
+	server := &HttpServer{
+		indexer: indexer,
+		mux:     http.NewServeMux(),
+	}
+	server.ctxIndexer, _ = indexer.(IContextIndexer)
+	server.mux.HandleFunc("GET /_search", server.search)
+	server.mux.HandleFunc("POST /_search", server.search)
+	server.mux.HandleFunc("GET /_count", server.count)
+	server.mux.HandleFunc("POST /_count", server.count)
+	server.mux.HandleFunc("PUT /_doc/{id}", server.putDoc)
+	server.mux.HandleFunc("POST /_doc/{id}", server.putDoc)
+	server.mux.HandleFunc("GET /_doc/{id}", server.getDoc)
+	server.mux.HandleFunc("DELETE /_doc/{id}", server.deleteDoc)
+	server.mux.HandleFunc("POST /_bulk", server.bulk)
+	return server
+}
+
+func (server *HttpServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	server.mux.ServeHTTP(w, r)
+}
+
+func writeJson(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		util.Log.Printf("write http response failed: %s", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, errType string, err error) {
+	writeJson(w, status, map[string]any{
+		"error":  map[string]any{"type": errType, "reason": err.Error()},
+		"status": status,
+	})
+}
+
+// Write the error of a call to the indexer. Canceled or timed out calls have their own status, failed shards are
+// reported as errType with status 503, other errors with status 500
+func writeCallError(w http.ResponseWriter, errType string, err error) {
+	switch {
+	case isTimeout(err):
+		writeError(w, http.StatusGatewayTimeout, "timeout_exception", err)
+	case errors.Is(err, context.Canceled):
+		writeError(w, STATUS_CLIENT_CLOSED_REQUEST, "task_cancelled_exception", err)
+	case errors.Is(err, ErrShardsFailed):
+		writeError(w, http.StatusServiceUnavailable, errType, err)
+	default:
+		writeError(w, http.StatusInternalServerError, errType, err)
+	}
+}
+
+// Decode the request body into v, an empty body is allowed
+func decodeBody(r *http.Request, v any) error {
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(v); err != nil && err != io.EOF {
+		return err
+	}
+	return nil
+}
+
+func (server *HttpServer) search(w http.ResponseWriter, r *http.Request) {
+	begin := time.Now()
+	var body searchBody
+	if err := decodeBody(r, &body); err != nil {
+		writeError(w, http.StatusBadRequest, "parse_exception", err)
+		return
+	}
+	request, err := body.toSearchRequest()
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "parsing_exception", err)
+		return
+	}
+	result, err := server.searchContext(r.Context(), request)
+	if errors.Is(err, ErrTooFewShards) {
+		writeShardsError(w, result, err)
+		return
+	}
+	if err != nil {
+		writeCallError(w, "search_phase_execution_exception", err)
+		return
+	}
+	hits := make([]map[string]any, 0, len(result.Results))
+	for i, doc := range result.Results {
+		hit := map[string]any{"_id": doc.Id, "_source": newJsonDocument(doc)}
+		if i < len(result.Scores) {
+			hit["_score"] = result.Scores[i]
+		}
+		hits = append(hits, hit)
+	}
+	response := map[string]any{
+		"took": time.Since(begin).Milliseconds(),
+		"hits": map[string]any{
+			"total": result.TotalHits,
+			"hits":  hits,
+		},
+	}
+	if result.TotalShards > 0 { //Searched by Sentinel
+		response["_shards"] = shardsOf(result)
+	}
+	writeJson(w, http.StatusOK, response)
+}
+
+// Shard metadata of a search result of Sentinel
+func shardsOf(result *SearchResult) map[string]any {
+	failures := make([]map[string]any, 0, len(result.ShardFailures))
+	for _, failure := range result.ShardFailures {
+		failures = append(failures, map[string]any{"shard": failure.Shard, "reason": failure.Reason})
+	}
+	return map[string]any{
+		"total":      result.TotalShards,
+		"successful": result.SuccessfulShards,
+		"failed":     len(result.ShardFailures),
+		"failures":   failures,
+	}
+}
+
+// Too few shards answered, the cluster is degraded. Respond 503 with the shard failures instead of partial results
+func writeShardsError(w http.ResponseWriter, result *SearchResult, err error) {
+	status := http.StatusServiceUnavailable
+	writeJson(w, status, map[string]any{
+		"error":   map[string]any{"type": "search_phase_execution_exception", "reason": err.Error()},
+		"status":  status,
+		"_shards": shardsOf(result),
+	})
+}
+
+func (server *HttpServer) count(w http.ResponseWriter, r *http.Request) {
+	var body searchBody
+	if err := decodeBody(r, &body); err != nil {
+		writeError(w, http.StatusBadRequest, "parse_exception", err)
+		return
+	}
+	if len(bytes.TrimSpace(body.Query)) == 0 {
+		n, err := server.countContext(r.Context())
+		if err != nil {
+			writeCallError(w, "search_phase_execution_exception", err)
+			return
+		}
+		writeJson(w, http.StatusOK, map[string]any{"count": n})
+		return
+	}
+	request, err := body.toSearchRequest()
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "parsing_exception", err)
+		return
+	}
+	request.From, request.PageSize, request.Sort = 0, 1, nil //Only TotalHits is needed
+	result, err := server.searchContext(r.Context(), request)
+	if errors.Is(err, ErrTooFewShards) {
+		writeShardsError(w, result, err)
+		return
+	}
+	if err != nil {
+		writeCallError(w, "search_phase_execution_exception", err)
+		return
+	}
+	writeJson(w, http.StatusOK, map[string]any{"count": result.TotalHits})
+}
+
+func (server *HttpServer) putDoc(w http.ResponseWriter, r *http.Request) {
+	var body jsonDocument
+	if err := decodeBody(r, &body); err != nil {
+		writeError(w, http.StatusBadRequest, "parse_exception", err)
+		return
+	}
+	body.Id = r.PathValue("id")
+	n, err := server.addDocContext(r.Context(), body.toDocument())
+	if err != nil {
+		writeCallError(w, "index_failed_exception", err)
+		return
+	}
+	writeJson(w, http.StatusOK, map[string]any{"_id": body.Id, "result": "indexed", "count": n})
+}
+
+func (server *HttpServer) getDoc(w http.ResponseWriter, r *http.Request) {
+	docId := r.PathValue("id")
+	doc, err := server.getDocContext(r.Context(), docId)
+	if err != nil {
+		writeCallError(w, "get_failed_exception", err)
+		return
+	}
+	if doc == nil {
+		writeJson(w, http.StatusNotFound, map[string]any{"_id": docId, "found": false})
+		return
+	}
+	writeJson(w, http.StatusOK, map[string]any{"_id": docId, "found": true, "_source": newJsonDocument(doc)})
+}
+
+func (server *HttpServer) deleteDoc(w http.ResponseWriter, r *http.Request) {
+	docId := r.PathValue("id")
+	n, err := server.deleteDocContext(r.Context(), docId)
+	if err != nil {
+		writeCallError(w, "delete_failed_exception", err)
+		return
+	}
+	if n == 0 {
+		writeJson(w, http.StatusNotFound, map[string]any{"_id": docId, "result": "not_found"})
+		return
+	}
+	writeJson(w, http.StatusOK, map[string]any{"_id": docId, "result": "deleted"})
+}
+
+// Action line of _bulk, e.g. {"index": {"_id": "1"}} followed by the document, or {"delete": {"_id": "1"}}
+type bulkAction map[string]struct {
+	Id string `json:"_id"`
+}
+
+func (server *HttpServer) bulk(w http.ResponseWriter, r *http.Request) {
+	begin := time.Now()
+	scanner := bufio.NewScanner(r.Body)
+	scanner.Buffer(make([]byte, 0, 64*1024), MAX_BULK_LINE_SIZE)
+	items := make([]map[string]any, 0, 100)
+	hasError := false
+	// Read the next non-empty line
+	nextLine := func() ([]byte, bool) {
+		for scanner.Scan() {
+			if line := bytes.TrimSpace(scanner.Bytes()); len(line) > 0 {
+				return line, true
+			}
+		}
+		return nil, false
+	}
+	for {
+		line, ok := nextLine()
+		if !ok {
+			break
+		}
+		var action bulkAction
+		if err := json.Unmarshal(line, &action); err != nil || len(action) != 1 {
+			writeError(w, http.StatusBadRequest, "illegal_argument_exception", fmt.Errorf("malformed action line %s", string(line)))
+			return
+		}
+		for op, meta := range action {
+			item := map[string]any{"_id": meta.Id}
+			switch op {
+			case "index", "create":
+				source, ok := nextLine()
+				if !ok {
+					writeError(w, http.StatusBadRequest, "illegal_argument_exception", fmt.Errorf("missing document of %s %s", op, meta.Id))
+					return
+				}
+				var body jsonDocument
+				if err := json.Unmarshal(source, &body); err != nil {
+					item["status"], item["error"] = http.StatusBadRequest, err.Error()
+					break
+				}
+				if len(meta.Id) > 0 {
+					body.Id = meta.Id
+				}
+				item["_id"] = body.Id
+				if _, err := server.addDocContext(r.Context(), body.toDocument()); err != nil {
+					item["status"], item["error"] = http.StatusInternalServerError, err.Error()
+				} else {
+					item["status"], item["result"] = http.StatusOK, "indexed"
+				}
+			case "delete":
+				if n, err := server.deleteDocContext(r.Context(), meta.Id); err != nil {
+					item["status"], item["error"] = http.StatusInternalServerError, err.Error()
+				} else if n > 0 {
+					item["status"], item["result"] = http.StatusOK, "deleted"
+				} else {
+					item["status"], item["result"] = http.StatusNotFound, "not_found"
+				}
+			default:
+				writeError(w, http.StatusBadRequest, "illegal_argument_exception", fmt.Errorf("unknown bulk action [%s]", op))
+				return
+			}
+			if _, failed := item["error"]; failed {
+				hasError = true
+			}
+			items = append(items, map[string]any{op: item})
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		writeError(w, http.StatusBadRequest, "parse_exception", err)
+		return
+	}
+	writeJson(w, http.StatusOK, map[string]any{
+		"took":   time.Since(begin).Milliseconds(),
+		"errors": hasError,
+		"items":  items,
+	})
+}
+
+// Call SearchContext if the indexer is context-aware, otherwise Search. So are the other wrappers below
+func (server *HttpServer) searchContext(ctx context.Context, request *SearchRequest) (*SearchResult, error) {
+	if server.ctxIndexer != nil {
+		return server.ctxIndexer.SearchContext(ctx, request)
+	}
+	return server.indexer.Search(request), nil
+}
+
+func (server *HttpServer) countContext(ctx context.Context) (int, error) {
+	if server.ctxIndexer != nil {
+		return server.ctxIndexer.CountContext(ctx)
+	}
+	return server.indexer.Count(), nil
+}
+
+func (server *HttpServer) addDocContext(ctx context.Context, doc types.Document) (int, error) {
+	if server.ctxIndexer != nil {
+		return server.ctxIndexer.AddDocContext(ctx, doc)
+	}
+	return server.indexer.AddDoc(doc)
+}
+
+func (server *HttpServer) getDocContext(ctx context.Context, docId string) (*types.Document, error) {
+	if server.ctxIndexer != nil {
+		return server.ctxIndexer.GetDocContext(ctx, docId)
+	}
+	return server.indexer.GetDoc(docId), nil
+}
+
+func (server *HttpServer) deleteDocContext(ctx context.Context, docId string) (int, error) {
+	if server.ctxIndexer != nil {
+		return server.ctxIndexer.DeleteDocContext(ctx, docId)
+	}
+	return server.indexer.DeleteDoc(docId), nil
+}
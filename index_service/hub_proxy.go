@@ -2,8 +2,9 @@ package index_service
 
 import (
 	context "context"
-	"strings"
+	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/kisaragi77/TinyES/util"
@@ -11,90 +12,351 @@ import (
 	"golang.org/x/time/rate"
 )
 
+// Service registry, backed by etcd(ServiceHub/HubProxy), a fixed endpoint list(StaticHub), a local file(FileHub)
+// or the memory of current process(MemoryHub)
 type IServiceHub interface {
-	Regist(service string, endpoint string, leaseID etcdv3.LeaseID) (etcdv3.LeaseID, error) // Register service
-	UnRegist(service string, endpoint string) error                                         // Unregister service
-	GetServiceEndpoints(service string) []string                                            // Service discovery
-	GetServiceEndpoint(service string) string                                               // Choose an endpoint of a service
-	Close()                                                                                 // Close etcd client connection
+	Regist(service string, endpoint string, leaseID int64) (int64, error) // Register service
+	UnRegist(service string, endpoint string) error                       // Unregister service
+	GetServiceEndpoints(service string) []string                          // Service discovery
+	GetServiceEndpoint(service string) string                             // Choose an endpoint of a service
+	Close()                                                               // Close connection to the registry
 }
 
+const (
+	WATCH_RETRY_INTERVAL = time.Second     // Wait so long before watching etcd again after the watch broke
+	ETCD_READ_TIMEOUT    = 3 * time.Second // Timeout of reading endpoints from etcd on cache miss or revalidation
+)
+
 // Provide cache and rate limiting protection by ServiceHub Proxy
+//
+// Lookups are served from the cache kept up to date by watching etcd, the limiter applies to every full read of etcd:
+// lookups missing the cache, revalidations and resyncs of the watches.
+// If the cache hasn't been synced for a while, it's still served and revalidated in background(stale-while-revalidate).
 type HubProxy struct {
 	*ServiceHub
-	endpointCache sync.Map
+	endpointCache sync.Map // Service -> []EndpointInfo
 	limiter       *rate.Limiter
+	staleAfter    time.Duration                         // Cache not synced for so long is revalidated
+	listeners     map[string][]func(endpoints []string) // Service -> callbacks on endpoints change
+	listenerLock  sync.RWMutex
+	ctx           context.Context // Canceled on Close to stop the watches
+	cancel        context.CancelFunc
+
+	cacheHits     atomic.Uint64
+	staleHits     atomic.Uint64
+	cacheMisses   atomic.Uint64
+	throttled     atomic.Uint64
+	revalidations atomic.Uint64
+	resyncs       atomic.Uint64
 }
 
-var (
-	proxy     *HubProxy
-	proxyOnce sync.Once
-)
+// Counters of the endpoint lookups of HubProxy
+type HubProxyStats struct {
+	CacheHits     uint64 // Lookups served from cache, including the stale ones
+	StaleHits     uint64 // Lookups served from cache not synced within the stale time, which triggers a revalidation
+	CacheMisses   uint64 // Lookups of services not in cache, which read etcd
+	Throttled     uint64 // Reads of etcd rejected by the limiter. A miss gets no endpoints, a stale cache is not revalidated
+	Revalidations uint64 // Reads of etcd in background to revalidate stale cache
+	Resyncs       uint64 // Reads of etcd by the watches, when started without cached endpoints or after compaction
+}
 
-// Constructor of HubProxy(Return Single Instance)
-//
-// qps : Max requests per second
-func GetServiceHubProxy(etcdServers []string, heartbeatFrequency int64, qps int) *HubProxy {
-	if proxy == nil {
-		proxyOnce.Do(func() {
-			serviceHub := GetServiceHub(etcdServers, heartbeatFrequency)
-			if serviceHub != nil {
-				proxy = &HubProxy{
-					ServiceHub:    serviceHub,
-					endpointCache: sync.Map{},
-					limiter:       rate.NewLimiter(rate.Every(time.Duration(1e9/qps)*time.Nanosecond), qps),
-				}
-			}
-		})
+// Constructor of HubProxy. Each HubProxy has its own ServiceHub, call Close when it's no longer used
+func NewHubProxy(options ...HubOption) (*HubProxy, error) {
+	opts := newHubOptions(options)
+	serviceHub, err := newServiceHub(opts)
+	if err != nil {
+		return nil, err
+	}
+	qps := opts.qps
+	if qps <= 0 {
+		qps = 100
 	}
-	return proxy
+	ctx, cancel := context.WithCancel(context.Background())
+	return &HubProxy{
+		ServiceHub:    serviceHub,
+		endpointCache: sync.Map{},
+		limiter:       rate.NewLimiter(rate.Every(time.Duration(1e9/qps)*time.Nanosecond), qps),
+		staleAfter:    opts.staleAfter,
+		listeners:     make(map[string][]func(endpoints []string)),
+		ctx:           ctx,
+		cancel:        cancel,
+	}, nil
+}
+
+// State of the watch on endpoints of a service
+type serviceWatch struct {
+	lock         sync.Mutex
+	infos        map[string]EndpointInfo // Endpoint -> metadata, applied with the events since revision
+	revision     int64                   // Revision of etcd the infos are synced to
+	lastSync     time.Time               // When the infos were confirmed up to date last time
+	revalidating atomic.Bool
+	started      atomic.Bool // Whether watchLoop is running
 }
 
-// Watch etcd service endpoints
+func (watch *serviceWatch) getRevision() int64 {
+	watch.lock.Lock()
+	defer watch.lock.Unlock()
+	return watch.revision
+}
+
+func (watch *serviceWatch) synced() time.Time {
+	watch.lock.Lock()
+	defer watch.lock.Unlock()
+	return watch.lastSync
+}
+
+// Watch etcd service endpoints. The watch is resumed from the last revision when it breaks(e.g. etcd restarts or
+// loses leader), and all endpoints are read again if the revision has been compacted.
 func (proxy *HubProxy) watchEndpointsOfService(service string) {
-	if _, exists := proxy.watched.LoadOrStore(service, true); exists {
-		return
+	proxy.watchOf(service)
+}
+
+// State of the watch on service, start watching if not yet
+func (proxy *HubProxy) watchOf(service string) *serviceWatch {
+	watch := proxy.watchState(service)
+	proxy.startWatch(service, watch)
+	return watch
+}
+
+// State of the watch on service, created without watching if not yet
+func (proxy *HubProxy) watchState(service string) *serviceWatch {
+	if v, exists := proxy.watched.Load(service); exists {
+		return v.(*serviceWatch)
 	}
-	ctx := context.Background()
-	prefix := strings.TrimRight(SERVICE_ROOT_PATH, "/") + "/" + service + "/"
-	ch := proxy.client.Watch(ctx, prefix, etcdv3.WithPrefix())
-	util.Log.Printf("监听服务%s的节点变化", service)
-	go func() {
+	v, _ := proxy.watched.LoadOrStore(service, &serviceWatch{})
+	return v.(*serviceWatch)
+}
+
+// Start watchLoop of service if not yet. If the endpoints have been read, the watch starts from their revision
+// without reading etcd again
+func (proxy *HubProxy) startWatch(service string, watch *serviceWatch) {
+	if watch.started.CompareAndSwap(false, true) {
+		util.Log.Printf("监听服务%s的节点变化", service)
+		go proxy.watchLoop(service, watch)
+	}
+}
+
+func (proxy *HubProxy) watchLoop(service string, watch *serviceWatch) {
+	prefix := proxy.servicePrefix(service)
+	for proxy.ctx.Err() == nil {
+		if watch.getRevision() == 0 && !proxy.resync(service, watch) {
+			proxy.sleep(WATCH_RETRY_INTERVAL)
+			continue
+		}
+		ctx, cancel := context.WithCancel(etcdv3.WithRequireLeader(proxy.ctx)) //etcd失去leader时中断watch，而不是一直等着
+		ch := proxy.client.Watch(ctx, prefix, etcdv3.WithPrefix(), etcdv3.WithRev(watch.getRevision()+1), etcdv3.WithProgressNotify())
 		for response := range ch {
-			for _, event := range response.Events {
-				util.Log.Printf("etcd event type %s", event.Type)
-				path := strings.Split(string(event.Kv.Key), "/")
-				if len(path) > 2 {
-					service := path[len(path)-2]
-					endpoints := proxy.ServiceHub.GetServiceEndpoints(service)
-					if len(endpoints) > 0 {
-						proxy.endpointCache.Store(service, endpoints)
-					} else {
-						proxy.endpointCache.Delete(service)
-					}
-				}
+			if response.CompactRevision > 0 { //要续接的revision已经被压缩了，全量同步一次
+				util.Log.Printf("revision %d of service %s has been compacted, resync", watch.getRevision(), service)
+				watch.lock.Lock()
+				watch.revision = 0
+				watch.lock.Unlock()
+				break
 			}
+			if err := response.Err(); err != nil {
+				util.Log.Printf("watch service %s failed: %s", service, err)
+				break
+			}
+			proxy.apply(service, watch, response)
 		}
-	}()
+		cancel()
+		if revision := watch.getRevision(); proxy.ctx.Err() == nil && revision > 0 {
+			util.Log.Printf("watch of service %s broken at revision %d, rewatch", service, revision)
+			proxy.sleep(WATCH_RETRY_INTERVAL)
+		}
+	}
+}
+
+// Read all endpoints of service from etcd when the limiter allows, return false if failed
+func (proxy *HubProxy) resync(service string, watch *serviceWatch) bool {
+	if err := proxy.limiter.Wait(proxy.ctx); err != nil {
+		return false
+	}
+	proxy.resyncs.Add(1)
+	infos, revision, err := proxy.loadEndpointInfos(proxy.ctx, service)
+	if err != nil {
+		util.Log.Printf("resync service %s failed: %s", service, err)
+		return false
+	}
+	proxy.replace(service, watch, infos, revision)
+	return true
+}
+
+// Replace the endpoints of service with infos read from etcd at revision. Ignored if the watch is already beyond revision
+func (proxy *HubProxy) replace(service string, watch *serviceWatch, infos []EndpointInfo, revision int64) {
+	watch.lock.Lock()
+	if revision < watch.revision {
+		watch.lock.Unlock()
+		return
+	}
+	watch.infos = make(map[string]EndpointInfo, len(infos))
+	for _, info := range infos {
+		watch.infos[info.Endpoint] = info
+	}
+	watch.revision = revision //watch收到的事件如果不比revision新，就不再应用
+	watch.lastSync = time.Now()
+	proxy.endpointCache.Store(service, infos)
+	watch.lock.Unlock()
+	proxy.notify(service, infos)
+}
+
+// Apply the events of a watch response to the endpoints of service
+func (proxy *HubProxy) apply(service string, watch *serviceWatch, response etcdv3.WatchResponse) {
+	watch.lock.Lock()
+	changed := false
+	for _, event := range response.Events {
+		util.Log.Printf("etcd event type %s", event.Type)
+		if event.Kv.ModRevision <= watch.revision { //已经包含在revalidate读到的结果里了
+			continue
+		}
+		changed = true
+		endpoint := endpointOfKey(event.Kv.Key)
+		if event.Type == etcdv3.EventTypeDelete {
+			delete(watch.infos, endpoint)
+		} else {
+			watch.infos[endpoint] = parseEndpointInfo(endpoint, event.Kv.Value)
+		}
+	}
+	if response.Header.Revision > watch.revision {
+		watch.revision = response.Header.Revision
+	}
+	watch.lastSync = time.Now() //包括没有事件的进度通知
+	var infos []EndpointInfo
+	if changed {
+		infos = make([]EndpointInfo, 0, len(watch.infos))
+		for _, info := range watch.infos {
+			infos = append(infos, info)
+		}
+		sort.Slice(infos, func(i, j int) bool { return infos[i].Endpoint < infos[j].Endpoint })
+		proxy.endpointCache.Store(service, infos)
+	}
+	watch.lock.Unlock()
+	if changed {
+		if weighted, ok := proxy.loadBalancer.(WeightedLoadBalancer); ok {
+			weighted.SetWeights(endpointWeights(infos))
+		}
+		proxy.notify(service, infos)
+	}
+}
+
+// Call the listeners with the latest endpoints of service
+func (proxy *HubProxy) notify(service string, infos []EndpointInfo) {
+	endpoints := filterEndpoints(infos, nil)
+	proxy.listenerLock.RLock()
+	listeners := proxy.listeners[service]
+	proxy.listenerLock.RUnlock()
+	for _, fn := range listeners {
+		fn(endpoints)
+	}
+}
+
+func (proxy *HubProxy) sleep(d time.Duration) {
+	select {
+	case <-time.After(d):
+	case <-proxy.ctx.Done():
+	}
+}
+
+// When the cached endpoints of service were confirmed up to date last time, by reading etcd or receiving a watch
+// response(etcd sends progress notifications periodically when there is no change). Zero if service is not watched or
+// never synced. If it's too long ago, the cache may be stale, e.g. etcd is unreachable.
+func (proxy *HubProxy) LastSyncTime(service string) time.Time {
+	v, exists := proxy.watched.Load(service)
+	if !exists {
+		return time.Time{}
+	}
+	return v.(*serviceWatch).synced()
+}
+
+// Register a callback, which is called with the latest endpoints when endpoints of the service change
+func (proxy *HubProxy) OnEndpointsChange(service string, fn func(endpoints []string)) {
+	proxy.listenerLock.Lock()
+	proxy.listeners[service] = append(proxy.listeners[service], fn)
+	proxy.listenerLock.Unlock()
+	proxy.watchEndpointsOfService(service)
 }
 
 // Service discovery
 //
 // Update cache when etcd changes.
 func (proxy *HubProxy) GetServiceEndpoints(service string) []string {
+	return filterEndpoints(proxy.GetServiceEndpointInfos(service), nil)
+}
 
+// Service discovery with the metadata published by endpoints.
+//
+// On cache miss etcd is read if the limiter allows, and the watch of service starts from the revision read, so the
+// endpoints are not read again by the watch.
+func (proxy *HubProxy) GetServiceEndpointInfos(service string) []EndpointInfo {
+	watch := proxy.watchState(service)
+	defer proxy.startWatch(service, watch)
+	if infos, exists := proxy.endpointCache.Load(service); exists {
+		proxy.cacheHits.Add(1)
+		if time.Since(watch.synced()) > proxy.staleAfter {
+			proxy.staleHits.Add(1)
+			proxy.revalidate(service, watch)
+		}
+		return infos.([]EndpointInfo)
+	}
+
+	proxy.cacheMisses.Add(1)
 	if !proxy.limiter.Allow() {
+		proxy.throttled.Add(1)
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(proxy.ctx, ETCD_READ_TIMEOUT)
+	defer cancel()
+	infos, revision, err := proxy.loadEndpointInfos(ctx, service)
+	if err != nil {
+		util.Log.Printf("Failed to Get Nodes of Service %s: %v", service, err)
 		return nil
 	}
+	proxy.replace(service, watch, infos, revision)
+	return infos
+}
 
-	proxy.watchEndpointsOfService(service)
-	if endpoints, exists := proxy.endpointCache.Load(service); exists {
-		return endpoints.([]string)
-	} else {
-		endpoints := proxy.ServiceHub.GetServiceEndpoints(service)
-		if len(endpoints) > 0 {
-			proxy.endpointCache.Store(service, endpoints)
+// Read endpoints of service from etcd in background, at most one revalidation of a service at a time
+func (proxy *HubProxy) revalidate(service string, watch *serviceWatch) {
+	if !watch.revalidating.CompareAndSwap(false, true) {
+		return
+	}
+	if !proxy.limiter.Allow() {
+		proxy.throttled.Add(1)
+		watch.revalidating.Store(false)
+		return
+	}
+	proxy.revalidations.Add(1)
+	go func() {
+		defer watch.revalidating.Store(false)
+		ctx, cancel := context.WithTimeout(proxy.ctx, ETCD_READ_TIMEOUT)
+		defer cancel()
+		if infos, revision, err := proxy.loadEndpointInfos(ctx, service); err != nil {
+			util.Log.Printf("revalidate service %s failed: %s", service, err)
+		} else {
+			proxy.replace(service, watch, infos, revision)
 		}
-		return endpoints
+	}()
+}
+
+// Counters of endpoint lookups, for monitoring
+func (proxy *HubProxy) Stats() HubProxyStats {
+	return HubProxyStats{
+		CacheHits:     proxy.cacheHits.Load(),
+		StaleHits:     proxy.staleHits.Load(),
+		CacheMisses:   proxy.cacheMisses.Load(),
+		Throttled:     proxy.throttled.Load(),
+		Revalidations: proxy.revalidations.Load(),
+		Resyncs:       proxy.resyncs.Load(),
 	}
 }
+
+// Select a server from the cached endpoints according to load balancing
+func (proxy *HubProxy) GetServiceEndpoint(service string) string {
+	return proxy.loadBalancer.Take(proxy.GetServiceEndpoints(service))
+}
+
+// Stop watching etcd and close etcd client connection
+func (proxy *HubProxy) Close() {
+	proxy.cancel()
+	proxy.ServiceHub.Close()
+}
@@ -5,6 +5,7 @@ package index_service
 
 import (
 	context "context"
+	encoding_binary "encoding/binary"
 	fmt "fmt"
 	types "github.com/kisaragi77/TinyES/types"
 	proto "github.com/gogo/protobuf/proto"
@@ -27,6 +28,59 @@ var _ = math.Inf
 // proto package needs to be updated.
 const _ = proto.GoGoProtoPackageIsVersion3 // please upgrade the proto package
 
+type SortBy int32
+
+const (
+	SortBy_SCORE SortBy = 0
+	SortBy_ID    SortBy = 1
+)
+
+var SortBy_name = map[int32]string{
+	0: "SCORE",
+	1: "ID",
+}
+
+var SortBy_value = map[string]int32{
+	"SCORE": 0,
+	"ID":    1,
+}
+
+func (x SortBy) String() string {
+	return proto.EnumName(SortBy_name, int32(x))
+}
+
+func (SortBy) EnumDescriptor() ([]byte, []int) {
+	return fileDescriptor_f750e0f7889345b5, []int{0}
+}
+
+type SortOrder int32
+
+const (
+	SortOrder_DEFAULT SortOrder = 0
+	SortOrder_ASC     SortOrder = 1
+	SortOrder_DESC    SortOrder = 2
+)
+
+var SortOrder_name = map[int32]string{
+	0: "DEFAULT",
+	1: "ASC",
+	2: "DESC",
+}
+
+var SortOrder_value = map[string]int32{
+	"DEFAULT": 0,
+	"ASC":     1,
+	"DESC":    2,
+}
+
+func (x SortOrder) String() string {
+	return proto.EnumName(SortOrder_name, int32(x))
+}
+
+func (SortOrder) EnumDescriptor() ([]byte, []int) {
+	return fileDescriptor_f750e0f7889345b5, []int{1}
+}
+
 type DocId struct {
 	DocId string `protobuf:"bytes,1,opt,name=DocId,proto3" json:"DocId,omitempty"`
 }
@@ -71,6 +125,94 @@ func (m *DocId) GetDocId() string {
 	return ""
 }
 
+type DocIds struct {
+	DocIds []string `protobuf:"bytes,1,rep,name=DocIds,proto3" json:"DocIds,omitempty"`
+}
+
+func (m *DocIds) Reset()         { *m = DocIds{} }
+func (m *DocIds) String() string { return proto.CompactTextString(m) }
+func (*DocIds) ProtoMessage()    {}
+func (*DocIds) Descriptor() ([]byte, []int) {
+	return fileDescriptor_f750e0f7889345b5, []int{1}
+}
+func (m *DocIds) XXX_Unmarshal(b []byte) error {
+	return m.Unmarshal(b)
+}
+func (m *DocIds) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	if deterministic {
+		return xxx_messageInfo_DocIds.Marshal(b, m, deterministic)
+	} else {
+		b = b[:cap(b)]
+		n, err := m.MarshalToSizedBuffer(b)
+		if err != nil {
+			return nil, err
+		}
+		return b[:n], nil
+	}
+}
+func (m *DocIds) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_DocIds.Merge(m, src)
+}
+func (m *DocIds) XXX_Size() int {
+	return m.Size()
+}
+func (m *DocIds) XXX_DiscardUnknown() {
+	xxx_messageInfo_DocIds.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_DocIds proto.InternalMessageInfo
+
+func (m *DocIds) GetDocIds() []string {
+	if m != nil {
+		return m.DocIds
+	}
+	return nil
+}
+
+type Documents struct {
+	Docs []*types.Document `protobuf:"bytes,1,rep,name=Docs,proto3" json:"Docs,omitempty"`
+}
+
+func (m *Documents) Reset()         { *m = Documents{} }
+func (m *Documents) String() string { return proto.CompactTextString(m) }
+func (*Documents) ProtoMessage()    {}
+func (*Documents) Descriptor() ([]byte, []int) {
+	return fileDescriptor_f750e0f7889345b5, []int{2}
+}
+func (m *Documents) XXX_Unmarshal(b []byte) error {
+	return m.Unmarshal(b)
+}
+func (m *Documents) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	if deterministic {
+		return xxx_messageInfo_Documents.Marshal(b, m, deterministic)
+	} else {
+		b = b[:cap(b)]
+		n, err := m.MarshalToSizedBuffer(b)
+		if err != nil {
+			return nil, err
+		}
+		return b[:n], nil
+	}
+}
+func (m *Documents) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Documents.Merge(m, src)
+}
+func (m *Documents) XXX_Size() int {
+	return m.Size()
+}
+func (m *Documents) XXX_DiscardUnknown() {
+	xxx_messageInfo_Documents.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Documents proto.InternalMessageInfo
+
+func (m *Documents) GetDocs() []*types.Document {
+	if m != nil {
+		return m.Docs
+	}
+	return nil
+}
+
 type AffectedCount struct {
 	Count int32 `protobuf:"varint,1,opt,name=Count,proto3" json:"Count,omitempty"`
 }
@@ -79,7 +221,7 @@ func (m *AffectedCount) Reset()         { *m = AffectedCount{} }
 func (m *AffectedCount) String() string { return proto.CompactTextString(m) }
 func (*AffectedCount) ProtoMessage()    {}
 func (*AffectedCount) Descriptor() ([]byte, []int) {
-	return fileDescriptor_f750e0f7889345b5, []int{1}
+	return fileDescriptor_f750e0f7889345b5, []int{3}
 }
 func (m *AffectedCount) XXX_Unmarshal(b []byte) error {
 	return m.Unmarshal(b)
@@ -115,18 +257,75 @@ func (m *AffectedCount) GetCount() int32 {
 	return 0
 }
 
+type SortSpec struct {
+	By    SortBy    `protobuf:"varint,1,opt,name=By,proto3,enum=index_service.SortBy" json:"By,omitempty"`
+	Order SortOrder `protobuf:"varint,2,opt,name=Order,proto3,enum=index_service.SortOrder" json:"Order,omitempty"`
+}
+
+func (m *SortSpec) Reset()         { *m = SortSpec{} }
+func (m *SortSpec) String() string { return proto.CompactTextString(m) }
+func (*SortSpec) ProtoMessage()    {}
+func (*SortSpec) Descriptor() ([]byte, []int) {
+	return fileDescriptor_f750e0f7889345b5, []int{4}
+}
+func (m *SortSpec) XXX_Unmarshal(b []byte) error {
+	return m.Unmarshal(b)
+}
+func (m *SortSpec) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	if deterministic {
+		return xxx_messageInfo_SortSpec.Marshal(b, m, deterministic)
+	} else {
+		b = b[:cap(b)]
+		n, err := m.MarshalToSizedBuffer(b)
+		if err != nil {
+			return nil, err
+		}
+		return b[:n], nil
+	}
+}
+func (m *SortSpec) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_SortSpec.Merge(m, src)
+}
+func (m *SortSpec) XXX_Size() int {
+	return m.Size()
+}
+func (m *SortSpec) XXX_DiscardUnknown() {
+	xxx_messageInfo_SortSpec.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_SortSpec proto.InternalMessageInfo
+
+func (m *SortSpec) GetBy() SortBy {
+	if m != nil {
+		return m.By
+	}
+	return SortBy_SCORE
+}
+
+func (m *SortSpec) GetOrder() SortOrder {
+	if m != nil {
+		return m.Order
+	}
+	return SortOrder_DEFAULT
+}
+
 type SearchRequest struct {
-	Query   *types.TermQuery `protobuf:"bytes,1,opt,name=Query,proto3" json:"Query,omitempty"`
-	OnFlag  uint64           `protobuf:"varint,2,opt,name=OnFlag,proto3" json:"OnFlag,omitempty"`
-	OffFlag uint64           `protobuf:"varint,3,opt,name=OffFlag,proto3" json:"OffFlag,omitempty"`
-	OrFlags []uint64         `protobuf:"varint,4,rep,packed,name=OrFlags,proto3" json:"OrFlags,omitempty"`
+	Query     *types.TermQuery `protobuf:"bytes,1,opt,name=Query,proto3" json:"Query,omitempty"`
+	OnFlag    uint64           `protobuf:"varint,2,opt,name=OnFlag,proto3" json:"OnFlag,omitempty"`
+	OffFlag   uint64           `protobuf:"varint,3,opt,name=OffFlag,proto3" json:"OffFlag,omitempty"`
+	OrFlags   []uint64         `protobuf:"varint,4,rep,packed,name=OrFlags,proto3" json:"OrFlags,omitempty"`
+	From      int32            `protobuf:"varint,5,opt,name=From,proto3" json:"From,omitempty"`
+	PageSize  int32            `protobuf:"varint,6,opt,name=PageSize,proto3" json:"PageSize,omitempty"`
+	Sort      []*SortSpec      `protobuf:"bytes,7,rep,name=Sort,proto3" json:"Sort,omitempty"`
+	Endpoints []string         `protobuf:"bytes,8,rep,name=Endpoints,proto3" json:"Endpoints,omitempty"`
+	Shards    []string         `protobuf:"bytes,9,rep,name=Shards,proto3" json:"Shards,omitempty"`
 }
 
 func (m *SearchRequest) Reset()         { *m = SearchRequest{} }
 func (m *SearchRequest) String() string { return proto.CompactTextString(m) }
 func (*SearchRequest) ProtoMessage()    {}
 func (*SearchRequest) Descriptor() ([]byte, []int) {
-	return fileDescriptor_f750e0f7889345b5, []int{2}
+	return fileDescriptor_f750e0f7889345b5, []int{5}
 }
 func (m *SearchRequest) XXX_Unmarshal(b []byte) error {
 	return m.Unmarshal(b)
@@ -183,15 +382,107 @@ func (m *SearchRequest) GetOrFlags() []uint64 {
 	return nil
 }
 
+func (m *SearchRequest) GetFrom() int32 {
+	if m != nil {
+		return m.From
+	}
+	return 0
+}
+
+func (m *SearchRequest) GetPageSize() int32 {
+	if m != nil {
+		return m.PageSize
+	}
+	return 0
+}
+
+func (m *SearchRequest) GetSort() []*SortSpec {
+	if m != nil {
+		return m.Sort
+	}
+	return nil
+}
+
+func (m *SearchRequest) GetEndpoints() []string {
+	if m != nil {
+		return m.Endpoints
+	}
+	return nil
+}
+
+func (m *SearchRequest) GetShards() []string {
+	if m != nil {
+		return m.Shards
+	}
+	return nil
+}
+
+type ShardFailure struct {
+	Shard  string `protobuf:"bytes,1,opt,name=Shard,proto3" json:"Shard,omitempty"`
+	Reason string `protobuf:"bytes,2,opt,name=Reason,proto3" json:"Reason,omitempty"`
+}
+
+func (m *ShardFailure) Reset()         { *m = ShardFailure{} }
+func (m *ShardFailure) String() string { return proto.CompactTextString(m) }
+func (*ShardFailure) ProtoMessage()    {}
+func (*ShardFailure) Descriptor() ([]byte, []int) {
+	return fileDescriptor_f750e0f7889345b5, []int{6}
+}
+func (m *ShardFailure) XXX_Unmarshal(b []byte) error {
+	return m.Unmarshal(b)
+}
+func (m *ShardFailure) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	if deterministic {
+		return xxx_messageInfo_ShardFailure.Marshal(b, m, deterministic)
+	} else {
+		b = b[:cap(b)]
+		n, err := m.MarshalToSizedBuffer(b)
+		if err != nil {
+			return nil, err
+		}
+		return b[:n], nil
+	}
+}
+func (m *ShardFailure) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ShardFailure.Merge(m, src)
+}
+func (m *ShardFailure) XXX_Size() int {
+	return m.Size()
+}
+func (m *ShardFailure) XXX_DiscardUnknown() {
+	xxx_messageInfo_ShardFailure.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ShardFailure proto.InternalMessageInfo
+
+func (m *ShardFailure) GetShard() string {
+	if m != nil {
+		return m.Shard
+	}
+	return ""
+}
+
+func (m *ShardFailure) GetReason() string {
+	if m != nil {
+		return m.Reason
+	}
+	return ""
+}
+
 type SearchResult struct {
-	Results []*types.Document `protobuf:"bytes,1,rep,name=Results,proto3" json:"Results,omitempty"`
+	Results          []*types.Document `protobuf:"bytes,1,rep,name=Results,proto3" json:"Results,omitempty"`
+	Scores           []float64         `protobuf:"fixed64,2,rep,packed,name=Scores,proto3" json:"Scores,omitempty"`
+	TotalHits        int64             `protobuf:"varint,3,opt,name=TotalHits,proto3" json:"TotalHits,omitempty"`
+	TotalShards      int32             `protobuf:"varint,4,opt,name=TotalShards,proto3" json:"TotalShards,omitempty"`
+	SuccessfulShards int32             `protobuf:"varint,5,opt,name=SuccessfulShards,proto3" json:"SuccessfulShards,omitempty"`
+	ShardFailures    []*ShardFailure   `protobuf:"bytes,6,rep,name=ShardFailures,proto3" json:"ShardFailures,omitempty"`
 }
 
 func (m *SearchResult) Reset()         { *m = SearchResult{} }
 func (m *SearchResult) String() string { return proto.CompactTextString(m) }
 func (*SearchResult) ProtoMessage()    {}
 func (*SearchResult) Descriptor() ([]byte, []int) {
-	return fileDescriptor_f750e0f7889345b5, []int{3}
+	return fileDescriptor_f750e0f7889345b5, []int{7}
 }
 func (m *SearchResult) XXX_Unmarshal(b []byte) error {
 	return m.Unmarshal(b)
@@ -227,14 +518,51 @@ func (m *SearchResult) GetResults() []*types.Document {
 	return nil
 }
 
+func (m *SearchResult) GetScores() []float64 {
+	if m != nil {
+		return m.Scores
+	}
+	return nil
+}
+
+func (m *SearchResult) GetTotalHits() int64 {
+	if m != nil {
+		return m.TotalHits
+	}
+	return 0
+}
+
+func (m *SearchResult) GetTotalShards() int32 {
+	if m != nil {
+		return m.TotalShards
+	}
+	return 0
+}
+
+func (m *SearchResult) GetSuccessfulShards() int32 {
+	if m != nil {
+		return m.SuccessfulShards
+	}
+	return 0
+}
+
+func (m *SearchResult) GetShardFailures() []*ShardFailure {
+	if m != nil {
+		return m.ShardFailures
+	}
+	return nil
+}
+
 type CountRequest struct {
+	Endpoints []string `protobuf:"bytes,1,rep,name=Endpoints,proto3" json:"Endpoints,omitempty"`
+	Shards    []string `protobuf:"bytes,2,rep,name=Shards,proto3" json:"Shards,omitempty"`
 }
 
 func (m *CountRequest) Reset()         { *m = CountRequest{} }
 func (m *CountRequest) String() string { return proto.CompactTextString(m) }
 func (*CountRequest) ProtoMessage()    {}
 func (*CountRequest) Descriptor() ([]byte, []int) {
-	return fileDescriptor_f750e0f7889345b5, []int{4}
+	return fileDescriptor_f750e0f7889345b5, []int{8}
 }
 func (m *CountRequest) XXX_Unmarshal(b []byte) error {
 	return m.Unmarshal(b)
@@ -263,72 +591,254 @@ func (m *CountRequest) XXX_DiscardUnknown() {
 
 var xxx_messageInfo_CountRequest proto.InternalMessageInfo
 
-func init() {
-	proto.RegisterType((*DocId)(nil), "index_service.DocId")
-	proto.RegisterType((*AffectedCount)(nil), "index_service.AffectedCount")
-	proto.RegisterType((*SearchRequest)(nil), "index_service.SearchRequest")
-	proto.RegisterType((*SearchResult)(nil), "index_service.SearchResult")
-	proto.RegisterType((*CountRequest)(nil), "index_service.CountRequest")
+func (m *CountRequest) GetEndpoints() []string {
+	if m != nil {
+		return m.Endpoints
+	}
+	return nil
 }
 
-func init() { proto.RegisterFile("index.proto", fileDescriptor_f750e0f7889345b5) }
+func (m *CountRequest) GetShards() []string {
+	if m != nil {
+		return m.Shards
+	}
+	return nil
+}
 
-var fileDescriptor_f750e0f7889345b5 = []byte{
-	// 363 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x84, 0x52, 0x4d, 0x4f, 0xea, 0x40,
-	0x14, 0x65, 0xf8, 0x28, 0xe1, 0x02, 0xef, 0x91, 0x09, 0x79, 0x69, 0xfa, 0xb4, 0x69, 0x9a, 0x68,
-	0x70, 0xd3, 0x05, 0x2e, 0x8c, 0x2b, 0x03, 0x34, 0x26, 0xac, 0x88, 0xc5, 0x3d, 0xc1, 0xf6, 0x56,
-	0x49, 0xa0, 0x03, 0xd3, 0xa9, 0x91, 0xb5, 0x7f, 0x40, 0xff, 0x95, 0x4b, 0x96, 0x2e, 0x0d, 0xfc,
-	0x11, 0xd3, 0x99, 0x92, 0x48, 0x13, 0x75, 0x77, 0xce, 0x3d, 0xe7, 0xa6, 0xe7, 0x9e, 0x0e, 0xd4,
-	0x67, 0x51, 0x80, 0x4f, 0xce, 0x92, 0x33, 0xc1, 0x68, 0x53, 0x92, 0x49, 0x8c, 0xfc, 0x71, 0xe6,
-	0xa3, 0x51, 0x0b, 0x98, 0xaf, 0x14, 0xa3, 0x25, 0x90, 0x2f, 0x26, 0xab, 0x04, 0xf9, 0x5a, 0x4d,
-	0xec, 0x63, 0xa8, 0xb8, 0xcc, 0x1f, 0x06, 0xb4, 0x9d, 0x01, 0x9d, 0x58, 0xa4, 0x53, 0xf3, 0x14,
-	0xb1, 0x4f, 0xa0, 0xd9, 0x0b, 0x43, 0xf4, 0x05, 0x06, 0x03, 0x96, 0x44, 0x22, 0xb5, 0x49, 0x20,
-	0x6d, 0x15, 0x4f, 0x11, 0xfb, 0x99, 0x40, 0x73, 0x8c, 0x53, 0xee, 0x3f, 0x78, 0xb8, 0x4a, 0x30,
-	0x16, 0xf4, 0x14, 0x2a, 0x37, 0xe9, 0x67, 0xa4, 0xaf, 0xde, 0x6d, 0x39, 0x62, 0xbd, 0xc4, 0xd8,
-	0xb9, 0x45, 0xbe, 0x90, 0x73, 0x4f, 0xc9, 0xf4, 0x1f, 0x68, 0xa3, 0xe8, 0x7a, 0x3e, 0xbd, 0xd7,
-	0x8b, 0x16, 0xe9, 0x94, 0xbd, 0x8c, 0x51, 0x1d, 0xaa, 0xa3, 0x30, 0x94, 0x42, 0x49, 0x0a, 0x7b,
-	0x2a, 0x15, 0x9e, 0xa2, 0x58, 0x2f, 0x5b, 0x25, 0xa9, 0x28, 0x6a, 0x5f, 0x42, 0x63, 0x1f, 0x22,
-	0x4e, 0xe6, 0x82, 0x9e, 0x41, 0x55, 0xa1, 0x58, 0x27, 0x56, 0xa9, 0x53, 0xef, 0xfe, 0xcd, 0x52,
-	0xb8, 0xcc, 0x4f, 0x16, 0x18, 0x09, 0x6f, 0xaf, 0xdb, 0x7f, 0xa0, 0x21, 0x2f, 0xc9, 0xe2, 0x77,
-	0x5f, 0x8b, 0xd0, 0x18, 0xa6, 0x2d, 0x8e, 0x55, 0x89, 0xf4, 0x0a, 0x6a, 0x2e, 0xce, 0x51, 0xa0,
-	0xcb, 0x7c, 0xda, 0x76, 0x0e, 0x1a, 0x76, 0x64, 0x57, 0xc6, 0x51, 0x6e, 0x7a, 0x58, 0xdc, 0x05,
-	0x68, 0xbd, 0x20, 0x48, 0xb7, 0xf3, 0x29, 0x7e, 0x59, 0x1c, 0x80, 0xa6, 0xae, 0xa2, 0x79, 0xdf,
-	0x41, 0xe3, 0xc6, 0xff, 0x6f, 0x54, 0x59, 0x45, 0x3f, 0xfb, 0x6d, 0x34, 0xef, 0xfa, 0x7a, 0xf5,
-	0xcf, 0x41, 0xfa, 0xfa, 0xdb, 0xd6, 0x24, 0x9b, 0xad, 0x49, 0x3e, 0xb6, 0x26, 0x79, 0xd9, 0x99,
-	0x85, 0xcd, 0xce, 0x2c, 0xbc, 0xef, 0xcc, 0xc2, 0x9d, 0x26, 0xdf, 0xd2, 0xf9, 0x67, 0x00, 0x00,
-	0x00, 0xff, 0xff, 0xb4, 0x84, 0x2a, 0x38, 0x86, 0x02, 0x00, 0x00,
+type ScanRequest struct {
+	Cursor    string   `protobuf:"bytes,1,opt,name=Cursor,proto3" json:"Cursor,omitempty"`
+	Limit     int32    `protobuf:"varint,2,opt,name=Limit,proto3" json:"Limit,omitempty"`
+	Endpoints []string `protobuf:"bytes,3,rep,name=Endpoints,proto3" json:"Endpoints,omitempty"`
+	Owner     string   `protobuf:"bytes,4,opt,name=Owner,proto3" json:"Owner,omitempty"`
+	Replicas  int32    `protobuf:"varint,5,opt,name=Replicas,proto3" json:"Replicas,omitempty"`
 }
 
-// Reference imports to suppress errors if they are not otherwise used.
-var _ context.Context
-var _ grpc.ClientConn
+func (m *ScanRequest) Reset()         { *m = ScanRequest{} }
+func (m *ScanRequest) String() string { return proto.CompactTextString(m) }
+func (*ScanRequest) ProtoMessage()    {}
+func (*ScanRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_f750e0f7889345b5, []int{9}
+}
+func (m *ScanRequest) XXX_Unmarshal(b []byte) error {
+	return m.Unmarshal(b)
+}
+func (m *ScanRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	if deterministic {
+		return xxx_messageInfo_ScanRequest.Marshal(b, m, deterministic)
+	} else {
+		b = b[:cap(b)]
+		n, err := m.MarshalToSizedBuffer(b)
+		if err != nil {
+			return nil, err
+		}
+		return b[:n], nil
+	}
+}
+func (m *ScanRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ScanRequest.Merge(m, src)
+}
+func (m *ScanRequest) XXX_Size() int {
+	return m.Size()
+}
+func (m *ScanRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_ScanRequest.DiscardUnknown(m)
+}
 
-// This is a compile-time assertion to ensure that this generated file
-// is compatible with the grpc package it is being compiled against.
-const _ = grpc.SupportPackageIsVersion4
+var xxx_messageInfo_ScanRequest proto.InternalMessageInfo
 
-// IndexServiceClient is the client API for IndexService service.
-//
-// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://godoc.org/google.golang.org/grpc#ClientConn.NewStream.
-type IndexServiceClient interface {
-	DeleteDoc(ctx context.Context, in *DocId, opts ...grpc.CallOption) (*AffectedCount, error)
-	AddDoc(ctx context.Context, in *types.Document, opts ...grpc.CallOption) (*AffectedCount, error)
-	Search(ctx context.Context, in *SearchRequest, opts ...grpc.CallOption) (*SearchResult, error)
-	Count(ctx context.Context, in *CountRequest, opts ...grpc.CallOption) (*AffectedCount, error)
+func (m *ScanRequest) GetCursor() string {
+	if m != nil {
+		return m.Cursor
+	}
+	return ""
 }
 
-type indexServiceClient struct {
-	cc *grpc.ClientConn
+func (m *ScanRequest) GetLimit() int32 {
+	if m != nil {
+		return m.Limit
+	}
+	return 0
 }
 
-func NewIndexServiceClient(cc *grpc.ClientConn) IndexServiceClient {
-	return &indexServiceClient{cc}
+func (m *ScanRequest) GetEndpoints() []string {
+	if m != nil {
+		return m.Endpoints
+	}
+	return nil
 }
 
-func (c *indexServiceClient) DeleteDoc(ctx context.Context, in *DocId, opts ...grpc.CallOption) (*AffectedCount, error) {
-	out := new(AffectedCount)
-	err := c.cc.Invoke(ctx, "/index_service.IndexService/DeleteDoc", in, out, opts...)
+func (m *ScanRequest) GetOwner() string {
+	if m != nil {
+		return m.Owner
+	}
+	return ""
+}
+
+func (m *ScanRequest) GetReplicas() int32 {
+	if m != nil {
+		return m.Replicas
+	}
+	return 0
+}
+
+type ScanResult struct {
+	Docs       []*types.Document `protobuf:"bytes,1,rep,name=Docs,proto3" json:"Docs,omitempty"`
+	NextCursor string            `protobuf:"bytes,2,opt,name=NextCursor,proto3" json:"NextCursor,omitempty"`
+}
+
+func (m *ScanResult) Reset()         { *m = ScanResult{} }
+func (m *ScanResult) String() string { return proto.CompactTextString(m) }
+func (*ScanResult) ProtoMessage()    {}
+func (*ScanResult) Descriptor() ([]byte, []int) {
+	return fileDescriptor_f750e0f7889345b5, []int{10}
+}
+func (m *ScanResult) XXX_Unmarshal(b []byte) error {
+	return m.Unmarshal(b)
+}
+func (m *ScanResult) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	if deterministic {
+		return xxx_messageInfo_ScanResult.Marshal(b, m, deterministic)
+	} else {
+		b = b[:cap(b)]
+		n, err := m.MarshalToSizedBuffer(b)
+		if err != nil {
+			return nil, err
+		}
+		return b[:n], nil
+	}
+}
+func (m *ScanResult) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ScanResult.Merge(m, src)
+}
+func (m *ScanResult) XXX_Size() int {
+	return m.Size()
+}
+func (m *ScanResult) XXX_DiscardUnknown() {
+	xxx_messageInfo_ScanResult.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ScanResult proto.InternalMessageInfo
+
+func (m *ScanResult) GetDocs() []*types.Document {
+	if m != nil {
+		return m.Docs
+	}
+	return nil
+}
+
+func (m *ScanResult) GetNextCursor() string {
+	if m != nil {
+		return m.NextCursor
+	}
+	return ""
+}
+
+func init() {
+	proto.RegisterEnum("index_service.SortBy", SortBy_name, SortBy_value)
+	proto.RegisterEnum("index_service.SortOrder", SortOrder_name, SortOrder_value)
+	proto.RegisterType((*DocId)(nil), "index_service.DocId")
+	proto.RegisterType((*DocIds)(nil), "index_service.DocIds")
+	proto.RegisterType((*Documents)(nil), "index_service.Documents")
+	proto.RegisterType((*AffectedCount)(nil), "index_service.AffectedCount")
+	proto.RegisterType((*SortSpec)(nil), "index_service.SortSpec")
+	proto.RegisterType((*SearchRequest)(nil), "index_service.SearchRequest")
+	proto.RegisterType((*ShardFailure)(nil), "index_service.ShardFailure")
+	proto.RegisterType((*SearchResult)(nil), "index_service.SearchResult")
+	proto.RegisterType((*CountRequest)(nil), "index_service.CountRequest")
+	proto.RegisterType((*ScanRequest)(nil), "index_service.ScanRequest")
+	proto.RegisterType((*ScanResult)(nil), "index_service.ScanResult")
+}
+
+func init() { proto.RegisterFile("index.proto", fileDescriptor_f750e0f7889345b5) }
+
+var fileDescriptor_f750e0f7889345b5 = []byte{
+	// 812 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x8c, 0x55, 0xcf, 0x6f, 0xe3, 0x44,
+	0x14, 0x8e, 0x1d, 0xc7, 0xa9, 0x5f, 0x5a, 0x88, 0x46, 0xdd, 0xc5, 0xb8, 0x4b, 0x14, 0x19, 0x2d,
+	0x2a, 0x5d, 0x29, 0xa0, 0x72, 0xe0, 0xc2, 0x0f, 0x25, 0x71, 0x0b, 0x95, 0x16, 0xc2, 0x8e, 0xcb,
+	0x79, 0x65, 0xec, 0xc9, 0xae, 0xa5, 0xc4, 0x93, 0x9d, 0x19, 0xc3, 0x86, 0x13, 0x27, 0x2e, 0x5c,
+	0x38, 0xf1, 0x37, 0x71, 0xdc, 0x23, 0x47, 0xd4, 0xfe, 0x23, 0x68, 0xde, 0xd8, 0x6d, 0xe2, 0x6d,
+	0xd8, 0xbd, 0xbd, 0xef, 0xbd, 0x37, 0x79, 0xf3, 0x7d, 0xdf, 0xf3, 0x04, 0x7a, 0x79, 0x91, 0xb1,
+	0x97, 0xa3, 0x95, 0xe0, 0x8a, 0x93, 0x03, 0x04, 0x4f, 0x25, 0x13, 0x3f, 0xe7, 0x29, 0x0b, 0xbc,
+	0x8c, 0xa7, 0xa6, 0x12, 0xf4, 0x15, 0x13, 0xcb, 0xa7, 0x2f, 0x4a, 0x26, 0xd6, 0x26, 0x13, 0x7e,
+	0x00, 0x9d, 0x88, 0xa7, 0x17, 0x19, 0x39, 0xac, 0x02, 0xdf, 0x1a, 0x5a, 0xc7, 0x1e, 0x35, 0x20,
+	0x1c, 0x82, 0x8b, 0x81, 0x24, 0xf7, 0xeb, 0xc8, 0xb7, 0x86, 0xed, 0x63, 0x8f, 0x56, 0x28, 0xfc,
+	0x14, 0xbc, 0x88, 0xa7, 0xe5, 0x92, 0x15, 0x4a, 0x92, 0x0f, 0xc1, 0x89, 0x78, 0x6a, 0x5a, 0x7a,
+	0xa7, 0xef, 0x8e, 0xd4, 0x7a, 0xc5, 0xe4, 0xa8, 0xae, 0x53, 0x2c, 0x86, 0x0f, 0xe1, 0x60, 0x3c,
+	0x9f, 0xb3, 0x54, 0xb1, 0x6c, 0xca, 0xcb, 0x42, 0xe9, 0xd1, 0x18, 0xe0, 0xe8, 0x0e, 0x35, 0x20,
+	0x4c, 0x60, 0x2f, 0xe6, 0x42, 0xc5, 0x2b, 0x96, 0x92, 0x87, 0x60, 0x4f, 0xd6, 0x58, 0x7e, 0xe7,
+	0xf4, 0xde, 0x68, 0x8b, 0xde, 0x48, 0x37, 0x4d, 0xd6, 0xd4, 0x9e, 0xac, 0xc9, 0x08, 0x3a, 0x33,
+	0x91, 0x31, 0xe1, 0xdb, 0xd8, 0xe9, 0xdf, 0xd1, 0x89, 0x75, 0x6a, 0xda, 0xc2, 0xbf, 0x6c, 0x38,
+	0x88, 0x59, 0x22, 0xd2, 0xe7, 0x94, 0xbd, 0x28, 0x99, 0x54, 0xe4, 0x23, 0xe8, 0x3c, 0xd1, 0xea,
+	0xe0, 0xac, 0xde, 0x69, 0xbf, 0x62, 0x70, 0xc9, 0xc4, 0x12, 0xf3, 0xd4, 0x94, 0xb5, 0x1a, 0xb3,
+	0xe2, 0x7c, 0x91, 0x3c, 0xc3, 0x51, 0x0e, 0xad, 0x10, 0xf1, 0xa1, 0x3b, 0x9b, 0xcf, 0xb1, 0xd0,
+	0xc6, 0x42, 0x0d, 0xb1, 0x22, 0x74, 0x24, 0x7d, 0x67, 0xd8, 0xc6, 0x8a, 0x81, 0x84, 0x80, 0x73,
+	0x2e, 0xf8, 0xd2, 0xef, 0x20, 0x7b, 0x8c, 0x49, 0x00, 0x7b, 0x3f, 0x24, 0xcf, 0x58, 0x9c, 0xff,
+	0xca, 0x7c, 0x17, 0xf3, 0x37, 0x98, 0x3c, 0x02, 0x47, 0x33, 0xf1, 0xbb, 0x28, 0xf2, 0x7b, 0x77,
+	0x90, 0xd4, 0x9a, 0x51, 0x6c, 0x22, 0x0f, 0xc0, 0x3b, 0x2b, 0xb2, 0x15, 0xcf, 0x0b, 0x25, 0xfd,
+	0x3d, 0x74, 0xee, 0x36, 0xa1, 0x69, 0xc4, 0xcf, 0x13, 0x91, 0x49, 0xdf, 0x33, 0xa6, 0x1a, 0x14,
+	0x7e, 0x01, 0xfb, 0x18, 0x9d, 0x27, 0xf9, 0xa2, 0x14, 0x4c, 0x3b, 0x84, 0xb8, 0x5e, 0x0e, 0x04,
+	0xfa, 0x34, 0x65, 0x89, 0xe4, 0x05, 0x8a, 0xe0, 0xd1, 0x0a, 0x85, 0xbf, 0xd9, 0xb0, 0x5f, 0xcb,
+	0x2a, 0xcb, 0x85, 0x22, 0x1f, 0x43, 0xd7, 0x44, 0x3b, 0x37, 0xa3, 0xae, 0xe3, 0x8d, 0x52, 0x2e,
+	0x98, 0xf4, 0xed, 0x61, 0xfb, 0xd8, 0xa2, 0x15, 0xd2, 0x3c, 0x2e, 0xb9, 0x4a, 0x16, 0xdf, 0xe6,
+	0x4a, 0xa2, 0xb4, 0x6d, 0x7a, 0x9b, 0x20, 0x43, 0xe8, 0x21, 0xa8, 0xc8, 0x38, 0xa8, 0xd8, 0x66,
+	0x8a, 0x9c, 0x40, 0x3f, 0x2e, 0xd3, 0x94, 0x49, 0x39, 0x2f, 0xeb, 0x36, 0x23, 0xf8, 0x6b, 0x79,
+	0x32, 0x86, 0x83, 0x4d, 0xf6, 0xd2, 0x77, 0xf1, 0xd2, 0x47, 0x4d, 0xa5, 0x37, 0x7a, 0xe8, 0xf6,
+	0x89, 0x30, 0x82, 0x7d, 0xdc, 0xe2, 0x7a, 0xaf, 0xb6, 0x6c, 0xb0, 0x76, 0xdb, 0x60, 0x6f, 0xd9,
+	0xf0, 0x87, 0x05, 0xbd, 0x38, 0x4d, 0x8a, 0xfa, 0x57, 0xee, 0x83, 0x3b, 0x2d, 0x85, 0xe4, 0xa2,
+	0xf2, 0xa1, 0x42, 0xda, 0x9e, 0xc7, 0xf9, 0x32, 0x57, 0xe8, 0x43, 0x87, 0x1a, 0xb0, 0x3d, 0xb3,
+	0xdd, 0x9c, 0x79, 0x08, 0x9d, 0xd9, 0x2f, 0x05, 0x13, 0x28, 0x96, 0x47, 0x0d, 0xd0, 0x7b, 0x47,
+	0xd9, 0x6a, 0x91, 0xa7, 0x49, 0x2d, 0xcf, 0x0d, 0x0e, 0x9f, 0x00, 0x98, 0xcb, 0xa0, 0xa7, 0x6f,
+	0xf3, 0xa9, 0x93, 0x01, 0xc0, 0xf7, 0xec, 0xa5, 0xaa, 0x2e, 0x6d, 0xb6, 0x64, 0x23, 0x73, 0x72,
+	0x04, 0xae, 0xf9, 0x7c, 0x89, 0x07, 0x9d, 0x78, 0x3a, 0xa3, 0x67, 0xfd, 0x16, 0x71, 0xc1, 0xbe,
+	0x88, 0xfa, 0xd6, 0xc9, 0x23, 0xf0, 0x6e, 0xbe, 0x58, 0xd2, 0x83, 0x6e, 0x74, 0x76, 0x3e, 0xfe,
+	0xf1, 0xf1, 0x65, 0xbf, 0x45, 0xba, 0xd0, 0x1e, 0xc7, 0xd3, 0xbe, 0x45, 0xf6, 0xc0, 0x89, 0xce,
+	0xe2, 0x69, 0xdf, 0x3e, 0xfd, 0xdd, 0x81, 0xfd, 0x0b, 0x6d, 0x4f, 0x6c, 0xdc, 0x21, 0x5f, 0x83,
+	0x17, 0xb1, 0x05, 0x53, 0x2c, 0xe2, 0x29, 0x39, 0x6c, 0x58, 0x87, 0x6f, 0x57, 0xf0, 0xa0, 0x91,
+	0xdd, 0x7e, 0x95, 0x3e, 0x07, 0x77, 0x9c, 0x65, 0xfa, 0x74, 0x93, 0xdc, 0x1b, 0x0e, 0x4e, 0xc1,
+	0x35, 0xdb, 0x4f, 0x9a, 0x7d, 0x5b, 0x6f, 0x4d, 0x70, 0xb4, 0xa3, 0x8a, 0xf2, 0x4e, 0xaa, 0x37,
+	0x91, 0x34, 0xbb, 0x36, 0xd7, 0xea, 0x0d, 0x17, 0xf9, 0x04, 0xdc, 0x6f, 0x98, 0xda, 0xcd, 0xbf,
+	0xc9, 0x8b, 0x7c, 0x05, 0xbd, 0xef, 0xca, 0x85, 0xca, 0xab, 0x53, 0xf7, 0xee, 0x3a, 0x25, 0x03,
+	0xff, 0xf5, 0x74, 0xf5, 0xfc, 0x7f, 0x09, 0x8e, 0xde, 0x10, 0x12, 0x34, 0x99, 0xdd, 0xee, 0x70,
+	0xf0, 0xfe, 0x9d, 0x35, 0xe4, 0x3c, 0x05, 0xef, 0x62, 0xb9, 0xe2, 0x02, 0x87, 0xef, 0x9c, 0xf2,
+	0xff, 0xa4, 0x27, 0xfe, 0xdf, 0x57, 0x03, 0xeb, 0xd5, 0xd5, 0xc0, 0xfa, 0xf7, 0x6a, 0x60, 0xfd,
+	0x79, 0x3d, 0x68, 0xbd, 0xba, 0x1e, 0xb4, 0xfe, 0xb9, 0x1e, 0xb4, 0x7e, 0x72, 0xf1, 0x1f, 0xef,
+	0xb3, 0xff, 0x06, 0x00, 0x1e, 0x57, 0x53, 0x9d, 0x2c, 0x07, 0x00, 0x00,
+}
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ context.Context
+var _ grpc.ClientConn
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+const _ = grpc.SupportPackageIsVersion4
+
+// IndexServiceClient is the client API for IndexService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://godoc.org/google.golang.org/grpc#ClientConn.NewStream.
+type IndexServiceClient interface {
+	DeleteDoc(ctx context.Context, in *DocId, opts ...grpc.CallOption) (*AffectedCount, error)
+	AddDoc(ctx context.Context, in *types.Document, opts ...grpc.CallOption) (*AffectedCount, error)
+	Search(ctx context.Context, in *SearchRequest, opts ...grpc.CallOption) (*SearchResult, error)
+	Count(ctx context.Context, in *CountRequest, opts ...grpc.CallOption) (*AffectedCount, error)
+	GetDoc(ctx context.Context, in *DocId, opts ...grpc.CallOption) (*types.Document, error)
+	MultiGetDoc(ctx context.Context, in *DocIds, opts ...grpc.CallOption) (*Documents, error)
+	Scan(ctx context.Context, in *ScanRequest, opts ...grpc.CallOption) (*ScanResult, error)
+	ImportDoc(ctx context.Context, in *Documents, opts ...grpc.CallOption) (*AffectedCount, error)
+}
+
+type indexServiceClient struct {
+	cc *grpc.ClientConn
+}
+
+func NewIndexServiceClient(cc *grpc.ClientConn) IndexServiceClient {
+	return &indexServiceClient{cc}
+}
+
+func (c *indexServiceClient) DeleteDoc(ctx context.Context, in *DocId, opts ...grpc.CallOption) (*AffectedCount, error) {
+	out := new(AffectedCount)
+	err := c.cc.Invoke(ctx, "/index_service.IndexService/DeleteDoc", in, out, opts...)
 	if err != nil {
 		return nil, err
 	}
@@ -362,12 +872,52 @@ func (c *indexServiceClient) Count(ctx context.Context, in *CountRequest, opts .
 	return out, nil
 }
 
+func (c *indexServiceClient) GetDoc(ctx context.Context, in *DocId, opts ...grpc.CallOption) (*types.Document, error) {
+	out := new(types.Document)
+	err := c.cc.Invoke(ctx, "/index_service.IndexService/GetDoc", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *indexServiceClient) MultiGetDoc(ctx context.Context, in *DocIds, opts ...grpc.CallOption) (*Documents, error) {
+	out := new(Documents)
+	err := c.cc.Invoke(ctx, "/index_service.IndexService/MultiGetDoc", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *indexServiceClient) Scan(ctx context.Context, in *ScanRequest, opts ...grpc.CallOption) (*ScanResult, error) {
+	out := new(ScanResult)
+	err := c.cc.Invoke(ctx, "/index_service.IndexService/Scan", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *indexServiceClient) ImportDoc(ctx context.Context, in *Documents, opts ...grpc.CallOption) (*AffectedCount, error) {
+	out := new(AffectedCount)
+	err := c.cc.Invoke(ctx, "/index_service.IndexService/ImportDoc", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // IndexServiceServer is the server API for IndexService service.
 type IndexServiceServer interface {
 	DeleteDoc(context.Context, *DocId) (*AffectedCount, error)
 	AddDoc(context.Context, *types.Document) (*AffectedCount, error)
 	Search(context.Context, *SearchRequest) (*SearchResult, error)
 	Count(context.Context, *CountRequest) (*AffectedCount, error)
+	GetDoc(context.Context, *DocId) (*types.Document, error)
+	MultiGetDoc(context.Context, *DocIds) (*Documents, error)
+	Scan(context.Context, *ScanRequest) (*ScanResult, error)
+	ImportDoc(context.Context, *Documents) (*AffectedCount, error)
 }
 
 // UnimplementedIndexServiceServer can be embedded to have forward compatible implementations.
@@ -386,6 +936,18 @@ func (*UnimplementedIndexServiceServer) Search(ctx context.Context, req *SearchR
 func (*UnimplementedIndexServiceServer) Count(ctx context.Context, req *CountRequest) (*AffectedCount, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method Count not implemented")
 }
+func (*UnimplementedIndexServiceServer) GetDoc(ctx context.Context, req *DocId) (*types.Document, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetDoc not implemented")
+}
+func (*UnimplementedIndexServiceServer) MultiGetDoc(ctx context.Context, req *DocIds) (*Documents, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method MultiGetDoc not implemented")
+}
+func (*UnimplementedIndexServiceServer) Scan(ctx context.Context, req *ScanRequest) (*ScanResult, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Scan not implemented")
+}
+func (*UnimplementedIndexServiceServer) ImportDoc(ctx context.Context, req *Documents) (*AffectedCount, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ImportDoc not implemented")
+}
 
 func RegisterIndexServiceServer(s *grpc.Server, srv IndexServiceServer) {
 	s.RegisterService(&_IndexService_serviceDesc, srv)
@@ -463,6 +1025,78 @@ func _IndexService_Count_Handler(srv interface{}, ctx context.Context, dec func(
 	return interceptor(ctx, in, info, handler)
 }
 
+func _IndexService_GetDoc_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DocId)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(IndexServiceServer).GetDoc(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/index_service.IndexService/GetDoc",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(IndexServiceServer).GetDoc(ctx, req.(*DocId))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _IndexService_MultiGetDoc_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DocIds)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(IndexServiceServer).MultiGetDoc(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/index_service.IndexService/MultiGetDoc",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(IndexServiceServer).MultiGetDoc(ctx, req.(*DocIds))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _IndexService_Scan_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ScanRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(IndexServiceServer).Scan(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/index_service.IndexService/Scan",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(IndexServiceServer).Scan(ctx, req.(*ScanRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _IndexService_ImportDoc_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Documents)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(IndexServiceServer).ImportDoc(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/index_service.IndexService/ImportDoc",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(IndexServiceServer).ImportDoc(ctx, req.(*Documents))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 var _IndexService_serviceDesc = grpc.ServiceDesc{
 	ServiceName: "index_service.IndexService",
 	HandlerType: (*IndexServiceServer)(nil),
@@ -483,6 +1117,22 @@ var _IndexService_serviceDesc = grpc.ServiceDesc{
 			MethodName: "Count",
 			Handler:    _IndexService_Count_Handler,
 		},
+		{
+			MethodName: "GetDoc",
+			Handler:    _IndexService_GetDoc_Handler,
+		},
+		{
+			MethodName: "MultiGetDoc",
+			Handler:    _IndexService_MultiGetDoc_Handler,
+		},
+		{
+			MethodName: "Scan",
+			Handler:    _IndexService_Scan_Handler,
+		},
+		{
+			MethodName: "ImportDoc",
+			Handler:    _IndexService_ImportDoc_Handler,
+		},
 	},
 	Streams:  []grpc.StreamDesc{},
 	Metadata: "index.proto",
@@ -518,7 +1168,7 @@ func (m *DocId) MarshalToSizedBuffer(dAtA []byte) (int, error) {
 	return len(dAtA) - i, nil
 }
 
-func (m *AffectedCount) Marshal() (dAtA []byte, err error) {
+func (m *DocIds) Marshal() (dAtA []byte, err error) {
 	size := m.Size()
 	dAtA = make([]byte, size)
 	n, err := m.MarshalToSizedBuffer(dAtA[:size])
@@ -528,25 +1178,29 @@ func (m *AffectedCount) Marshal() (dAtA []byte, err error) {
 	return dAtA[:n], nil
 }
 
-func (m *AffectedCount) MarshalTo(dAtA []byte) (int, error) {
+func (m *DocIds) MarshalTo(dAtA []byte) (int, error) {
 	size := m.Size()
 	return m.MarshalToSizedBuffer(dAtA[:size])
 }
 
-func (m *AffectedCount) MarshalToSizedBuffer(dAtA []byte) (int, error) {
+func (m *DocIds) MarshalToSizedBuffer(dAtA []byte) (int, error) {
 	i := len(dAtA)
 	_ = i
 	var l int
 	_ = l
-	if m.Count != 0 {
-		i = encodeVarintIndex(dAtA, i, uint64(m.Count))
-		i--
-		dAtA[i] = 0x8
+	if len(m.DocIds) > 0 {
+		for iNdEx := len(m.DocIds) - 1; iNdEx >= 0; iNdEx-- {
+			i -= len(m.DocIds[iNdEx])
+			copy(dAtA[i:], m.DocIds[iNdEx])
+			i = encodeVarintIndex(dAtA, i, uint64(len(m.DocIds[iNdEx])))
+			i--
+			dAtA[i] = 0xa
+		}
 	}
 	return len(dAtA) - i, nil
 }
 
-func (m *SearchRequest) Marshal() (dAtA []byte, err error) {
+func (m *Documents) Marshal() (dAtA []byte, err error) {
 	size := m.Size()
 	dAtA = make([]byte, size)
 	n, err := m.MarshalToSizedBuffer(dAtA[:size])
@@ -556,60 +1210,34 @@ func (m *SearchRequest) Marshal() (dAtA []byte, err error) {
 	return dAtA[:n], nil
 }
 
-func (m *SearchRequest) MarshalTo(dAtA []byte) (int, error) {
+func (m *Documents) MarshalTo(dAtA []byte) (int, error) {
 	size := m.Size()
 	return m.MarshalToSizedBuffer(dAtA[:size])
 }
 
-func (m *SearchRequest) MarshalToSizedBuffer(dAtA []byte) (int, error) {
+func (m *Documents) MarshalToSizedBuffer(dAtA []byte) (int, error) {
 	i := len(dAtA)
 	_ = i
 	var l int
 	_ = l
-	if len(m.OrFlags) > 0 {
-		dAtA2 := make([]byte, len(m.OrFlags)*10)
-		var j1 int
-		for _, num := range m.OrFlags {
-			for num >= 1<<7 {
-				dAtA2[j1] = uint8(uint64(num)&0x7f | 0x80)
-				num >>= 7
-				j1++
-			}
-			dAtA2[j1] = uint8(num)
-			j1++
-		}
-		i -= j1
-		copy(dAtA[i:], dAtA2[:j1])
-		i = encodeVarintIndex(dAtA, i, uint64(j1))
-		i--
-		dAtA[i] = 0x22
-	}
-	if m.OffFlag != 0 {
-		i = encodeVarintIndex(dAtA, i, uint64(m.OffFlag))
-		i--
-		dAtA[i] = 0x18
-	}
-	if m.OnFlag != 0 {
-		i = encodeVarintIndex(dAtA, i, uint64(m.OnFlag))
-		i--
-		dAtA[i] = 0x10
-	}
-	if m.Query != nil {
-		{
-			size, err := m.Query.MarshalToSizedBuffer(dAtA[:i])
-			if err != nil {
-				return 0, err
+	if len(m.Docs) > 0 {
+		for iNdEx := len(m.Docs) - 1; iNdEx >= 0; iNdEx-- {
+			{
+				size, err := m.Docs[iNdEx].MarshalToSizedBuffer(dAtA[:i])
+				if err != nil {
+					return 0, err
+				}
+				i -= size
+				i = encodeVarintIndex(dAtA, i, uint64(size))
 			}
-			i -= size
-			i = encodeVarintIndex(dAtA, i, uint64(size))
+			i--
+			dAtA[i] = 0xa
 		}
-		i--
-		dAtA[i] = 0xa
 	}
 	return len(dAtA) - i, nil
 }
 
-func (m *SearchResult) Marshal() (dAtA []byte, err error) {
+func (m *AffectedCount) Marshal() (dAtA []byte, err error) {
 	size := m.Size()
 	dAtA = make([]byte, size)
 	n, err := m.MarshalToSizedBuffer(dAtA[:size])
@@ -619,34 +1247,25 @@ func (m *SearchResult) Marshal() (dAtA []byte, err error) {
 	return dAtA[:n], nil
 }
 
-func (m *SearchResult) MarshalTo(dAtA []byte) (int, error) {
+func (m *AffectedCount) MarshalTo(dAtA []byte) (int, error) {
 	size := m.Size()
 	return m.MarshalToSizedBuffer(dAtA[:size])
 }
 
-func (m *SearchResult) MarshalToSizedBuffer(dAtA []byte) (int, error) {
+func (m *AffectedCount) MarshalToSizedBuffer(dAtA []byte) (int, error) {
 	i := len(dAtA)
 	_ = i
 	var l int
 	_ = l
-	if len(m.Results) > 0 {
-		for iNdEx := len(m.Results) - 1; iNdEx >= 0; iNdEx-- {
-			{
-				size, err := m.Results[iNdEx].MarshalToSizedBuffer(dAtA[:i])
-				if err != nil {
-					return 0, err
-				}
-				i -= size
-				i = encodeVarintIndex(dAtA, i, uint64(size))
-			}
-			i--
-			dAtA[i] = 0xa
-		}
+	if m.Count != 0 {
+		i = encodeVarintIndex(dAtA, i, uint64(m.Count))
+		i--
+		dAtA[i] = 0x8
 	}
 	return len(dAtA) - i, nil
 }
 
-func (m *CountRequest) Marshal() (dAtA []byte, err error) {
+func (m *SortSpec) Marshal() (dAtA []byte, err error) {
 	size := m.Size()
 	dAtA = make([]byte, size)
 	n, err := m.MarshalToSizedBuffer(dAtA[:size])
@@ -656,112 +1275,1500 @@ func (m *CountRequest) Marshal() (dAtA []byte, err error) {
 	return dAtA[:n], nil
 }
 
-func (m *CountRequest) MarshalTo(dAtA []byte) (int, error) {
+func (m *SortSpec) MarshalTo(dAtA []byte) (int, error) {
 	size := m.Size()
 	return m.MarshalToSizedBuffer(dAtA[:size])
 }
 
-func (m *CountRequest) MarshalToSizedBuffer(dAtA []byte) (int, error) {
+func (m *SortSpec) MarshalToSizedBuffer(dAtA []byte) (int, error) {
 	i := len(dAtA)
 	_ = i
 	var l int
 	_ = l
+	if m.Order != 0 {
+		i = encodeVarintIndex(dAtA, i, uint64(m.Order))
+		i--
+		dAtA[i] = 0x10
+	}
+	if m.By != 0 {
+		i = encodeVarintIndex(dAtA, i, uint64(m.By))
+		i--
+		dAtA[i] = 0x8
+	}
 	return len(dAtA) - i, nil
 }
 
-func encodeVarintIndex(dAtA []byte, offset int, v uint64) int {
-	offset -= sovIndex(v)
-	base := offset
-	for v >= 1<<7 {
-		dAtA[offset] = uint8(v&0x7f | 0x80)
-		v >>= 7
-		offset++
+func (m *SearchRequest) Marshal() (dAtA []byte, err error) {
+	size := m.Size()
+	dAtA = make([]byte, size)
+	n, err := m.MarshalToSizedBuffer(dAtA[:size])
+	if err != nil {
+		return nil, err
 	}
-	dAtA[offset] = uint8(v)
-	return base
+	return dAtA[:n], nil
 }
-func (m *DocId) Size() (n int) {
-	if m == nil {
-		return 0
-	}
+
+func (m *SearchRequest) MarshalTo(dAtA []byte) (int, error) {
+	size := m.Size()
+	return m.MarshalToSizedBuffer(dAtA[:size])
+}
+
+func (m *SearchRequest) MarshalToSizedBuffer(dAtA []byte) (int, error) {
+	i := len(dAtA)
+	_ = i
 	var l int
 	_ = l
-	l = len(m.DocId)
-	if l > 0 {
-		n += 1 + l + sovIndex(uint64(l))
+	if len(m.Shards) > 0 {
+		for iNdEx := len(m.Shards) - 1; iNdEx >= 0; iNdEx-- {
+			i -= len(m.Shards[iNdEx])
+			copy(dAtA[i:], m.Shards[iNdEx])
+			i = encodeVarintIndex(dAtA, i, uint64(len(m.Shards[iNdEx])))
+			i--
+			dAtA[i] = 0x4a
+		}
 	}
-	return n
+	if len(m.Endpoints) > 0 {
+		for iNdEx := len(m.Endpoints) - 1; iNdEx >= 0; iNdEx-- {
+			i -= len(m.Endpoints[iNdEx])
+			copy(dAtA[i:], m.Endpoints[iNdEx])
+			i = encodeVarintIndex(dAtA, i, uint64(len(m.Endpoints[iNdEx])))
+			i--
+			dAtA[i] = 0x42
+		}
+	}
+	if len(m.Sort) > 0 {
+		for iNdEx := len(m.Sort) - 1; iNdEx >= 0; iNdEx-- {
+			{
+				size, err := m.Sort[iNdEx].MarshalToSizedBuffer(dAtA[:i])
+				if err != nil {
+					return 0, err
+				}
+				i -= size
+				i = encodeVarintIndex(dAtA, i, uint64(size))
+			}
+			i--
+			dAtA[i] = 0x3a
+		}
+	}
+	if m.PageSize != 0 {
+		i = encodeVarintIndex(dAtA, i, uint64(m.PageSize))
+		i--
+		dAtA[i] = 0x30
+	}
+	if m.From != 0 {
+		i = encodeVarintIndex(dAtA, i, uint64(m.From))
+		i--
+		dAtA[i] = 0x28
+	}
+	if len(m.OrFlags) > 0 {
+		dAtA2 := make([]byte, len(m.OrFlags)*10)
+		var j1 int
+		for _, num := range m.OrFlags {
+			for num >= 1<<7 {
+				dAtA2[j1] = uint8(uint64(num)&0x7f | 0x80)
+				num >>= 7
+				j1++
+			}
+			dAtA2[j1] = uint8(num)
+			j1++
+		}
+		i -= j1
+		copy(dAtA[i:], dAtA2[:j1])
+		i = encodeVarintIndex(dAtA, i, uint64(j1))
+		i--
+		dAtA[i] = 0x22
+	}
+	if m.OffFlag != 0 {
+		i = encodeVarintIndex(dAtA, i, uint64(m.OffFlag))
+		i--
+		dAtA[i] = 0x18
+	}
+	if m.OnFlag != 0 {
+		i = encodeVarintIndex(dAtA, i, uint64(m.OnFlag))
+		i--
+		dAtA[i] = 0x10
+	}
+	if m.Query != nil {
+		{
+			size, err := m.Query.MarshalToSizedBuffer(dAtA[:i])
+			if err != nil {
+				return 0, err
+			}
+			i -= size
+			i = encodeVarintIndex(dAtA, i, uint64(size))
+		}
+		i--
+		dAtA[i] = 0xa
+	}
+	return len(dAtA) - i, nil
 }
 
-func (m *AffectedCount) Size() (n int) {
-	if m == nil {
-		return 0
+func (m *ShardFailure) Marshal() (dAtA []byte, err error) {
+	size := m.Size()
+	dAtA = make([]byte, size)
+	n, err := m.MarshalToSizedBuffer(dAtA[:size])
+	if err != nil {
+		return nil, err
 	}
+	return dAtA[:n], nil
+}
+
+func (m *ShardFailure) MarshalTo(dAtA []byte) (int, error) {
+	size := m.Size()
+	return m.MarshalToSizedBuffer(dAtA[:size])
+}
+
+func (m *ShardFailure) MarshalToSizedBuffer(dAtA []byte) (int, error) {
+	i := len(dAtA)
+	_ = i
 	var l int
 	_ = l
-	if m.Count != 0 {
-		n += 1 + sovIndex(uint64(m.Count))
+	if len(m.Reason) > 0 {
+		i -= len(m.Reason)
+		copy(dAtA[i:], m.Reason)
+		i = encodeVarintIndex(dAtA, i, uint64(len(m.Reason)))
+		i--
+		dAtA[i] = 0x12
 	}
-	return n
+	if len(m.Shard) > 0 {
+		i -= len(m.Shard)
+		copy(dAtA[i:], m.Shard)
+		i = encodeVarintIndex(dAtA, i, uint64(len(m.Shard)))
+		i--
+		dAtA[i] = 0xa
+	}
+	return len(dAtA) - i, nil
 }
 
-func (m *SearchRequest) Size() (n int) {
-	if m == nil {
-		return 0
+func (m *SearchResult) Marshal() (dAtA []byte, err error) {
+	size := m.Size()
+	dAtA = make([]byte, size)
+	n, err := m.MarshalToSizedBuffer(dAtA[:size])
+	if err != nil {
+		return nil, err
 	}
+	return dAtA[:n], nil
+}
+
+func (m *SearchResult) MarshalTo(dAtA []byte) (int, error) {
+	size := m.Size()
+	return m.MarshalToSizedBuffer(dAtA[:size])
+}
+
+func (m *SearchResult) MarshalToSizedBuffer(dAtA []byte) (int, error) {
+	i := len(dAtA)
+	_ = i
 	var l int
 	_ = l
-	if m.Query != nil {
-		l = m.Query.Size()
-		n += 1 + l + sovIndex(uint64(l))
+	if len(m.ShardFailures) > 0 {
+		for iNdEx := len(m.ShardFailures) - 1; iNdEx >= 0; iNdEx-- {
+			{
+				size, err := m.ShardFailures[iNdEx].MarshalToSizedBuffer(dAtA[:i])
+				if err != nil {
+					return 0, err
+				}
+				i -= size
+				i = encodeVarintIndex(dAtA, i, uint64(size))
+			}
+			i--
+			dAtA[i] = 0x32
+		}
 	}
-	if m.OnFlag != 0 {
-		n += 1 + sovIndex(uint64(m.OnFlag))
+	if m.SuccessfulShards != 0 {
+		i = encodeVarintIndex(dAtA, i, uint64(m.SuccessfulShards))
+		i--
+		dAtA[i] = 0x28
 	}
-	if m.OffFlag != 0 {
-		n += 1 + sovIndex(uint64(m.OffFlag))
+	if m.TotalShards != 0 {
+		i = encodeVarintIndex(dAtA, i, uint64(m.TotalShards))
+		i--
+		dAtA[i] = 0x20
 	}
-	if len(m.OrFlags) > 0 {
-		l = 0
-		for _, e := range m.OrFlags {
-			l += sovIndex(uint64(e))
+	if m.TotalHits != 0 {
+		i = encodeVarintIndex(dAtA, i, uint64(m.TotalHits))
+		i--
+		dAtA[i] = 0x18
+	}
+	if len(m.Scores) > 0 {
+		for iNdEx := len(m.Scores) - 1; iNdEx >= 0; iNdEx-- {
+			f4 := math.Float64bits(float64(m.Scores[iNdEx]))
+			i -= 8
+			encoding_binary.LittleEndian.PutUint64(dAtA[i:], uint64(f4))
 		}
-		n += 1 + sovIndex(uint64(l)) + l
+		i = encodeVarintIndex(dAtA, i, uint64(len(m.Scores)*8))
+		i--
+		dAtA[i] = 0x12
 	}
-	return n
+	if len(m.Results) > 0 {
+		for iNdEx := len(m.Results) - 1; iNdEx >= 0; iNdEx-- {
+			{
+				size, err := m.Results[iNdEx].MarshalToSizedBuffer(dAtA[:i])
+				if err != nil {
+					return 0, err
+				}
+				i -= size
+				i = encodeVarintIndex(dAtA, i, uint64(size))
+			}
+			i--
+			dAtA[i] = 0xa
+		}
+	}
+	return len(dAtA) - i, nil
 }
 
-func (m *SearchResult) Size() (n int) {
-	if m == nil {
-		return 0
+func (m *CountRequest) Marshal() (dAtA []byte, err error) {
+	size := m.Size()
+	dAtA = make([]byte, size)
+	n, err := m.MarshalToSizedBuffer(dAtA[:size])
+	if err != nil {
+		return nil, err
 	}
+	return dAtA[:n], nil
+}
+
+func (m *CountRequest) MarshalTo(dAtA []byte) (int, error) {
+	size := m.Size()
+	return m.MarshalToSizedBuffer(dAtA[:size])
+}
+
+func (m *CountRequest) MarshalToSizedBuffer(dAtA []byte) (int, error) {
+	i := len(dAtA)
+	_ = i
 	var l int
 	_ = l
-	if len(m.Results) > 0 {
-		for _, e := range m.Results {
-			l = e.Size()
-			n += 1 + l + sovIndex(uint64(l))
+	if len(m.Shards) > 0 {
+		for iNdEx := len(m.Shards) - 1; iNdEx >= 0; iNdEx-- {
+			i -= len(m.Shards[iNdEx])
+			copy(dAtA[i:], m.Shards[iNdEx])
+			i = encodeVarintIndex(dAtA, i, uint64(len(m.Shards[iNdEx])))
+			i--
+			dAtA[i] = 0x12
+		}
+	}
+	if len(m.Endpoints) > 0 {
+		for iNdEx := len(m.Endpoints) - 1; iNdEx >= 0; iNdEx-- {
+			i -= len(m.Endpoints[iNdEx])
+			copy(dAtA[i:], m.Endpoints[iNdEx])
+			i = encodeVarintIndex(dAtA, i, uint64(len(m.Endpoints[iNdEx])))
+			i--
+			dAtA[i] = 0xa
+		}
+	}
+	return len(dAtA) - i, nil
+}
+
+func (m *ScanRequest) Marshal() (dAtA []byte, err error) {
+	size := m.Size()
+	dAtA = make([]byte, size)
+	n, err := m.MarshalToSizedBuffer(dAtA[:size])
+	if err != nil {
+		return nil, err
+	}
+	return dAtA[:n], nil
+}
+
+func (m *ScanRequest) MarshalTo(dAtA []byte) (int, error) {
+	size := m.Size()
+	return m.MarshalToSizedBuffer(dAtA[:size])
+}
+
+func (m *ScanRequest) MarshalToSizedBuffer(dAtA []byte) (int, error) {
+	i := len(dAtA)
+	_ = i
+	var l int
+	_ = l
+	if m.Replicas != 0 {
+		i = encodeVarintIndex(dAtA, i, uint64(m.Replicas))
+		i--
+		dAtA[i] = 0x28
+	}
+	if len(m.Owner) > 0 {
+		i -= len(m.Owner)
+		copy(dAtA[i:], m.Owner)
+		i = encodeVarintIndex(dAtA, i, uint64(len(m.Owner)))
+		i--
+		dAtA[i] = 0x22
+	}
+	if len(m.Endpoints) > 0 {
+		for iNdEx := len(m.Endpoints) - 1; iNdEx >= 0; iNdEx-- {
+			i -= len(m.Endpoints[iNdEx])
+			copy(dAtA[i:], m.Endpoints[iNdEx])
+			i = encodeVarintIndex(dAtA, i, uint64(len(m.Endpoints[iNdEx])))
+			i--
+			dAtA[i] = 0x1a
+		}
+	}
+	if m.Limit != 0 {
+		i = encodeVarintIndex(dAtA, i, uint64(m.Limit))
+		i--
+		dAtA[i] = 0x10
+	}
+	if len(m.Cursor) > 0 {
+		i -= len(m.Cursor)
+		copy(dAtA[i:], m.Cursor)
+		i = encodeVarintIndex(dAtA, i, uint64(len(m.Cursor)))
+		i--
+		dAtA[i] = 0xa
+	}
+	return len(dAtA) - i, nil
+}
+
+func (m *ScanResult) Marshal() (dAtA []byte, err error) {
+	size := m.Size()
+	dAtA = make([]byte, size)
+	n, err := m.MarshalToSizedBuffer(dAtA[:size])
+	if err != nil {
+		return nil, err
+	}
+	return dAtA[:n], nil
+}
+
+func (m *ScanResult) MarshalTo(dAtA []byte) (int, error) {
+	size := m.Size()
+	return m.MarshalToSizedBuffer(dAtA[:size])
+}
+
+func (m *ScanResult) MarshalToSizedBuffer(dAtA []byte) (int, error) {
+	i := len(dAtA)
+	_ = i
+	var l int
+	_ = l
+	if len(m.NextCursor) > 0 {
+		i -= len(m.NextCursor)
+		copy(dAtA[i:], m.NextCursor)
+		i = encodeVarintIndex(dAtA, i, uint64(len(m.NextCursor)))
+		i--
+		dAtA[i] = 0x12
+	}
+	if len(m.Docs) > 0 {
+		for iNdEx := len(m.Docs) - 1; iNdEx >= 0; iNdEx-- {
+			{
+				size, err := m.Docs[iNdEx].MarshalToSizedBuffer(dAtA[:i])
+				if err != nil {
+					return 0, err
+				}
+				i -= size
+				i = encodeVarintIndex(dAtA, i, uint64(size))
+			}
+			i--
+			dAtA[i] = 0xa
+		}
+	}
+	return len(dAtA) - i, nil
+}
+
+func encodeVarintIndex(dAtA []byte, offset int, v uint64) int {
+	offset -= sovIndex(v)
+	base := offset
+	for v >= 1<<7 {
+		dAtA[offset] = uint8(v&0x7f | 0x80)
+		v >>= 7
+		offset++
+	}
+	dAtA[offset] = uint8(v)
+	return base
+}
+func (m *DocId) Size() (n int) {
+	if m == nil {
+		return 0
+	}
+	var l int
+	_ = l
+	l = len(m.DocId)
+	if l > 0 {
+		n += 1 + l + sovIndex(uint64(l))
+	}
+	return n
+}
+
+func (m *DocIds) Size() (n int) {
+	if m == nil {
+		return 0
+	}
+	var l int
+	_ = l
+	if len(m.DocIds) > 0 {
+		for _, s := range m.DocIds {
+			l = len(s)
+			n += 1 + l + sovIndex(uint64(l))
+		}
+	}
+	return n
+}
+
+func (m *Documents) Size() (n int) {
+	if m == nil {
+		return 0
+	}
+	var l int
+	_ = l
+	if len(m.Docs) > 0 {
+		for _, e := range m.Docs {
+			l = e.Size()
+			n += 1 + l + sovIndex(uint64(l))
+		}
+	}
+	return n
+}
+
+func (m *AffectedCount) Size() (n int) {
+	if m == nil {
+		return 0
+	}
+	var l int
+	_ = l
+	if m.Count != 0 {
+		n += 1 + sovIndex(uint64(m.Count))
+	}
+	return n
+}
+
+func (m *SortSpec) Size() (n int) {
+	if m == nil {
+		return 0
+	}
+	var l int
+	_ = l
+	if m.By != 0 {
+		n += 1 + sovIndex(uint64(m.By))
+	}
+	if m.Order != 0 {
+		n += 1 + sovIndex(uint64(m.Order))
+	}
+	return n
+}
+
+func (m *SearchRequest) Size() (n int) {
+	if m == nil {
+		return 0
+	}
+	var l int
+	_ = l
+	if m.Query != nil {
+		l = m.Query.Size()
+		n += 1 + l + sovIndex(uint64(l))
+	}
+	if m.OnFlag != 0 {
+		n += 1 + sovIndex(uint64(m.OnFlag))
+	}
+	if m.OffFlag != 0 {
+		n += 1 + sovIndex(uint64(m.OffFlag))
+	}
+	if len(m.OrFlags) > 0 {
+		l = 0
+		for _, e := range m.OrFlags {
+			l += sovIndex(uint64(e))
+		}
+		n += 1 + sovIndex(uint64(l)) + l
+	}
+	if m.From != 0 {
+		n += 1 + sovIndex(uint64(m.From))
+	}
+	if m.PageSize != 0 {
+		n += 1 + sovIndex(uint64(m.PageSize))
+	}
+	if len(m.Sort) > 0 {
+		for _, e := range m.Sort {
+			l = e.Size()
+			n += 1 + l + sovIndex(uint64(l))
+		}
+	}
+	if len(m.Endpoints) > 0 {
+		for _, s := range m.Endpoints {
+			l = len(s)
+			n += 1 + l + sovIndex(uint64(l))
+		}
+	}
+	if len(m.Shards) > 0 {
+		for _, s := range m.Shards {
+			l = len(s)
+			n += 1 + l + sovIndex(uint64(l))
+		}
+	}
+	return n
+}
+
+func (m *ShardFailure) Size() (n int) {
+	if m == nil {
+		return 0
+	}
+	var l int
+	_ = l
+	l = len(m.Shard)
+	if l > 0 {
+		n += 1 + l + sovIndex(uint64(l))
+	}
+	l = len(m.Reason)
+	if l > 0 {
+		n += 1 + l + sovIndex(uint64(l))
+	}
+	return n
+}
+
+func (m *SearchResult) Size() (n int) {
+	if m == nil {
+		return 0
+	}
+	var l int
+	_ = l
+	if len(m.Results) > 0 {
+		for _, e := range m.Results {
+			l = e.Size()
+			n += 1 + l + sovIndex(uint64(l))
+		}
+	}
+	if len(m.Scores) > 0 {
+		n += 1 + sovIndex(uint64(len(m.Scores)*8)) + len(m.Scores)*8
+	}
+	if m.TotalHits != 0 {
+		n += 1 + sovIndex(uint64(m.TotalHits))
+	}
+	if m.TotalShards != 0 {
+		n += 1 + sovIndex(uint64(m.TotalShards))
+	}
+	if m.SuccessfulShards != 0 {
+		n += 1 + sovIndex(uint64(m.SuccessfulShards))
+	}
+	if len(m.ShardFailures) > 0 {
+		for _, e := range m.ShardFailures {
+			l = e.Size()
+			n += 1 + l + sovIndex(uint64(l))
+		}
+	}
+	return n
+}
+
+func (m *CountRequest) Size() (n int) {
+	if m == nil {
+		return 0
+	}
+	var l int
+	_ = l
+	if len(m.Endpoints) > 0 {
+		for _, s := range m.Endpoints {
+			l = len(s)
+			n += 1 + l + sovIndex(uint64(l))
+		}
+	}
+	if len(m.Shards) > 0 {
+		for _, s := range m.Shards {
+			l = len(s)
+			n += 1 + l + sovIndex(uint64(l))
+		}
+	}
+	return n
+}
+
+func (m *ScanRequest) Size() (n int) {
+	if m == nil {
+		return 0
+	}
+	var l int
+	_ = l
+	l = len(m.Cursor)
+	if l > 0 {
+		n += 1 + l + sovIndex(uint64(l))
+	}
+	if m.Limit != 0 {
+		n += 1 + sovIndex(uint64(m.Limit))
+	}
+	if len(m.Endpoints) > 0 {
+		for _, s := range m.Endpoints {
+			l = len(s)
+			n += 1 + l + sovIndex(uint64(l))
+		}
+	}
+	l = len(m.Owner)
+	if l > 0 {
+		n += 1 + l + sovIndex(uint64(l))
+	}
+	if m.Replicas != 0 {
+		n += 1 + sovIndex(uint64(m.Replicas))
+	}
+	return n
+}
+
+func (m *ScanResult) Size() (n int) {
+	if m == nil {
+		return 0
+	}
+	var l int
+	_ = l
+	if len(m.Docs) > 0 {
+		for _, e := range m.Docs {
+			l = e.Size()
+			n += 1 + l + sovIndex(uint64(l))
+		}
+	}
+	l = len(m.NextCursor)
+	if l > 0 {
+		n += 1 + l + sovIndex(uint64(l))
+	}
+	return n
+}
+
+func sovIndex(x uint64) (n int) {
+	return (math_bits.Len64(x|1) + 6) / 7
+}
+func sozIndex(x uint64) (n int) {
+	return sovIndex(uint64((x << 1) ^ uint64((int64(x) >> 63))))
+}
+func (m *DocId) Unmarshal(dAtA []byte) error {
+	l := len(dAtA)
+	iNdEx := 0
+	for iNdEx < l {
+		preIndex := iNdEx
+		var wire uint64
+		for shift := uint(0); ; shift += 7 {
+			if shift >= 64 {
+				return ErrIntOverflowIndex
+			}
+			if iNdEx >= l {
+				return io.ErrUnexpectedEOF
+			}
+			b := dAtA[iNdEx]
+			iNdEx++
+			wire |= uint64(b&0x7F) << shift
+			if b < 0x80 {
+				break
+			}
+		}
+		fieldNum := int32(wire >> 3)
+		wireType := int(wire & 0x7)
+		if wireType == 4 {
+			return fmt.Errorf("proto: DocId: wiretype end group for non-group")
+		}
+		if fieldNum <= 0 {
+			return fmt.Errorf("proto: DocId: illegal tag %d (wire type %d)", fieldNum, wire)
+		}
+		switch fieldNum {
+		case 1:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field DocId", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowIndex
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				stringLen |= uint64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthIndex
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex < 0 {
+				return ErrInvalidLengthIndex
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.DocId = string(dAtA[iNdEx:postIndex])
+			iNdEx = postIndex
+		default:
+			iNdEx = preIndex
+			skippy, err := skipIndex(dAtA[iNdEx:])
+			if err != nil {
+				return err
+			}
+			if (skippy < 0) || (iNdEx+skippy) < 0 {
+				return ErrInvalidLengthIndex
+			}
+			if (iNdEx + skippy) > l {
+				return io.ErrUnexpectedEOF
+			}
+			iNdEx += skippy
+		}
+	}
+
+	if iNdEx > l {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+func (m *DocIds) Unmarshal(dAtA []byte) error {
+	l := len(dAtA)
+	iNdEx := 0
+	for iNdEx < l {
+		preIndex := iNdEx
+		var wire uint64
+		for shift := uint(0); ; shift += 7 {
+			if shift >= 64 {
+				return ErrIntOverflowIndex
+			}
+			if iNdEx >= l {
+				return io.ErrUnexpectedEOF
+			}
+			b := dAtA[iNdEx]
+			iNdEx++
+			wire |= uint64(b&0x7F) << shift
+			if b < 0x80 {
+				break
+			}
+		}
+		fieldNum := int32(wire >> 3)
+		wireType := int(wire & 0x7)
+		if wireType == 4 {
+			return fmt.Errorf("proto: DocIds: wiretype end group for non-group")
+		}
+		if fieldNum <= 0 {
+			return fmt.Errorf("proto: DocIds: illegal tag %d (wire type %d)", fieldNum, wire)
+		}
+		switch fieldNum {
+		case 1:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field DocIds", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowIndex
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				stringLen |= uint64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthIndex
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex < 0 {
+				return ErrInvalidLengthIndex
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.DocIds = append(m.DocIds, string(dAtA[iNdEx:postIndex]))
+			iNdEx = postIndex
+		default:
+			iNdEx = preIndex
+			skippy, err := skipIndex(dAtA[iNdEx:])
+			if err != nil {
+				return err
+			}
+			if (skippy < 0) || (iNdEx+skippy) < 0 {
+				return ErrInvalidLengthIndex
+			}
+			if (iNdEx + skippy) > l {
+				return io.ErrUnexpectedEOF
+			}
+			iNdEx += skippy
+		}
+	}
+
+	if iNdEx > l {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+func (m *Documents) Unmarshal(dAtA []byte) error {
+	l := len(dAtA)
+	iNdEx := 0
+	for iNdEx < l {
+		preIndex := iNdEx
+		var wire uint64
+		for shift := uint(0); ; shift += 7 {
+			if shift >= 64 {
+				return ErrIntOverflowIndex
+			}
+			if iNdEx >= l {
+				return io.ErrUnexpectedEOF
+			}
+			b := dAtA[iNdEx]
+			iNdEx++
+			wire |= uint64(b&0x7F) << shift
+			if b < 0x80 {
+				break
+			}
+		}
+		fieldNum := int32(wire >> 3)
+		wireType := int(wire & 0x7)
+		if wireType == 4 {
+			return fmt.Errorf("proto: Documents: wiretype end group for non-group")
+		}
+		if fieldNum <= 0 {
+			return fmt.Errorf("proto: Documents: illegal tag %d (wire type %d)", fieldNum, wire)
+		}
+		switch fieldNum {
+		case 1:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Docs", wireType)
+			}
+			var msglen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowIndex
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				msglen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if msglen < 0 {
+				return ErrInvalidLengthIndex
+			}
+			postIndex := iNdEx + msglen
+			if postIndex < 0 {
+				return ErrInvalidLengthIndex
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Docs = append(m.Docs, &types.Document{})
+			if err := m.Docs[len(m.Docs)-1].Unmarshal(dAtA[iNdEx:postIndex]); err != nil {
+				return err
+			}
+			iNdEx = postIndex
+		default:
+			iNdEx = preIndex
+			skippy, err := skipIndex(dAtA[iNdEx:])
+			if err != nil {
+				return err
+			}
+			if (skippy < 0) || (iNdEx+skippy) < 0 {
+				return ErrInvalidLengthIndex
+			}
+			if (iNdEx + skippy) > l {
+				return io.ErrUnexpectedEOF
+			}
+			iNdEx += skippy
+		}
+	}
+
+	if iNdEx > l {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+func (m *AffectedCount) Unmarshal(dAtA []byte) error {
+	l := len(dAtA)
+	iNdEx := 0
+	for iNdEx < l {
+		preIndex := iNdEx
+		var wire uint64
+		for shift := uint(0); ; shift += 7 {
+			if shift >= 64 {
+				return ErrIntOverflowIndex
+			}
+			if iNdEx >= l {
+				return io.ErrUnexpectedEOF
+			}
+			b := dAtA[iNdEx]
+			iNdEx++
+			wire |= uint64(b&0x7F) << shift
+			if b < 0x80 {
+				break
+			}
+		}
+		fieldNum := int32(wire >> 3)
+		wireType := int(wire & 0x7)
+		if wireType == 4 {
+			return fmt.Errorf("proto: AffectedCount: wiretype end group for non-group")
+		}
+		if fieldNum <= 0 {
+			return fmt.Errorf("proto: AffectedCount: illegal tag %d (wire type %d)", fieldNum, wire)
+		}
+		switch fieldNum {
+		case 1:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Count", wireType)
+			}
+			m.Count = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowIndex
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.Count |= int32(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		default:
+			iNdEx = preIndex
+			skippy, err := skipIndex(dAtA[iNdEx:])
+			if err != nil {
+				return err
+			}
+			if (skippy < 0) || (iNdEx+skippy) < 0 {
+				return ErrInvalidLengthIndex
+			}
+			if (iNdEx + skippy) > l {
+				return io.ErrUnexpectedEOF
+			}
+			iNdEx += skippy
+		}
+	}
+
+	if iNdEx > l {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+func (m *SortSpec) Unmarshal(dAtA []byte) error {
+	l := len(dAtA)
+	iNdEx := 0
+	for iNdEx < l {
+		preIndex := iNdEx
+		var wire uint64
+		for shift := uint(0); ; shift += 7 {
+			if shift >= 64 {
+				return ErrIntOverflowIndex
+			}
+			if iNdEx >= l {
+				return io.ErrUnexpectedEOF
+			}
+			b := dAtA[iNdEx]
+			iNdEx++
+			wire |= uint64(b&0x7F) << shift
+			if b < 0x80 {
+				break
+			}
+		}
+		fieldNum := int32(wire >> 3)
+		wireType := int(wire & 0x7)
+		if wireType == 4 {
+			return fmt.Errorf("proto: SortSpec: wiretype end group for non-group")
+		}
+		if fieldNum <= 0 {
+			return fmt.Errorf("proto: SortSpec: illegal tag %d (wire type %d)", fieldNum, wire)
+		}
+		switch fieldNum {
+		case 1:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field By", wireType)
+			}
+			m.By = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowIndex
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.By |= SortBy(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 2:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Order", wireType)
+			}
+			m.Order = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowIndex
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.Order |= SortOrder(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		default:
+			iNdEx = preIndex
+			skippy, err := skipIndex(dAtA[iNdEx:])
+			if err != nil {
+				return err
+			}
+			if (skippy < 0) || (iNdEx+skippy) < 0 {
+				return ErrInvalidLengthIndex
+			}
+			if (iNdEx + skippy) > l {
+				return io.ErrUnexpectedEOF
+			}
+			iNdEx += skippy
+		}
+	}
+
+	if iNdEx > l {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+func (m *SearchRequest) Unmarshal(dAtA []byte) error {
+	l := len(dAtA)
+	iNdEx := 0
+	for iNdEx < l {
+		preIndex := iNdEx
+		var wire uint64
+		for shift := uint(0); ; shift += 7 {
+			if shift >= 64 {
+				return ErrIntOverflowIndex
+			}
+			if iNdEx >= l {
+				return io.ErrUnexpectedEOF
+			}
+			b := dAtA[iNdEx]
+			iNdEx++
+			wire |= uint64(b&0x7F) << shift
+			if b < 0x80 {
+				break
+			}
+		}
+		fieldNum := int32(wire >> 3)
+		wireType := int(wire & 0x7)
+		if wireType == 4 {
+			return fmt.Errorf("proto: SearchRequest: wiretype end group for non-group")
+		}
+		if fieldNum <= 0 {
+			return fmt.Errorf("proto: SearchRequest: illegal tag %d (wire type %d)", fieldNum, wire)
+		}
+		switch fieldNum {
+		case 1:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Query", wireType)
+			}
+			var msglen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowIndex
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				msglen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if msglen < 0 {
+				return ErrInvalidLengthIndex
+			}
+			postIndex := iNdEx + msglen
+			if postIndex < 0 {
+				return ErrInvalidLengthIndex
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			if m.Query == nil {
+				m.Query = &types.TermQuery{}
+			}
+			if err := m.Query.Unmarshal(dAtA[iNdEx:postIndex]); err != nil {
+				return err
+			}
+			iNdEx = postIndex
+		case 2:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field OnFlag", wireType)
+			}
+			m.OnFlag = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowIndex
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.OnFlag |= uint64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 3:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field OffFlag", wireType)
+			}
+			m.OffFlag = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowIndex
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.OffFlag |= uint64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 4:
+			if wireType == 0 {
+				var v uint64
+				for shift := uint(0); ; shift += 7 {
+					if shift >= 64 {
+						return ErrIntOverflowIndex
+					}
+					if iNdEx >= l {
+						return io.ErrUnexpectedEOF
+					}
+					b := dAtA[iNdEx]
+					iNdEx++
+					v |= uint64(b&0x7F) << shift
+					if b < 0x80 {
+						break
+					}
+				}
+				m.OrFlags = append(m.OrFlags, v)
+			} else if wireType == 2 {
+				var packedLen int
+				for shift := uint(0); ; shift += 7 {
+					if shift >= 64 {
+						return ErrIntOverflowIndex
+					}
+					if iNdEx >= l {
+						return io.ErrUnexpectedEOF
+					}
+					b := dAtA[iNdEx]
+					iNdEx++
+					packedLen |= int(b&0x7F) << shift
+					if b < 0x80 {
+						break
+					}
+				}
+				if packedLen < 0 {
+					return ErrInvalidLengthIndex
+				}
+				postIndex := iNdEx + packedLen
+				if postIndex < 0 {
+					return ErrInvalidLengthIndex
+				}
+				if postIndex > l {
+					return io.ErrUnexpectedEOF
+				}
+				var elementCount int
+				var count int
+				for _, integer := range dAtA[iNdEx:postIndex] {
+					if integer < 128 {
+						count++
+					}
+				}
+				elementCount = count
+				if elementCount != 0 && len(m.OrFlags) == 0 {
+					m.OrFlags = make([]uint64, 0, elementCount)
+				}
+				for iNdEx < postIndex {
+					var v uint64
+					for shift := uint(0); ; shift += 7 {
+						if shift >= 64 {
+							return ErrIntOverflowIndex
+						}
+						if iNdEx >= l {
+							return io.ErrUnexpectedEOF
+						}
+						b := dAtA[iNdEx]
+						iNdEx++
+						v |= uint64(b&0x7F) << shift
+						if b < 0x80 {
+							break
+						}
+					}
+					m.OrFlags = append(m.OrFlags, v)
+				}
+			} else {
+				return fmt.Errorf("proto: wrong wireType = %d for field OrFlags", wireType)
+			}
+		case 5:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field From", wireType)
+			}
+			m.From = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowIndex
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.From |= int32(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 6:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field PageSize", wireType)
+			}
+			m.PageSize = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowIndex
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.PageSize |= int32(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 7:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Sort", wireType)
+			}
+			var msglen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowIndex
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				msglen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if msglen < 0 {
+				return ErrInvalidLengthIndex
+			}
+			postIndex := iNdEx + msglen
+			if postIndex < 0 {
+				return ErrInvalidLengthIndex
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Sort = append(m.Sort, &SortSpec{})
+			if err := m.Sort[len(m.Sort)-1].Unmarshal(dAtA[iNdEx:postIndex]); err != nil {
+				return err
+			}
+			iNdEx = postIndex
+		case 8:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Endpoints", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowIndex
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				stringLen |= uint64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthIndex
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex < 0 {
+				return ErrInvalidLengthIndex
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Endpoints = append(m.Endpoints, string(dAtA[iNdEx:postIndex]))
+			iNdEx = postIndex
+		case 9:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Shards", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowIndex
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				stringLen |= uint64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthIndex
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex < 0 {
+				return ErrInvalidLengthIndex
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Shards = append(m.Shards, string(dAtA[iNdEx:postIndex]))
+			iNdEx = postIndex
+		default:
+			iNdEx = preIndex
+			skippy, err := skipIndex(dAtA[iNdEx:])
+			if err != nil {
+				return err
+			}
+			if (skippy < 0) || (iNdEx+skippy) < 0 {
+				return ErrInvalidLengthIndex
+			}
+			if (iNdEx + skippy) > l {
+				return io.ErrUnexpectedEOF
+			}
+			iNdEx += skippy
+		}
+	}
+
+	if iNdEx > l {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+func (m *ShardFailure) Unmarshal(dAtA []byte) error {
+	l := len(dAtA)
+	iNdEx := 0
+	for iNdEx < l {
+		preIndex := iNdEx
+		var wire uint64
+		for shift := uint(0); ; shift += 7 {
+			if shift >= 64 {
+				return ErrIntOverflowIndex
+			}
+			if iNdEx >= l {
+				return io.ErrUnexpectedEOF
+			}
+			b := dAtA[iNdEx]
+			iNdEx++
+			wire |= uint64(b&0x7F) << shift
+			if b < 0x80 {
+				break
+			}
+		}
+		fieldNum := int32(wire >> 3)
+		wireType := int(wire & 0x7)
+		if wireType == 4 {
+			return fmt.Errorf("proto: ShardFailure: wiretype end group for non-group")
+		}
+		if fieldNum <= 0 {
+			return fmt.Errorf("proto: ShardFailure: illegal tag %d (wire type %d)", fieldNum, wire)
+		}
+		switch fieldNum {
+		case 1:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Shard", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowIndex
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				stringLen |= uint64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthIndex
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex < 0 {
+				return ErrInvalidLengthIndex
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Shard = string(dAtA[iNdEx:postIndex])
+			iNdEx = postIndex
+		case 2:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Reason", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowIndex
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				stringLen |= uint64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthIndex
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex < 0 {
+				return ErrInvalidLengthIndex
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Reason = string(dAtA[iNdEx:postIndex])
+			iNdEx = postIndex
+		default:
+			iNdEx = preIndex
+			skippy, err := skipIndex(dAtA[iNdEx:])
+			if err != nil {
+				return err
+			}
+			if (skippy < 0) || (iNdEx+skippy) < 0 {
+				return ErrInvalidLengthIndex
+			}
+			if (iNdEx + skippy) > l {
+				return io.ErrUnexpectedEOF
+			}
+			iNdEx += skippy
 		}
 	}
-	return n
-}
 
-func (m *CountRequest) Size() (n int) {
-	if m == nil {
-		return 0
+	if iNdEx > l {
+		return io.ErrUnexpectedEOF
 	}
-	var l int
-	_ = l
-	return n
-}
-
-func sovIndex(x uint64) (n int) {
-	return (math_bits.Len64(x|1) + 6) / 7
-}
-func sozIndex(x uint64) (n int) {
-	return sovIndex(uint64((x << 1) ^ uint64((int64(x) >> 63))))
+	return nil
 }
-func (m *DocId) Unmarshal(dAtA []byte) error {
+func (m *SearchResult) Unmarshal(dAtA []byte) error {
 	l := len(dAtA)
 	iNdEx := 0
 	for iNdEx < l {
@@ -784,17 +2791,17 @@ func (m *DocId) Unmarshal(dAtA []byte) error {
 		fieldNum := int32(wire >> 3)
 		wireType := int(wire & 0x7)
 		if wireType == 4 {
-			return fmt.Errorf("proto: DocId: wiretype end group for non-group")
+			return fmt.Errorf("proto: SearchResult: wiretype end group for non-group")
 		}
 		if fieldNum <= 0 {
-			return fmt.Errorf("proto: DocId: illegal tag %d (wire type %d)", fieldNum, wire)
+			return fmt.Errorf("proto: SearchResult: illegal tag %d (wire type %d)", fieldNum, wire)
 		}
 		switch fieldNum {
 		case 1:
 			if wireType != 2 {
-				return fmt.Errorf("proto: wrong wireType = %d for field DocId", wireType)
+				return fmt.Errorf("proto: wrong wireType = %d for field Results", wireType)
 			}
-			var stringLen uint64
+			var msglen int
 			for shift := uint(0); ; shift += 7 {
 				if shift >= 64 {
 					return ErrIntOverflowIndex
@@ -804,23 +2811,170 @@ func (m *DocId) Unmarshal(dAtA []byte) error {
 				}
 				b := dAtA[iNdEx]
 				iNdEx++
-				stringLen |= uint64(b&0x7F) << shift
+				msglen |= int(b&0x7F) << shift
 				if b < 0x80 {
 					break
 				}
 			}
-			intStringLen := int(stringLen)
-			if intStringLen < 0 {
+			if msglen < 0 {
 				return ErrInvalidLengthIndex
 			}
-			postIndex := iNdEx + intStringLen
+			postIndex := iNdEx + msglen
 			if postIndex < 0 {
 				return ErrInvalidLengthIndex
 			}
 			if postIndex > l {
 				return io.ErrUnexpectedEOF
 			}
-			m.DocId = string(dAtA[iNdEx:postIndex])
+			m.Results = append(m.Results, &types.Document{})
+			if err := m.Results[len(m.Results)-1].Unmarshal(dAtA[iNdEx:postIndex]); err != nil {
+				return err
+			}
+			iNdEx = postIndex
+		case 2:
+			if wireType == 1 {
+				var v uint64
+				if (iNdEx + 8) > l {
+					return io.ErrUnexpectedEOF
+				}
+				v = uint64(encoding_binary.LittleEndian.Uint64(dAtA[iNdEx:]))
+				iNdEx += 8
+				v2 := float64(math.Float64frombits(v))
+				m.Scores = append(m.Scores, v2)
+			} else if wireType == 2 {
+				var packedLen int
+				for shift := uint(0); ; shift += 7 {
+					if shift >= 64 {
+						return ErrIntOverflowIndex
+					}
+					if iNdEx >= l {
+						return io.ErrUnexpectedEOF
+					}
+					b := dAtA[iNdEx]
+					iNdEx++
+					packedLen |= int(b&0x7F) << shift
+					if b < 0x80 {
+						break
+					}
+				}
+				if packedLen < 0 {
+					return ErrInvalidLengthIndex
+				}
+				postIndex := iNdEx + packedLen
+				if postIndex < 0 {
+					return ErrInvalidLengthIndex
+				}
+				if postIndex > l {
+					return io.ErrUnexpectedEOF
+				}
+				var elementCount int
+				elementCount = packedLen / 8
+				if elementCount != 0 && len(m.Scores) == 0 {
+					m.Scores = make([]float64, 0, elementCount)
+				}
+				for iNdEx < postIndex {
+					var v uint64
+					if (iNdEx + 8) > l {
+						return io.ErrUnexpectedEOF
+					}
+					v = uint64(encoding_binary.LittleEndian.Uint64(dAtA[iNdEx:]))
+					iNdEx += 8
+					v2 := float64(math.Float64frombits(v))
+					m.Scores = append(m.Scores, v2)
+				}
+			} else {
+				return fmt.Errorf("proto: wrong wireType = %d for field Scores", wireType)
+			}
+		case 3:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field TotalHits", wireType)
+			}
+			m.TotalHits = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowIndex
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.TotalHits |= int64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 4:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field TotalShards", wireType)
+			}
+			m.TotalShards = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowIndex
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.TotalShards |= int32(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 5:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field SuccessfulShards", wireType)
+			}
+			m.SuccessfulShards = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowIndex
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.SuccessfulShards |= int32(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 6:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field ShardFailures", wireType)
+			}
+			var msglen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowIndex
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				msglen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if msglen < 0 {
+				return ErrInvalidLengthIndex
+			}
+			postIndex := iNdEx + msglen
+			if postIndex < 0 {
+				return ErrInvalidLengthIndex
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.ShardFailures = append(m.ShardFailures, &ShardFailure{})
+			if err := m.ShardFailures[len(m.ShardFailures)-1].Unmarshal(dAtA[iNdEx:postIndex]); err != nil {
+				return err
+			}
 			iNdEx = postIndex
 		default:
 			iNdEx = preIndex
@@ -843,7 +2997,7 @@ func (m *DocId) Unmarshal(dAtA []byte) error {
 	}
 	return nil
 }
-func (m *AffectedCount) Unmarshal(dAtA []byte) error {
+func (m *CountRequest) Unmarshal(dAtA []byte) error {
 	l := len(dAtA)
 	iNdEx := 0
 	for iNdEx < l {
@@ -862,21 +3016,53 @@ func (m *AffectedCount) Unmarshal(dAtA []byte) error {
 			if b < 0x80 {
 				break
 			}
-		}
-		fieldNum := int32(wire >> 3)
-		wireType := int(wire & 0x7)
-		if wireType == 4 {
-			return fmt.Errorf("proto: AffectedCount: wiretype end group for non-group")
-		}
-		if fieldNum <= 0 {
-			return fmt.Errorf("proto: AffectedCount: illegal tag %d (wire type %d)", fieldNum, wire)
-		}
-		switch fieldNum {
-		case 1:
-			if wireType != 0 {
-				return fmt.Errorf("proto: wrong wireType = %d for field Count", wireType)
+		}
+		fieldNum := int32(wire >> 3)
+		wireType := int(wire & 0x7)
+		if wireType == 4 {
+			return fmt.Errorf("proto: CountRequest: wiretype end group for non-group")
+		}
+		if fieldNum <= 0 {
+			return fmt.Errorf("proto: CountRequest: illegal tag %d (wire type %d)", fieldNum, wire)
+		}
+		switch fieldNum {
+		case 1:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Endpoints", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowIndex
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				stringLen |= uint64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthIndex
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex < 0 {
+				return ErrInvalidLengthIndex
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
 			}
-			m.Count = 0
+			m.Endpoints = append(m.Endpoints, string(dAtA[iNdEx:postIndex]))
+			iNdEx = postIndex
+		case 2:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Shards", wireType)
+			}
+			var stringLen uint64
 			for shift := uint(0); ; shift += 7 {
 				if shift >= 64 {
 					return ErrIntOverflowIndex
@@ -886,11 +3072,24 @@ func (m *AffectedCount) Unmarshal(dAtA []byte) error {
 				}
 				b := dAtA[iNdEx]
 				iNdEx++
-				m.Count |= int32(b&0x7F) << shift
+				stringLen |= uint64(b&0x7F) << shift
 				if b < 0x80 {
 					break
 				}
 			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthIndex
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex < 0 {
+				return ErrInvalidLengthIndex
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Shards = append(m.Shards, string(dAtA[iNdEx:postIndex]))
+			iNdEx = postIndex
 		default:
 			iNdEx = preIndex
 			skippy, err := skipIndex(dAtA[iNdEx:])
@@ -912,7 +3111,7 @@ func (m *AffectedCount) Unmarshal(dAtA []byte) error {
 	}
 	return nil
 }
-func (m *SearchRequest) Unmarshal(dAtA []byte) error {
+func (m *ScanRequest) Unmarshal(dAtA []byte) error {
 	l := len(dAtA)
 	iNdEx := 0
 	for iNdEx < l {
@@ -935,17 +3134,17 @@ func (m *SearchRequest) Unmarshal(dAtA []byte) error {
 		fieldNum := int32(wire >> 3)
 		wireType := int(wire & 0x7)
 		if wireType == 4 {
-			return fmt.Errorf("proto: SearchRequest: wiretype end group for non-group")
+			return fmt.Errorf("proto: ScanRequest: wiretype end group for non-group")
 		}
 		if fieldNum <= 0 {
-			return fmt.Errorf("proto: SearchRequest: illegal tag %d (wire type %d)", fieldNum, wire)
+			return fmt.Errorf("proto: ScanRequest: illegal tag %d (wire type %d)", fieldNum, wire)
 		}
 		switch fieldNum {
 		case 1:
 			if wireType != 2 {
-				return fmt.Errorf("proto: wrong wireType = %d for field Query", wireType)
+				return fmt.Errorf("proto: wrong wireType = %d for field Cursor", wireType)
 			}
-			var msglen int
+			var stringLen uint64
 			for shift := uint(0); ; shift += 7 {
 				if shift >= 64 {
 					return ErrIntOverflowIndex
@@ -955,33 +3154,29 @@ func (m *SearchRequest) Unmarshal(dAtA []byte) error {
 				}
 				b := dAtA[iNdEx]
 				iNdEx++
-				msglen |= int(b&0x7F) << shift
+				stringLen |= uint64(b&0x7F) << shift
 				if b < 0x80 {
 					break
 				}
 			}
-			if msglen < 0 {
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
 				return ErrInvalidLengthIndex
 			}
-			postIndex := iNdEx + msglen
+			postIndex := iNdEx + intStringLen
 			if postIndex < 0 {
 				return ErrInvalidLengthIndex
 			}
 			if postIndex > l {
 				return io.ErrUnexpectedEOF
 			}
-			if m.Query == nil {
-				m.Query = &types.TermQuery{}
-			}
-			if err := m.Query.Unmarshal(dAtA[iNdEx:postIndex]); err != nil {
-				return err
-			}
+			m.Cursor = string(dAtA[iNdEx:postIndex])
 			iNdEx = postIndex
 		case 2:
 			if wireType != 0 {
-				return fmt.Errorf("proto: wrong wireType = %d for field OnFlag", wireType)
+				return fmt.Errorf("proto: wrong wireType = %d for field Limit", wireType)
 			}
-			m.OnFlag = 0
+			m.Limit = 0
 			for shift := uint(0); ; shift += 7 {
 				if shift >= 64 {
 					return ErrIntOverflowIndex
@@ -991,16 +3186,16 @@ func (m *SearchRequest) Unmarshal(dAtA []byte) error {
 				}
 				b := dAtA[iNdEx]
 				iNdEx++
-				m.OnFlag |= uint64(b&0x7F) << shift
+				m.Limit |= int32(b&0x7F) << shift
 				if b < 0x80 {
 					break
 				}
 			}
 		case 3:
-			if wireType != 0 {
-				return fmt.Errorf("proto: wrong wireType = %d for field OffFlag", wireType)
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Endpoints", wireType)
 			}
-			m.OffFlag = 0
+			var stringLen uint64
 			for shift := uint(0); ; shift += 7 {
 				if shift >= 64 {
 					return ErrIntOverflowIndex
@@ -1010,86 +3205,74 @@ func (m *SearchRequest) Unmarshal(dAtA []byte) error {
 				}
 				b := dAtA[iNdEx]
 				iNdEx++
-				m.OffFlag |= uint64(b&0x7F) << shift
+				stringLen |= uint64(b&0x7F) << shift
 				if b < 0x80 {
 					break
 				}
 			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthIndex
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex < 0 {
+				return ErrInvalidLengthIndex
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Endpoints = append(m.Endpoints, string(dAtA[iNdEx:postIndex]))
+			iNdEx = postIndex
 		case 4:
-			if wireType == 0 {
-				var v uint64
-				for shift := uint(0); ; shift += 7 {
-					if shift >= 64 {
-						return ErrIntOverflowIndex
-					}
-					if iNdEx >= l {
-						return io.ErrUnexpectedEOF
-					}
-					b := dAtA[iNdEx]
-					iNdEx++
-					v |= uint64(b&0x7F) << shift
-					if b < 0x80 {
-						break
-					}
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Owner", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowIndex
 				}
-				m.OrFlags = append(m.OrFlags, v)
-			} else if wireType == 2 {
-				var packedLen int
-				for shift := uint(0); ; shift += 7 {
-					if shift >= 64 {
-						return ErrIntOverflowIndex
-					}
-					if iNdEx >= l {
-						return io.ErrUnexpectedEOF
-					}
-					b := dAtA[iNdEx]
-					iNdEx++
-					packedLen |= int(b&0x7F) << shift
-					if b < 0x80 {
-						break
-					}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
 				}
-				if packedLen < 0 {
-					return ErrInvalidLengthIndex
+				b := dAtA[iNdEx]
+				iNdEx++
+				stringLen |= uint64(b&0x7F) << shift
+				if b < 0x80 {
+					break
 				}
-				postIndex := iNdEx + packedLen
-				if postIndex < 0 {
-					return ErrInvalidLengthIndex
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthIndex
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex < 0 {
+				return ErrInvalidLengthIndex
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Owner = string(dAtA[iNdEx:postIndex])
+			iNdEx = postIndex
+		case 5:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Replicas", wireType)
+			}
+			m.Replicas = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowIndex
 				}
-				if postIndex > l {
+				if iNdEx >= l {
 					return io.ErrUnexpectedEOF
 				}
-				var elementCount int
-				var count int
-				for _, integer := range dAtA[iNdEx:postIndex] {
-					if integer < 128 {
-						count++
-					}
-				}
-				elementCount = count
-				if elementCount != 0 && len(m.OrFlags) == 0 {
-					m.OrFlags = make([]uint64, 0, elementCount)
-				}
-				for iNdEx < postIndex {
-					var v uint64
-					for shift := uint(0); ; shift += 7 {
-						if shift >= 64 {
-							return ErrIntOverflowIndex
-						}
-						if iNdEx >= l {
-							return io.ErrUnexpectedEOF
-						}
-						b := dAtA[iNdEx]
-						iNdEx++
-						v |= uint64(b&0x7F) << shift
-						if b < 0x80 {
-							break
-						}
-					}
-					m.OrFlags = append(m.OrFlags, v)
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.Replicas |= int32(b&0x7F) << shift
+				if b < 0x80 {
+					break
 				}
-			} else {
-				return fmt.Errorf("proto: wrong wireType = %d for field OrFlags", wireType)
 			}
 		default:
 			iNdEx = preIndex
@@ -1112,7 +3295,7 @@ func (m *SearchRequest) Unmarshal(dAtA []byte) error {
 	}
 	return nil
 }
-func (m *SearchResult) Unmarshal(dAtA []byte) error {
+func (m *ScanResult) Unmarshal(dAtA []byte) error {
 	l := len(dAtA)
 	iNdEx := 0
 	for iNdEx < l {
@@ -1135,15 +3318,15 @@ func (m *SearchResult) Unmarshal(dAtA []byte) error {
 		fieldNum := int32(wire >> 3)
 		wireType := int(wire & 0x7)
 		if wireType == 4 {
-			return fmt.Errorf("proto: SearchResult: wiretype end group for non-group")
+			return fmt.Errorf("proto: ScanResult: wiretype end group for non-group")
 		}
 		if fieldNum <= 0 {
-			return fmt.Errorf("proto: SearchResult: illegal tag %d (wire type %d)", fieldNum, wire)
+			return fmt.Errorf("proto: ScanResult: illegal tag %d (wire type %d)", fieldNum, wire)
 		}
 		switch fieldNum {
 		case 1:
 			if wireType != 2 {
-				return fmt.Errorf("proto: wrong wireType = %d for field Results", wireType)
+				return fmt.Errorf("proto: wrong wireType = %d for field Docs", wireType)
 			}
 			var msglen int
 			for shift := uint(0); ; shift += 7 {
@@ -1170,61 +3353,43 @@ func (m *SearchResult) Unmarshal(dAtA []byte) error {
 			if postIndex > l {
 				return io.ErrUnexpectedEOF
 			}
-			m.Results = append(m.Results, &types.Document{})
-			if err := m.Results[len(m.Results)-1].Unmarshal(dAtA[iNdEx:postIndex]); err != nil {
+			m.Docs = append(m.Docs, &types.Document{})
+			if err := m.Docs[len(m.Docs)-1].Unmarshal(dAtA[iNdEx:postIndex]); err != nil {
 				return err
 			}
 			iNdEx = postIndex
-		default:
-			iNdEx = preIndex
-			skippy, err := skipIndex(dAtA[iNdEx:])
-			if err != nil {
-				return err
+		case 2:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field NextCursor", wireType)
 			}
-			if (skippy < 0) || (iNdEx+skippy) < 0 {
-				return ErrInvalidLengthIndex
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowIndex
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				stringLen |= uint64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
 			}
-			if (iNdEx + skippy) > l {
-				return io.ErrUnexpectedEOF
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthIndex
 			}
-			iNdEx += skippy
-		}
-	}
-
-	if iNdEx > l {
-		return io.ErrUnexpectedEOF
-	}
-	return nil
-}
-func (m *CountRequest) Unmarshal(dAtA []byte) error {
-	l := len(dAtA)
-	iNdEx := 0
-	for iNdEx < l {
-		preIndex := iNdEx
-		var wire uint64
-		for shift := uint(0); ; shift += 7 {
-			if shift >= 64 {
-				return ErrIntOverflowIndex
+			postIndex := iNdEx + intStringLen
+			if postIndex < 0 {
+				return ErrInvalidLengthIndex
 			}
-			if iNdEx >= l {
+			if postIndex > l {
 				return io.ErrUnexpectedEOF
 			}
-			b := dAtA[iNdEx]
-			iNdEx++
-			wire |= uint64(b&0x7F) << shift
-			if b < 0x80 {
-				break
-			}
-		}
-		fieldNum := int32(wire >> 3)
-		wireType := int(wire & 0x7)
-		if wireType == 4 {
-			return fmt.Errorf("proto: CountRequest: wiretype end group for non-group")
-		}
-		if fieldNum <= 0 {
-			return fmt.Errorf("proto: CountRequest: illegal tag %d (wire type %d)", fieldNum, wire)
-		}
-		switch fieldNum {
+			m.NextCursor = string(dAtA[iNdEx:postIndex])
+			iNdEx = postIndex
 		default:
 			iNdEx = preIndex
 			skippy, err := skipIndex(dAtA[iNdEx:])
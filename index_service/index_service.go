@@ -4,22 +4,59 @@ import (
 	"context"
 	"fmt"
 	"strconv"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/kisaragi77/TinyES/types"
 	"github.com/kisaragi77/TinyES/util"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
 )
 
 const (
-	INDEX_SERVICE = "index_service"
+	INDEX_SERVICE          = "index_service"
+	WORKER_HEARTBEAT       = 3                // Lease of worker registration in seconds
+	DOC_COUNT_PUBLISH_TIME = 30 * time.Second // DocCount in the published metadata is refreshed at this interval
 )
 
 // IndexWorker grpc server
 type IndexServiceWorker struct {
 	Indexer *Indexer // foward and reverse index
+	//Metadata published to service center, see EndpointInfo
+	Weight  int      // Capacity weight for WeightedRoundRobin, 0 means the default weight
+	Zone    string   // Availability zone
+	Version string   // Build version
+	Shards  []string // Shards owned by the worker
+	Host    string   // Host published to service center, 127.0.0.1 if empty
 	//Config of service registration
-	hub      *ServiceHub
+	hub      IServiceHub
+	ownHub   bool // hub is created by Regist, and closed with the worker
 	selfAddr string
+	ring     atomic.Pointer[ConsistentHash] // Hash ring of the latest Scan or Search request, rebuilt when endpoints change
+	//Lifecycle
+	unready      atomic.Bool   // Set by SetReady(false)
+	regLock      sync.Mutex    // Serializes registration, heartbeat and deregistration
+	leaseId      int64         // Lease of the registration, renewed by heartbeat
+	info         *EndpointInfo // Metadata published last time
+	infoTime     time.Time
+	deregistered bool
+	stop         chan struct{} // Closed to stop heartbeat
+	stopped      chan struct{} // Closed when heartbeat exits
+	shutdown     sync.Once
+	shutdownErr  error
+}
+
+// Registries supporting metadata of endpoints
+type infoRegistry interface {
+	RegistWithInfo(service string, endpoint string, leaseID int64, info *EndpointInfo) (int64, error)
+}
+
+// Registries whose registration expires if not renewed in time
+type leasedRegistry interface {
+	leaseSeconds() int64
 }
 
 // Initialize index
@@ -28,61 +65,306 @@ func (service *IndexServiceWorker) Init(DocNumEstimate int, dbtype int, DataDir
 	return service.Indexer.Init(DocNumEstimate, dbtype, DataDir)
 }
 
-// Register to service center
+// Register to service center on etcd
 func (service *IndexServiceWorker) Regist(etcdServers []string, servicePort int) error {
 	if len(etcdServers) > 0 {
-		if servicePort <= 1024 {
-			return fmt.Errorf("invalid listen port %d, should more than 1024", servicePort)
-		}
-		selfLocalIp, err := util.GetLocalIP()
+		hub, err := NewServiceHub(WithEtcdServers(etcdServers), WithHeartbeat(WORKER_HEARTBEAT))
 		if err != nil {
-			panic(err)
+			return err
 		}
-		selfLocalIp = "127.0.0.1" //TODO: Fix selfLocalIp 127.0.0.1 at Local Testing
-		service.selfAddr = selfLocalIp + ":" + strconv.Itoa(servicePort)
-		var heartBeat int64 = 3
-		hub := GetServiceHub(etcdServers, heartBeat)
-		leaseId, err := hub.Regist(INDEX_SERVICE, service.selfAddr, 0)
-		if err != nil {
+		if err := service.RegistHub(hub, servicePort); err != nil {
+			hub.Close()
+			return err
+		}
+		service.ownHub = true
+	}
+	return nil
+}
+
+// Register to the service center hub, and renew the registration before the lease expires(every WORKER_HEARTBEAT
+// seconds for registries without lease) until Shutdown. The hub is not closed with the worker.
+func (service *IndexServiceWorker) RegistHub(hub IServiceHub, servicePort int) error {
+	if servicePort <= 1024 {
+		return fmt.Errorf("invalid listen port %d, should more than 1024", servicePort)
+	}
+	selfLocalIp := service.Host
+	if selfLocalIp == "" {
+		var err error
+		if selfLocalIp, err = util.GetLocalIP(); err != nil {
 			panic(err)
 		}
-		service.hub = hub
-		go func() {
-			for {
-				hub.Regist(INDEX_SERVICE, service.selfAddr, leaseId)
-				time.Sleep(time.Duration(heartBeat)*time.Second - 100*time.Millisecond)
-			}
-		}()
+		selfLocalIp = "127.0.0.1" //TODO: Fix selfLocalIp 127.0.0.1 at Local Testing
+	}
+	service.regLock.Lock()
+	service.hub = hub
+	service.selfAddr = selfLocalIp + ":" + strconv.Itoa(servicePort)
+	service.regLock.Unlock()
+	if err := service.renew(true); err != nil {
+		service.regLock.Lock()
+		service.hub = nil
+		service.regLock.Unlock()
+		return err
+	}
+	heartbeat := int64(WORKER_HEARTBEAT)
+	if leased, ok := hub.(leasedRegistry); ok {
+		heartbeat = leased.leaseSeconds()
 	}
+	service.stop, service.stopped = make(chan struct{}), make(chan struct{})
+	go func(stop, stopped chan struct{}) {
+		defer close(stopped)
+		ticker := time.NewTicker(time.Duration(heartbeat)*time.Second - 100*time.Millisecond)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := service.renew(false); err != nil {
+					util.Log.Printf("renew registration of %s failed: %s", service.selfAddr, err)
+				}
+			case <-stop:
+				return
+			}
+		}
+	}(service.stop, service.stopped)
 	return nil
 }
 
-// Close index
-func (service *IndexServiceWorker) Close() error {
-	if service.hub != nil {
-		service.hub.UnRegist(INDEX_SERVICE, service.selfAddr)
+// Register or renew the registration. The published metadata is refreshed if refresh is true or it is older than
+// DOC_COUNT_PUBLISH_TIME. Does nothing after deregistration, so heartbeat never registers the worker again.
+func (service *IndexServiceWorker) renew(refresh bool) error {
+	service.regLock.Lock()
+	defer service.regLock.Unlock()
+	if service.hub == nil || service.deregistered {
+		return nil
+	}
+	var leaseId int64
+	var err error
+	if registry, ok := service.hub.(infoRegistry); ok {
+		if refresh || service.info == nil || service.info.Ready != service.Ready() || time.Since(service.infoTime) >= DOC_COUNT_PUBLISH_TIME { //统计文档数要遍历整个正排索引，不在每次心跳时都做
+			service.info, service.infoTime = service.endpointInfo(), time.Now()
+		}
+		leaseId, err = registry.RegistWithInfo(INDEX_SERVICE, service.selfAddr, service.leaseId, service.info)
+	} else {
+		leaseId, err = service.hub.Regist(INDEX_SERVICE, service.selfAddr, service.leaseId)
+	}
+	if err == nil {
+		service.leaseId = leaseId //租约过期后会重新注册，换成新的租约
+	}
+	return err
+}
+
+// Metadata of the worker published to service center
+func (service *IndexServiceWorker) endpointInfo() *EndpointInfo {
+	return &EndpointInfo{
+		Shards:   service.Shards,
+		DocCount: service.Indexer.Count(),
+		Version:  service.Version,
+		Zone:     service.Zone,
+		Weight:   service.Weight,
+		Ready:    service.Ready(),
+	}
+}
+
+// Whether the worker is ready to serve, i.e. not marked by SetReady(false) and the index is not loading(see Indexer.Loading).
+// A worker with nothing on disk to load is ready as soon as it's initialized.
+func (service *IndexServiceWorker) Ready() bool {
+	return !service.unready.Load() && !service.Indexer.Loading()
+}
+
+// Mark the worker ready or not, and publish it to service center immediately. The worker is still not ready while
+// the index is loading.
+func (service *IndexServiceWorker) SetReady(ready bool) {
+	service.unready.Store(!ready)
+	service.publish()
+}
+
+// Publish the metadata, including readiness, to service center immediately
+func (service *IndexServiceWorker) publish() {
+	if err := service.renew(true); err != nil {
+		util.Log.Printf("publish readiness of %s failed: %s", service.selfAddr, err)
+	}
+}
+
+// Load index from the forward index on disk, see Indexer.LoadFromIndexFile. The worker is published as not ready while
+// loading and as ready immediately after, so Sentinel doesn't route queries to it until the reverse index is complete.
+// If Indexer.LoadFromIndexFile is called directly, the readiness is published by the next heartbeat.
+func (service *IndexServiceWorker) LoadFromIndexFile() int {
+	service.Indexer.loading.Store(true)
+	service.publish()
+	defer service.publish()
+	return service.Indexer.LoadFromIndexFile()
+}
+
+// Remove the registration from service center, heartbeat stops renewing it
+func (service *IndexServiceWorker) deregister() {
+	service.regLock.Lock()
+	defer service.regLock.Unlock()
+	if service.hub == nil || service.deregistered {
+		return
+	}
+	service.deregistered = true
+	if err := service.hub.UnRegist(INDEX_SERVICE, service.selfAddr); err != nil {
+		util.Log.Printf("unregist %s failed: %s", service.selfAddr, err)
 	}
-	return service.Indexer.Close()
+}
+
+// Stop the worker gracefully:
+//  1. deregister from service center, so no new requests are routed to it
+//  2. drain server: wait for the in-flight RPCs to finish, the remaining ones are canceled when ctx is done
+//  3. stop heartbeat
+//  4. close the index
+//
+// server can be nil if the worker is not served by its own grpc server. Only the first call takes effect.
+func (service *IndexServiceWorker) Shutdown(ctx context.Context, server *grpc.Server) error {
+	service.shutdown.Do(func() {
+		service.deregister()
+		if server != nil {
+			drained := make(chan struct{})
+			go func() {
+				server.GracefulStop()
+				close(drained)
+			}()
+			select {
+			case <-drained:
+			case <-ctx.Done():
+				util.Log.Printf("drain %s timeout: %s", service.selfAddr, ctx.Err())
+				server.Stop()
+				<-drained
+			}
+		}
+		if service.stop != nil {
+			close(service.stop)
+			<-service.stopped
+		}
+		if service.hub != nil && service.ownHub {
+			service.hub.Close()
+		}
+		service.shutdownErr = service.Indexer.Close()
+	})
+	return service.shutdownErr
+}
+
+// Close worker without draining, see Shutdown
+func (service *IndexServiceWorker) Close() error {
+	return service.Shutdown(context.Background(), nil)
 }
 
 // Delete Documnet from index RPC
 func (service *IndexServiceWorker) DeleteDoc(ctx context.Context, docId *DocId) (*AffectedCount, error) {
-	return &AffectedCount{int32(service.Indexer.DeleteDoc(docId.DocId))}, nil
+	if md, ok := metadata.FromIncomingContext(ctx); ok && len(md.Get(MOVED_DOC_METADATA)) > 0 { //rebalancer deletes the source copy of a moved document
+		if err := ctx.Err(); err != nil {
+			return &AffectedCount{}, rpcError(err)
+		}
+		return &AffectedCount{int32(service.Indexer.DeleteMovedDoc(docId.DocId))}, nil
+	}
+	n, err := service.Indexer.DeleteDocContext(ctx, docId.DocId)
+	return &AffectedCount{int32(n)}, rpcError(err)
 }
 
 // Add/Update Documnet to index RPC.
 func (service *IndexServiceWorker) AddDoc(ctx context.Context, doc *types.Document) (*AffectedCount, error) {
-	n, err := service.Indexer.AddDoc(*doc)
-	return &AffectedCount{int32(n)}, err
+	n, err := service.Indexer.AddDocContext(ctx, *doc)
+	return &AffectedCount{int32(n)}, rpcError(err)
+}
+
+// Convert the error of a canceled or timed out context to the corresponding grpc status, so the client sees
+// codes.Canceled or codes.DeadlineExceeded instead of codes.Unknown
+func rpcError(err error) error {
+	if err == nil {
+		return nil
+	}
+	if s := status.FromContextError(err); s.Code() != codes.Unknown {
+		return s.Err()
+	}
+	return err
 }
 
-// Search index RPC
+// Search index RPC. If request.Shards is not empty, only the documents in these shards are searched
 func (service *IndexServiceWorker) Search(ctx context.Context, request *SearchRequest) (*SearchResult, error) {
-	result := service.Indexer.Search(request.Query, request.OnFlag, request.OffFlag, request.OrFlags)
-	return &SearchResult{Results: result}, nil
+	result, err := service.Indexer.search(ctx, request, service.shardFilter(request.Endpoints, request.Shards))
+	return result, rpcError(err)
+}
+
+// Accept the documents whose owner on the ring of endpoints is in shards, nil if shards is empty
+func (service *IndexServiceWorker) shardFilter(endpoints []string, shards []string) func(docId string) bool {
+	if len(endpoints) == 0 || len(shards) == 0 {
+		return nil
+	}
+	ring := service.getRing(endpoints)
+	accepted := make(map[string]bool, len(shards))
+	for _, shard := range shards {
+		accepted[shard] = true
+	}
+	return func(docId string) bool {
+		return accepted[ring.Get(docId)]
+	}
 }
 
-// Index Count RPC
+// Get the hash ring of endpoints. The ring is cached since endpoints rarely change
+func (service *IndexServiceWorker) getRing(endpoints []string) *ConsistentHash {
+	ring := service.ring.Load()
+	if ring == nil || !ring.Same(endpoints) {
+		ring = NewConsistentHash(endpoints, VIRTUAL_NODES)
+		service.ring.Store(ring)
+	}
+	return ring
+}
+
+// Index Count RPC. If request.Shards is not empty, only the documents in these shards are counted
 func (service *IndexServiceWorker) Count(ctx context.Context, request *CountRequest) (*AffectedCount, error) {
-	return &AffectedCount{int32(service.Indexer.Count())}, nil
+	n, err := service.Indexer.count(ctx, service.shardFilter(request.Endpoints, request.Shards))
+	return &AffectedCount{int32(n)}, rpcError(err)
+}
+
+// Get Document RPC. Id of the returned document is empty if not found
+func (service *IndexServiceWorker) GetDoc(ctx context.Context, docId *DocId) (*types.Document, error) {
+	doc, err := service.Indexer.GetDocContext(ctx, docId.DocId)
+	if err != nil {
+		return nil, rpcError(err)
+	}
+	if doc != nil {
+		return doc, nil
+	}
+	return &types.Document{}, nil
+}
+
+// Get multiple Documents RPC
+func (service *IndexServiceWorker) MultiGetDoc(ctx context.Context, docIds *DocIds) (*Documents, error) {
+	docs, err := service.Indexer.MultiGetDocContext(ctx, docIds.DocIds)
+	return &Documents{Docs: docs}, rpcError(err)
+}
+
+// Scan Documents RPC. The documents stored by request.Owner on the hash ring of request.Endpoints are skipped
+func (service *IndexServiceWorker) Scan(ctx context.Context, request *ScanRequest) (*ScanResult, error) {
+	limit := int(request.Limit)
+	if limit <= 0 {
+		limit = REBALANCE_BATCH_SIZE
+	}
+	var skip func(docId string) bool
+	if len(request.Endpoints) > 0 {
+		ring := service.getRing(request.Endpoints)
+		replicas := int(request.Replicas)
+		skip = func(docId string) bool {
+			for _, endpoint := range ring.GetN(docId, replicas) {
+				if endpoint == request.Owner {
+					return true
+				}
+			}
+			return false
+		}
+	}
+	docs, next := service.Indexer.ScanDoc(request.Cursor, limit, skip)
+	return &ScanResult{Docs: docs, NextCursor: next}, nil
+}
+
+// Import Documents RPC, the documents already exist are not overwritten
+func (service *IndexServiceWorker) ImportDoc(ctx context.Context, docs *Documents) (*AffectedCount, error) {
+	n := 0
+	for _, doc := range docs.Docs {
+		affected, err := service.Indexer.ImportDoc(*doc)
+		if err != nil {
+			return &AffectedCount{int32(n)}, err
+		}
+		n += affected
+	}
+	return &AffectedCount{int32(n)}, nil
 }
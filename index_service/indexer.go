@@ -2,21 +2,42 @@ package index_service
 
 import (
 	"bytes"
+	"context"
 	"encoding/gob"
 	"strings"
+	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/kisaragi77/TinyES/internal/kvdb"
 	reverseindex "github.com/kisaragi77/TinyES/internal/reverse_index"
+	"github.com/kisaragi77/TinyES/internal/wal"
 	"github.com/kisaragi77/TinyES/types"
 	"github.com/kisaragi77/TinyES/util"
+	farmhash "github.com/leemcloughlin/gofarmhash"
+)
+
+const (
+	WAL_SUFFIX          = ".wal"    // The write-ahead log is stored in DataDir + WAL_SUFFIX
+	WAL_CHECKPOINT_SIZE = 64 << 20  // Make a checkpoint when the write-ahead log grows beyond this size
+	TOMBSTONE_TTL       = time.Hour // Ids of deleted documents are remembered so long, ImportDoc doesn't add them back
 )
 
 // Combine forward and reverse index
 type Indexer struct {
-	forwardIndex kvdb.IKeyValueDB
-	reverseIndex reverseindex.IReverseIndexer
-	maxIntId     uint64
+	forwardIndex   kvdb.IKeyValueDB
+	reverseIndex   reverseindex.IReverseIndexer
+	maxIntId       uint64
+	wal            *wal.WAL
+	checkpointLock sync.RWMutex // Mutations hold the read lock from logging to applying, checkpoint holds the write lock
+	loading        atomic.Bool  // Documents on disk are not in the reverse index yet, see Loading
+	docLocks       []sync.Mutex // Upsert and delete of the same document id compete for one lock
+
+	// Id of document deleted by clients -> deletion time, kept in memory for TOMBSTONE_TTL. A rebalance still moving
+	// an old copy of the document must not bring it back, see ImportDoc
+	tombstones     map[string]time.Time
+	tombstoneLock  sync.Mutex
+	tombstoneSweep time.Time // Last time the expired tombstones were removed
 }
 
 // Initialize the index
@@ -25,14 +46,69 @@ func (indexer *Indexer) Init(DocNumEstimate int, dbtype int, DataDir string) err
 	if err != nil {
 		return err
 	}
+	log, err := wal.Open(DataDir + WAL_SUFFIX)
+	if err != nil {
+		db.Close()
+		return err
+	}
 	indexer.forwardIndex = db
+	indexer.wal = log
 	indexer.reverseIndex = reverseindex.NewSkipListReverseIndex(DocNumEstimate)
+	indexer.docLocks = make([]sync.Mutex, 1000)
+	indexer.tombstones = make(map[string]time.Time)
+	indexer.tombstoneSweep = time.Now()
+	indexer.loading.Store(log.Size() > 0 || !isEmpty(db))
 	return nil
 }
 
-// Load data from index file when system restarts
+func isEmpty(db kvdb.IKeyValueDB) bool {
+	empty := true
+	db.Seek(nil, func(k, v []byte) bool {
+		empty = false
+		return false
+	})
+	return empty
+}
+
+// Whether the index is incomplete: from Init until LoadFromIndexFile finishes if there are documents on disk,
+// and while LoadFromIndexFile is running
+func (indexer *Indexer) Loading() bool {
+	return indexer.loading.Load()
+}
+
+func (indexer *Indexer) getDocLock(docId string) *sync.Mutex {
+	n := int(farmhash.Hash32WithSeed([]byte(docId), 0))
+	return &indexer.docLocks[n%len(indexer.docLocks)]
+}
+
+// Load data from index file when system restarts.
+//
+// Mutations in the write-ahead log are replayed to the forward index first, then the reverse index is rebuilt
+// from the forward index, so the two always agree even if the process crashed in the middle of AddDoc or DeleteDoc.
+// A checkpoint is made after loading.
+//
+// maxIntId is restored to the largest IntId of the stored documents, so that new documents never reuse
+// an IntId that is still in the reverse index.
 func (indexer *Indexer) LoadFromIndexFile() int {
+	indexer.loading.Store(true)
+	defer indexer.loading.Store(false)
+	replayed, err := indexer.wal.Replay(func(record *wal.Record) error {
+		switch record.Op {
+		case wal.OP_PUT:
+			return indexer.forwardIndex.Set(record.Key, record.Value)
+		case wal.OP_DELETE:
+			return indexer.forwardIndex.Delete(record.Key)
+		}
+		return nil
+	})
+	if err != nil {
+		util.Log.Printf("replay wal %s failed after %d records: %s", indexer.wal.Path(), replayed, err)
+	} else if replayed > 0 {
+		util.Log.Printf("replay %d records from wal %s", replayed, indexer.wal.Path())
+	}
+
 	reader := bytes.NewReader([]byte{})
+	var maxIntId uint64
 	n := indexer.forwardIndex.IterDB(func(k, v []byte) error {
 		reader.Reset(v)
 		decoder := gob.NewDecoder(reader)
@@ -43,40 +119,186 @@ func (indexer *Indexer) LoadFromIndexFile() int {
 			return nil
 		}
 		indexer.reverseIndex.Add(doc)
+		if doc.IntId > maxIntId {
+			maxIntId = doc.IntId
+		}
 		return err
 	})
-	util.Log.Printf("load %d data from forward index %s", n, indexer.forwardIndex.GetDbPath())
+	for {
+		current := atomic.LoadUint64(&indexer.maxIntId)
+		if current >= maxIntId || atomic.CompareAndSwapUint64(&indexer.maxIntId, current, maxIntId) {
+			break
+		}
+	}
+	util.Log.Printf("load %d data from forward index %s, max IntId %d", n, indexer.forwardIndex.GetDbPath(), maxIntId)
+	if err == nil {
+		if err := indexer.Checkpoint(); err != nil {
+			util.Log.Printf("checkpoint failed: %s", err)
+		}
+	}
 	return int(n)
 }
 
+// Flush the forward index to disk, then truncate the write-ahead log
+func (indexer *Indexer) Checkpoint() error {
+	indexer.checkpointLock.Lock()
+	defer indexer.checkpointLock.Unlock()
+	if err := indexer.forwardIndex.Sync(); err != nil {
+		return err
+	}
+	return indexer.wal.Truncate()
+}
+
+// Make a checkpoint when the write-ahead log is too large
+func (indexer *Indexer) maybeCheckpoint() {
+	if indexer.wal.Size() > WAL_CHECKPOINT_SIZE {
+		if err := indexer.Checkpoint(); err != nil {
+			util.Log.Printf("checkpoint failed: %s", err)
+		}
+	}
+}
+
 // Close index
 func (indexer *Indexer) Close() error {
+	if err := indexer.Checkpoint(); err != nil {
+		util.Log.Printf("checkpoint failed: %s", err)
+	}
+	indexer.wal.Close()
 	return indexer.forwardIndex.Close()
 }
 
 // Add/Upsert document to index. If exists, delete first.
+//
+// The document is written to the write-ahead log before updating the forward and reverse index. Upserts and
+// deletes of the same document id are serialized, so the reverse index never keeps an outdated IntId of it.
 func (indexer *Indexer) AddDoc(doc types.Document) (int, error) {
+	return indexer.putDoc(doc, false)
+}
+
+// Add document to index only if its Id does not exist and was not deleted in the last TOMBSTONE_TTL. Used by
+// rebalancing, so that a document moved from another worker never overwrites a newer version written by clients,
+// nor resurrects a document deleted by clients after its owner changed.
+//
+// Tombstones are kept in memory only, a document deleted before the worker restarted, or before a rebalance longer
+// than TOMBSTONE_TTL, may still be brought back.
+func (indexer *Indexer) ImportDoc(doc types.Document) (int, error) {
+	return indexer.putDoc(doc, true)
+}
+
+// Same as AddDoc, but nothing is written if ctx is already done
+func (indexer *Indexer) AddDocContext(ctx context.Context, doc types.Document) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	return indexer.AddDoc(doc)
+}
+
+func (indexer *Indexer) putDoc(doc types.Document, ifAbsent bool) (int, error) {
 	docId := strings.TrimSpace(doc.Id)
 	if len(docId) == 0 {
 		return 0, nil
 	}
-	indexer.DeleteDoc(docId)
 
 	doc.IntId = atomic.AddUint64(&indexer.maxIntId, 1)
 	var value bytes.Buffer
 	encoder := gob.NewEncoder(&value)
-	if err := encoder.Encode(doc); err == nil {
-		indexer.forwardIndex.Set([]byte(docId), value.Bytes())
-	} else {
+	if err := encoder.Encode(doc); err != nil {
 		return 0, err
 	}
 
+	indexer.checkpointLock.RLock()
+	lock := indexer.getDocLock(docId)
+	lock.Lock()
+	if ifAbsent && (indexer.hasTombstone(docId) || indexer.forwardIndex.Has([]byte(docId))) {
+		lock.Unlock()
+		indexer.checkpointLock.RUnlock()
+		return 0, nil
+	}
+	if err := indexer.wal.Append(wal.OP_PUT, []byte(docId), value.Bytes()); err != nil {
+		lock.Unlock()
+		indexer.checkpointLock.RUnlock()
+		return 0, err
+	}
+	indexer.deleteDoc(docId)
+	indexer.removeTombstone(docId)
+	indexer.forwardIndex.Set([]byte(docId), value.Bytes())
 	indexer.reverseIndex.Add(doc)
+	lock.Unlock()
+	indexer.checkpointLock.RUnlock()
+
+	indexer.maybeCheckpoint()
 	return 1, nil
 }
 
-// Delete document from index
+// Delete document from index. A tombstone is kept even if the document doesn't exist, see ImportDoc
 func (indexer *Indexer) DeleteDoc(docId string) int {
+	return indexer.delete(docId, true)
+}
+
+// Delete a document moved to another worker by rebalancing. No tombstone is kept, so it can be moved back later
+func (indexer *Indexer) DeleteMovedDoc(docId string) int {
+	return indexer.delete(docId, false)
+}
+
+func (indexer *Indexer) delete(docId string, tombstone bool) int {
+	indexer.checkpointLock.RLock()
+	lock := indexer.getDocLock(docId)
+	lock.Lock()
+	if err := indexer.wal.Append(wal.OP_DELETE, []byte(docId), nil); err != nil {
+		lock.Unlock()
+		indexer.checkpointLock.RUnlock()
+		util.Log.Printf("write wal failed, doc %s is not deleted: %s", docId, err)
+		return 0
+	}
+	n := indexer.deleteDoc(docId)
+	if tombstone {
+		indexer.addTombstone(docId)
+	}
+	lock.Unlock()
+	indexer.checkpointLock.RUnlock()
+
+	indexer.maybeCheckpoint()
+	return n
+}
+
+// Same as DeleteDoc, but nothing is deleted if ctx is already done
+func (indexer *Indexer) DeleteDocContext(ctx context.Context, docId string) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	return indexer.DeleteDoc(docId), nil
+}
+
+func (indexer *Indexer) addTombstone(docId string) {
+	now := time.Now()
+	indexer.tombstoneLock.Lock()
+	defer indexer.tombstoneLock.Unlock()
+	indexer.tombstones[docId] = now
+	if now.Sub(indexer.tombstoneSweep) > TOMBSTONE_TTL {
+		for id, deleted := range indexer.tombstones {
+			if now.Sub(deleted) > TOMBSTONE_TTL {
+				delete(indexer.tombstones, id)
+			}
+		}
+		indexer.tombstoneSweep = now
+	}
+}
+
+func (indexer *Indexer) hasTombstone(docId string) bool {
+	indexer.tombstoneLock.Lock()
+	defer indexer.tombstoneLock.Unlock()
+	deleted, exists := indexer.tombstones[docId]
+	return exists && time.Since(deleted) <= TOMBSTONE_TTL
+}
+
+func (indexer *Indexer) removeTombstone(docId string) {
+	indexer.tombstoneLock.Lock()
+	defer indexer.tombstoneLock.Unlock()
+	delete(indexer.tombstones, docId)
+}
+
+// Delete document from forward and reverse index without logging
+func (indexer *Indexer) deleteDoc(docId string) int {
 	n := 0
 	forwardKey := []byte(docId)
 	docBs, err := indexer.forwardIndex.Get(forwardKey)
@@ -99,43 +321,214 @@ func (indexer *Indexer) DeleteDoc(docId string) int {
 	return n
 }
 
-// Return  list of documents by searching the query from index
-func (indexer *Indexer) Search(query *types.TermQuery, onFlag uint64, offFlag uint64, orFlags []uint64) []*types.Document {
-	docIds := indexer.reverseIndex.Search(query, onFlag, offFlag, orFlags)
-	if len(docIds) == 0 {
-		return nil
+// Return the requested page of documents matching the query, ranked by the sort specs(BM25 score by default).
+//
+// Only documents in the page are read from the forward index.
+func (indexer *Indexer) Search(request *SearchRequest) *SearchResult {
+	result, _ := indexer.search(context.Background(), request, nil)
+	return result
+}
+
+// Same as Search, but give up and return ctx.Err() when ctx is done
+func (indexer *Indexer) SearchContext(ctx context.Context, request *SearchRequest) (*SearchResult, error) {
+	return indexer.search(ctx, request, nil)
+}
+
+// Search only the documents for which accept returns true, all documents if accept is nil
+func (indexer *Indexer) search(ctx context.Context, request *SearchRequest, accept func(docId string) bool) (*SearchResult, error) {
+	result := &SearchResult{}
+	if request.Query == nil {
+		return result, nil
 	}
-	keys := make([][]byte, 0, len(docIds))
-	for _, docId := range docIds {
-		keys = append(keys, []byte(docId))
+	hits, err := indexer.reverseIndex.SearchContext(ctx, request.Query, request.OnFlag, request.OffFlag, request.OrFlags)
+	if err != nil {
+		return result, err
+	}
+	if accept != nil {
+		accepted := hits[:0]
+		for _, hit := range hits {
+			if accept(hit.Id) {
+				accepted = append(accepted, hit)
+			}
+		}
+		hits = accepted
+	}
+	result.TotalHits = int64(len(hits))
+	from, _ := pageOf(request)
+	if len(hits) <= from {
+		return result, nil
+	}
+	collector := newPageCollector(request, func(hit reverseindex.SearchHit) rankKey {
+		return rankKey{Score: hit.Score, Id: hit.Id}
+	})
+	for _, hit := range hits {
+		collector.Push(hit)
 	}
-	docs, err := indexer.forwardIndex.BatchGet(keys)
+	hits = collector.Sorted()[from:]
+
+	keys := make([][]byte, 0, len(hits))
+	for _, hit := range hits {
+		keys = append(keys, []byte(hit.Id))
+	}
+	docs, err := indexer.batchGetDoc(ctx, keys)
 	if err != nil {
 		util.Log.Printf("read kvdb failed: %s", err)
-		return nil
+		return result, err
 	}
-	result := make([]*types.Document, 0, len(docs))
+	result.Results = make([]*types.Document, 0, len(docs))
+	result.Scores = make([]float64, 0, len(docs))
+	for i, doc := range docs {
+		if doc != nil {
+			result.Results = append(result.Results, doc)
+			result.Scores = append(result.Scores, hits[i].Score)
+		}
+	}
+	return result, nil
+}
+
+// Read documents from the forward index in the order of keys, nil for those not exist. ctx is checked before decoding
+// each document, since decoding a large page is the slowest part of a search
+func (indexer *Indexer) batchGetDoc(ctx context.Context, keys [][]byte) ([]*types.Document, error) {
+	values, err := indexer.forwardIndex.BatchGet(keys)
+	if err != nil {
+		return nil, err
+	}
+	docs := make([]*types.Document, len(values))
 	reader := bytes.NewReader([]byte{})
-	for _, docBs := range docs {
+	for i, docBs := range values {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
 		if len(docBs) > 0 {
 			reader.Reset(docBs)
 			decoder := gob.NewDecoder(reader)
 			var doc types.Document
-			err := decoder.Decode(&doc)
-			if err == nil {
-				result = append(result, &doc)
+			if err := decoder.Decode(&doc); err == nil {
+				docs[i] = &doc
 			}
 		}
 	}
-	return result
+	return docs, nil
+}
+
+// Same as GetDoc, return ctx.Err() if ctx is already done
+func (indexer *Indexer) GetDocContext(ctx context.Context, docId string) (*types.Document, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return indexer.GetDoc(docId), nil
+}
+
+// Get document by its unique Id, return nil if not exists
+func (indexer *Indexer) GetDoc(docId string) *types.Document {
+	docBs, err := indexer.forwardIndex.Get([]byte(docId))
+	if err != nil || len(docBs) == 0 {
+		return nil
+	}
+	var doc types.Document
+	if err := gob.NewDecoder(bytes.NewReader(docBs)).Decode(&doc); err != nil {
+		util.Log.Printf("gob decode document %s failed: %s", docId, err)
+		return nil
+	}
+	return &doc
+}
+
+// Get documents by their unique Ids, the documents not exist are skipped
+func (indexer *Indexer) MultiGetDoc(docIds []string) []*types.Document {
+	docs, _ := indexer.MultiGetDocContext(context.Background(), docIds)
+	return docs
+}
+
+// Same as MultiGetDoc, but give up and return ctx.Err() when ctx is done
+func (indexer *Indexer) MultiGetDocContext(ctx context.Context, docIds []string) ([]*types.Document, error) {
+	if len(docIds) == 0 {
+		return nil, nil
+	}
+	keys := make([][]byte, 0, len(docIds))
+	for _, docId := range docIds {
+		keys = append(keys, []byte(docId))
+	}
+	docs, err := indexer.batchGetDoc(ctx, keys)
+	if err != nil {
+		util.Log.Printf("read kvdb failed: %s", err)
+		return nil, err
+	}
+	result := make([]*types.Document, 0, len(docs))
+	for _, doc := range docs {
+		if doc != nil {
+			result = append(result, doc)
+		}
+	}
+	return result, nil
+}
+
+// Scan at most limit documents with Id greater than cursor in Id order, the documents for which skip returns true are
+// not returned. Return the scanned documents and the cursor of next scan, which is empty if all documents have been scanned.
+func (indexer *Indexer) ScanDoc(cursor string, limit int, skip func(docId string) bool) ([]*types.Document, string) {
+	var start []byte
+	if len(cursor) > 0 {
+		start = append([]byte(cursor), 0) //The smallest key greater than cursor
+	}
+	docs := make([]*types.Document, 0, limit)
+	scanned := 0
+	next := ""
+	reader := bytes.NewReader([]byte{})
+	indexer.forwardIndex.Seek(start, func(k, v []byte) bool {
+		if scanned >= limit {
+			return false
+		}
+		scanned++
+		next = string(k)
+		if skip != nil && skip(next) {
+			return true
+		}
+		reader.Reset(v)
+		var doc types.Document
+		if err := gob.NewDecoder(reader).Decode(&doc); err != nil {
+			util.Log.Printf("gob decode document %s failed: %s", next, err)
+			return true
+		}
+		docs = append(docs, &doc)
+		return true
+	})
+	if scanned < limit {
+		next = ""
+	}
+	return docs, next
 }
 
 // Return number of documents in index
 func (indexer *Indexer) Count() int {
-	n := 0
+	n, _ := indexer.count(context.Background(), nil)
+	return n
+}
+
+// Same as Count, but give up and return ctx.Err() when ctx is done
+func (indexer *Indexer) CountContext(ctx context.Context) (int, error) {
+	return indexer.count(ctx, nil)
+}
+
+// Count the documents for which accept returns true, all documents if accept is nil
+func (indexer *Indexer) count(ctx context.Context, accept func(docId string) bool) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	n, scanned := 0, 0
+	var err error
 	indexer.forwardIndex.IterKey(func(k []byte) error {
-		n++
-		return nil
+		if err != nil { //IterKey can't be stopped, skip the remaining keys
+			return err
+		}
+		if scanned++; scanned%reverseindex.CANCEL_CHECK_INTERVAL == 0 {
+			err = ctx.Err()
+		}
+		if err == nil && (accept == nil || accept(string(k))) {
+			n++
+		}
+		return err
 	})
-	return n
+	if err != nil {
+		return 0, err
+	}
+	return n, nil
 }
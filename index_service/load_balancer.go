@@ -2,13 +2,47 @@ package index_service
 
 import (
 	"math/rand"
+	"sync"
 	"sync/atomic"
+	"time"
+)
+
+const (
+	EWMA_ALPHA   = 0.3         // Weight of the newest latency in the EWMA latency of P2CEWMA
+	EWMA_PENALTY = time.Second // Latency recorded for a failed request by P2CEWMA
 )
 
 type LoadBalancer interface {
 	Take([]string) string
 }
 
+// Load balancer using the weights published by endpoints when they register
+type WeightedLoadBalancer interface {
+	LoadBalancer
+	SetWeights(weights map[string]int) // Replace weights of endpoints, endpoints without a positive weight use 1
+}
+
+// Load balancer choosing endpoints by load or latency, the caller reports every request sent to the endpoint taken
+type FeedbackLoadBalancer interface {
+	LoadBalancer
+	Begin(endpoint string)                                 // A request is sent to endpoint
+	End(endpoint string, latency time.Duration, err error) // The request sent to endpoint returned
+}
+
+// Report a request sent to endpoint to balancer if it's a FeedbackLoadBalancer, call the returned function with the
+// result when the request returns
+func trackRequest(balancer LoadBalancer, endpoint string) func(err error) {
+	feedback, ok := balancer.(FeedbackLoadBalancer)
+	if !ok {
+		return func(err error) {}
+	}
+	feedback.Begin(endpoint)
+	begin := time.Now()
+	return func(err error) {
+		feedback.End(endpoint, time.Since(begin), err)
+	}
+}
+
 // RoundRobin Algorithm For Load Balancer
 type RoundRobin struct {
 	acc int64
@@ -34,3 +68,177 @@ func (b *RandomSelect) Take(endpoints []string) string {
 	index := rand.Intn(len(endpoints))
 	return endpoints[index]
 }
+
+// Take the first endpoint, keeping the order given by the caller
+type firstEndpoint struct {
+}
+
+func (b firstEndpoint) Take(endpoints []string) string {
+	if len(endpoints) == 0 {
+		return ""
+	}
+	return endpoints[0]
+}
+
+// Smooth Weighted RoundRobin Algorithm For Load Balancer. An endpoint with weight 3 is taken 3 times as often as an
+// endpoint with weight 1, and the takes are interleaved instead of in bursts.
+type WeightedRoundRobin struct {
+	lock    sync.Mutex
+	weights map[string]int
+	current map[string]int // Current weight of endpoints
+}
+
+func (b *WeightedRoundRobin) SetWeights(weights map[string]int) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.weights = make(map[string]int, len(weights))
+	for endpoint, weight := range weights {
+		b.weights[endpoint] = weight
+	}
+	for endpoint := range b.current { //离开的节点不再保留当前权重
+		if _, exists := weights[endpoint]; !exists {
+			delete(b.current, endpoint)
+		}
+	}
+}
+
+func (b *WeightedRoundRobin) Take(endpoints []string) string {
+	if len(endpoints) == 0 {
+		return ""
+	}
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if b.current == nil {
+		b.current = make(map[string]int, len(endpoints))
+	}
+	best, total := "", 0
+	for _, endpoint := range endpoints {
+		weight := b.weights[endpoint]
+		if weight <= 0 {
+			weight = 1
+		}
+		total += weight
+		b.current[endpoint] += weight
+		if best == "" || b.current[endpoint] > b.current[best] {
+			best = endpoint
+		}
+	}
+	b.current[best] -= total
+	return best
+}
+
+// Least Outstanding Requests Algorithm For Load Balancer. Take the endpoint with the fewest requests in flight,
+// endpoints with the same number of requests are taken in turn.
+type LeastOutstanding struct {
+	lock        sync.Mutex
+	outstanding map[string]int
+	acc         int
+}
+
+func (b *LeastOutstanding) Take(endpoints []string) string {
+	if len(endpoints) == 0 {
+		return ""
+	}
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.acc++
+	best := ""
+	for i := range endpoints {
+		endpoint := endpoints[(b.acc+i)%len(endpoints)]
+		if best == "" || b.outstanding[endpoint] < b.outstanding[best] {
+			best = endpoint
+		}
+	}
+	return best
+}
+
+func (b *LeastOutstanding) Begin(endpoint string) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if b.outstanding == nil {
+		b.outstanding = make(map[string]int)
+	}
+	b.outstanding[endpoint]++
+}
+
+func (b *LeastOutstanding) End(endpoint string, latency time.Duration, err error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if b.outstanding[endpoint] > 1 {
+		b.outstanding[endpoint]--
+	} else {
+		delete(b.outstanding, endpoint)
+	}
+}
+
+type endpointLoad struct {
+	ewma        float64 // EWMA of latencies in nanoseconds, 0 if no request has returned
+	outstanding int
+}
+
+// Power of Two Choices Algorithm For Load Balancer. Pick two endpoints randomly and take the one with lower cost,
+// which is the EWMA latency multiplied by the requests in flight. Failed requests count as EWMA_PENALTY.
+type P2CEWMA struct {
+	lock  sync.Mutex
+	loads map[string]*endpointLoad
+}
+
+func (b *P2CEWMA) load(endpoint string) *endpointLoad {
+	if b.loads == nil {
+		b.loads = make(map[string]*endpointLoad)
+	}
+	load, exists := b.loads[endpoint]
+	if !exists {
+		load = &endpointLoad{}
+		b.loads[endpoint] = load
+	}
+	return load
+}
+
+func (b *P2CEWMA) cost(endpoint string) float64 {
+	load := b.load(endpoint)
+	return (load.ewma + 1) * float64(load.outstanding+1) //没有延迟数据的节点代价最低，尽快探测新节点
+}
+
+func (b *P2CEWMA) Take(endpoints []string) string {
+	switch len(endpoints) {
+	case 0:
+		return ""
+	case 1:
+		return endpoints[0]
+	}
+	i := rand.Intn(len(endpoints))
+	j := rand.Intn(len(endpoints) - 1)
+	if j >= i {
+		j++
+	}
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if b.cost(endpoints[j]) < b.cost(endpoints[i]) {
+		return endpoints[j]
+	}
+	return endpoints[i]
+}
+
+func (b *P2CEWMA) Begin(endpoint string) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.load(endpoint).outstanding++
+}
+
+func (b *P2CEWMA) End(endpoint string, latency time.Duration, err error) {
+	if err != nil && latency < EWMA_PENALTY {
+		latency = EWMA_PENALTY
+	}
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	load := b.load(endpoint)
+	if load.outstanding > 0 {
+		load.outstanding--
+	}
+	if load.ewma == 0 {
+		load.ewma = float64(latency)
+	} else {
+		load.ewma = EWMA_ALPHA*float64(latency) + (1-EWMA_ALPHA)*load.ewma
+	}
+}
@@ -0,0 +1,267 @@
+package index_service
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"github.com/kisaragi77/TinyES/types"
+)
+
+// Default number of documents returned by _search
+const DEFAULT_SEARCH_SIZE = 10
+
+// Body of _search and _count, in the flavour of Elasticsearch.
+//
+//	{
+//	  "query": {"bool": {"must": [{"term": {"category": "phone"}}], "must_not": [{"term": {"brand": "acme"}}]}},
+//	  "on_flag": 1, "off_flag": 2, "or_flags": [4, 8],
+//	  "from": 0, "size": 10, "sort": [{"_score": "desc"}, "_id"]
+//	}
+type searchBody struct {
+	Query   json.RawMessage   `json:"query"`
+	OnFlag  uint64            `json:"on_flag"`
+	OffFlag uint64            `json:"off_flag"`
+	OrFlags []uint64          `json:"or_flags"`
+	From    int32             `json:"from"`
+	Size    *int32            `json:"size"` // DEFAULT_SEARCH_SIZE if not set, all documents if <= 0
+	Sort    []json.RawMessage `json:"sort"`
+}
+
+// Convert the body to SearchRequest
+func (body *searchBody) toSearchRequest() (*SearchRequest, error) {
+	query, err := parseQueryDSL(body.Query)
+	if err != nil {
+		return nil, err
+	}
+	request := &SearchRequest{
+		Query:    query,
+		OnFlag:   body.OnFlag,
+		OffFlag:  body.OffFlag,
+		OrFlags:  body.OrFlags,
+		From:     body.From,
+		PageSize: DEFAULT_SEARCH_SIZE,
+	}
+	if body.Size != nil {
+		request.PageSize = *body.Size
+	}
+	for _, raw := range body.Sort {
+		spec, err := parseSortDSL(raw)
+		if err != nil {
+			return nil, err
+		}
+		request.Sort = append(request.Sort, spec)
+	}
+	return request, nil
+}
+
+// Body of a bool query. Should clauses together with must clauses are required as a group, at least
+// minimum_should_match(1 by default) of them must match.
+type boolQueryDSL struct {
+	Must               json.RawMessage `json:"must"`
+	Should             json.RawMessage `json:"should"`
+	MustNot            json.RawMessage `json:"must_not"`
+	MinimumShouldMatch int32           `json:"minimum_should_match"`
+	Boost              float32         `json:"boost"`
+}
+
+// Parse the query DSL into TermQuery. Supported querys:
+//
+//	{"term": {"title": "go"}}, {"term": {"title": {"value": "go", "boost": 2}}}
+//	{"bool": {"must": [...], "should": [...], "must_not": [...], "minimum_should_match": 2, "boost": 2}}
+//	{"query_string": {"query": "(title:go | title:rust) & author:pike -lang:java"}}
+func parseQueryDSL(raw json.RawMessage) (*types.TermQuery, error) {
+	if len(bytes.TrimSpace(raw)) == 0 {
+		return nil, fmt.Errorf("query is required")
+	}
+	var clause map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &clause); err != nil {
+		return nil, fmt.Errorf("invalid query: %w", err)
+	}
+	if len(clause) != 1 {
+		return nil, fmt.Errorf("query should have exactly one clause, got %d", len(clause))
+	}
+	for name, body := range clause {
+		switch name {
+		case "term":
+			return parseTermDSL(body)
+		case "bool":
+			return parseBoolDSL(body)
+		case "query_string":
+			var qs struct {
+				Query string `json:"query"`
+			}
+			if err := json.Unmarshal(body, &qs); err != nil {
+				return nil, fmt.Errorf("invalid query_string: %w", err)
+			}
+			return types.ParseTermQuery(qs.Query)
+		default:
+			return nil, fmt.Errorf("unknown query [%s]", name)
+		}
+	}
+	return nil, nil
+}
+
+func parseTermDSL(raw json.RawMessage) (*types.TermQuery, error) {
+	var term map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &term); err != nil {
+		return nil, fmt.Errorf("invalid term query: %w", err)
+	}
+	if len(term) != 1 {
+		return nil, fmt.Errorf("term query should have exactly one field, got %d", len(term))
+	}
+	for field, value := range term {
+		var word string
+		if err := json.Unmarshal(value, &word); err == nil {
+			return types.NewTermQuery(field, word), nil
+		}
+		var detail struct {
+			Value string  `json:"value"`
+			Boost float32 `json:"boost"`
+		}
+		if err := json.Unmarshal(value, &detail); err != nil {
+			return nil, fmt.Errorf("invalid term query on field [%s]: %w", field, err)
+		}
+		return types.NewTermQuery(field, detail.Value).WithBoost(detail.Boost), nil
+	}
+	return nil, nil
+}
+
+func parseBoolDSL(raw json.RawMessage) (*types.TermQuery, error) {
+	var dsl boolQueryDSL
+	if err := json.Unmarshal(raw, &dsl); err != nil {
+		return nil, fmt.Errorf("invalid bool query: %w", err)
+	}
+	must, err := parseClausesDSL(dsl.Must)
+	if err != nil {
+		return nil, err
+	}
+	should, err := parseClausesDSL(dsl.Should)
+	if err != nil {
+		return nil, err
+	}
+	mustNot, err := parseClausesDSL(dsl.MustNot)
+	if err != nil {
+		return nil, err
+	}
+	query := &types.TermQuery{MustNot: mustNot, Boost: dsl.Boost}
+	if len(must) > 0 {
+		if len(should) > 0 {
+			must = append(must, (&types.TermQuery{Should: should}).WithMinimumShouldMatch(int(dsl.MinimumShouldMatch)))
+		}
+		query.Must = must
+	} else {
+		query.Should = should
+		query.MinimumShouldMatch = dsl.MinimumShouldMatch
+	}
+	return query, nil
+}
+
+// A clause list can be an array or a single query
+func parseClausesDSL(raw json.RawMessage) ([]*types.TermQuery, error) {
+	raw = bytes.TrimSpace(raw)
+	if len(raw) == 0 || bytes.Equal(raw, []byte("null")) {
+		return nil, nil
+	}
+	var raws []json.RawMessage
+	if raw[0] == '[' {
+		if err := json.Unmarshal(raw, &raws); err != nil {
+			return nil, fmt.Errorf("invalid clauses: %w", err)
+		}
+	} else {
+		raws = []json.RawMessage{raw}
+	}
+	querys := make([]*types.TermQuery, 0, len(raws))
+	for _, raw := range raws {
+		q, err := parseQueryDSL(raw)
+		if err != nil {
+			return nil, err
+		}
+		querys = append(querys, q)
+	}
+	return querys, nil
+}
+
+// Parse a sort spec like "_score", {"_id": "desc"} or {"_id": {"order": "desc"}}
+func parseSortDSL(raw json.RawMessage) (*SortSpec, error) {
+	var field, order string
+	if err := json.Unmarshal(raw, &field); err != nil {
+		var spec map[string]json.RawMessage
+		if err := json.Unmarshal(raw, &spec); err != nil || len(spec) != 1 {
+			return nil, fmt.Errorf("invalid sort %s", string(raw))
+		}
+		for f, o := range spec {
+			field = f
+			if err := json.Unmarshal(o, &order); err != nil {
+				var detail struct {
+					Order string `json:"order"`
+				}
+				if err := json.Unmarshal(o, &detail); err != nil {
+					return nil, fmt.Errorf("invalid sort order of [%s]", f)
+				}
+				order = detail.Order
+			}
+		}
+	}
+	spec := &SortSpec{}
+	switch field {
+	case "_score":
+		spec.By = SortBy_SCORE
+	case "_id":
+		spec.By = SortBy_ID
+	default:
+		return nil, fmt.Errorf("can't sort by [%s], only _score and _id are supported", field)
+	}
+	switch order {
+	case "":
+		spec.Order = SortOrder_DEFAULT
+	case "asc":
+		spec.Order = SortOrder_ASC
+	case "desc":
+		spec.Order = SortOrder_DESC
+	default:
+		return nil, fmt.Errorf("invalid sort order [%s]", order)
+	}
+	return spec, nil
+}
+
+// Document in JSON, bytes are encoded in base64
+type jsonDocument struct {
+	Id          string         `json:"id,omitempty"`
+	BitsFeature uint64         `json:"bits_feature,omitempty"`
+	Keywords    []*jsonKeyword `json:"keywords,omitempty"`
+	Bytes       []byte         `json:"bytes,omitempty"`
+}
+
+type jsonKeyword struct {
+	Field string `json:"field"`
+	Word  string `json:"word"`
+}
+
+func (doc *jsonDocument) toDocument() types.Document {
+	result := types.Document{
+		Id:          doc.Id,
+		BitsFeature: doc.BitsFeature,
+		Keywords:    make([]*types.Keyword, 0, len(doc.Keywords)),
+		Bytes:       doc.Bytes,
+	}
+	for _, kw := range doc.Keywords {
+		if kw != nil {
+			result.Keywords = append(result.Keywords, &types.Keyword{Field: kw.Field, Word: kw.Word})
+		}
+	}
+	return result
+}
+
+func newJsonDocument(doc *types.Document) *jsonDocument {
+	result := &jsonDocument{
+		Id:          doc.Id,
+		BitsFeature: doc.BitsFeature,
+		Keywords:    make([]*jsonKeyword, 0, len(doc.Keywords)),
+		Bytes:       doc.Bytes,
+	}
+	for _, kw := range doc.Keywords {
+		result.Keywords = append(result.Keywords, &jsonKeyword{Field: kw.Field, Word: kw.Word})
+	}
+	return result
+}
@@ -0,0 +1,294 @@
+package index_service
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kisaragi77/TinyES/util"
+	"golang.org/x/time/rate"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+const (
+	REBALANCE_BATCH_SIZE      = 100  // Max number of documents scanned by one Scan RPC
+	REBALANCE_DOCS_PER_SECOND = 1000 // Default max number of documents moved per second
+	REBALANCE_MAX_RETRY       = 5    // A source is given up after so many consecutive failures
+
+	REBALANCE_DELAY = 30 * time.Second // Default delay of Sentinel between a change of the hash ring and the rebalance
+
+	MOVED_DOC_METADATA = "tinyes-moved-doc" // Set in grpc metadata when Rebalancer deletes a moved document from its source
+)
+
+// Provide grpc connections to index workers, implemented by Sentinel
+type grpcConnPool interface {
+	GetGrpcConn(endpoint string) *grpc.ClientConn
+}
+
+// Progress of moving documents out of a worker
+type SourceProgress struct {
+	Endpoint string
+	Cursor   string // Documents with Id <= Cursor have been scanned
+	Moved    int64  // Number of documents moved to their new owners
+	Done     bool
+	Error    string // The last error, empty if no error
+}
+
+// Progress of a rebalance
+type RebalanceProgress struct {
+	Epoch     int64    // Increased by 1 for each new rebalance, not increased when resumed
+	Endpoints []string // Endpoints of the new hash ring
+	Sources   []SourceProgress
+	Running   bool
+	StartTime time.Time
+	EndTime   time.Time // Zero if still running
+}
+
+// Whether all sources are done
+func (progress *RebalanceProgress) Finished() bool {
+	for _, source := range progress.Sources {
+		if !source.Done {
+			return false
+		}
+	}
+	return true
+}
+
+// Move documents to their owners on the consistent hash ring when index workers join or leave.
+//
+// Each source worker is scanned in Id order, the documents it shouldn't store are imported to their new replicas
+// (without overwriting a newer version written by clients), then deleted from the source. The throughput is throttled by a
+// rate limiter, and the scan cursor of each source is kept, so an interrupted rebalance resumes where it stopped
+// when started again with the same endpoints.
+type Rebalancer struct {
+	conns     grpcConnPool
+	limiter   *rate.Limiter
+	batchSize int
+	replicas  int // Replication factor, each document is moved to all its replicas
+
+	lock     sync.Mutex // Guard progress, cancel and done
+	progress *RebalanceProgress
+	cancel   context.CancelFunc
+	done     chan struct{}
+}
+
+// docsPerSecond : Max number of documents moved per second
+func NewRebalancer(conns grpcConnPool, docsPerSecond int) *Rebalancer {
+	return &Rebalancer{
+		conns:     conns,
+		limiter:   rate.NewLimiter(rate.Limit(docsPerSecond), REBALANCE_BATCH_SIZE),
+		batchSize: REBALANCE_BATCH_SIZE,
+		replicas:  1,
+		progress:  &RebalanceProgress{},
+	}
+}
+
+func (r *Rebalancer) WithReplicas(replicas int) *Rebalancer {
+	r.replicas = replicas
+	return r
+}
+
+// Move the documents on sources to their owners on the hash ring of endpoints, in background.
+//
+// A running rebalance is stopped first. If the last rebalance was for the same endpoints and not finished, it is resumed.
+func (r *Rebalancer) Start(sources []string, endpoints []string) {
+	r.Stop()
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	endpoints = sortedCopy(endpoints)
+	last := r.progress
+	progress := &RebalanceProgress{Epoch: last.Epoch + 1, Endpoints: endpoints, Running: true, StartTime: time.Now()}
+	resumed := make(map[string]SourceProgress)
+	if strings.Join(last.Endpoints, ",") == strings.Join(endpoints, ",") && !last.Finished() {
+		progress.Epoch = last.Epoch
+		for _, source := range last.Sources {
+			source.Error = ""
+			resumed[source.Endpoint] = source
+		}
+	}
+	for _, endpoint := range sortedCopy(sources) {
+		if source, exists := resumed[endpoint]; exists {
+			progress.Sources = append(progress.Sources, source)
+		} else {
+			progress.Sources = append(progress.Sources, SourceProgress{Endpoint: endpoint})
+		}
+	}
+	r.progress = progress
+
+	ctx, cancel := context.WithCancel(context.Background())
+	r.cancel = cancel
+	r.done = make(chan struct{})
+	go r.run(ctx, progress, r.done)
+}
+
+// Resume the last rebalance if it's not finished
+func (r *Rebalancer) Resume() {
+	r.lock.Lock()
+	last := r.progress
+	r.lock.Unlock()
+	if len(last.Endpoints) > 0 && !last.Finished() {
+		sources := make([]string, 0, len(last.Sources))
+		for _, source := range last.Sources {
+			sources = append(sources, source.Endpoint)
+		}
+		r.Start(sources, last.Endpoints)
+	}
+}
+
+// Stop the running rebalance and wait for it to exit. It can be resumed later
+func (r *Rebalancer) Stop() {
+	r.lock.Lock()
+	cancel, done := r.cancel, r.done
+	r.lock.Unlock()
+	if cancel != nil {
+		cancel()
+		<-done
+	}
+}
+
+// Wait for the running rebalance to exit
+func (r *Rebalancer) Wait() {
+	r.lock.Lock()
+	done := r.done
+	r.lock.Unlock()
+	if done != nil {
+		<-done
+	}
+}
+
+// Snapshot of the progress of the current(or the last) rebalance
+func (r *Rebalancer) Progress() RebalanceProgress {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	progress := *r.progress
+	progress.Endpoints = append([]string{}, r.progress.Endpoints...)
+	progress.Sources = append([]SourceProgress{}, r.progress.Sources...)
+	return progress
+}
+
+func (r *Rebalancer) run(ctx context.Context, progress *RebalanceProgress, done chan struct{}) {
+	defer close(done)
+	util.Log.Printf("rebalance %d start, move documents from %d workers to ring %v", progress.Epoch, len(progress.Sources), progress.Endpoints)
+	ring := NewConsistentHash(progress.Endpoints, VIRTUAL_NODES)
+	wg := sync.WaitGroup{}
+	for i := range progress.Sources {
+		if progress.Sources[i].Done {
+			continue
+		}
+		wg.Add(1)
+		go func(i int) { //各个source并行地迁移，共用一个限流器
+			defer wg.Done()
+			r.moveFrom(ctx, progress, i, ring)
+		}(i)
+	}
+	wg.Wait()
+
+	r.lock.Lock()
+	progress.Running = false
+	progress.EndTime = time.Now()
+	if r.done == done {
+		r.cancel, r.done = nil, nil
+	}
+	r.lock.Unlock()
+	for _, source := range r.Progress().Sources {
+		util.Log.Printf("rebalance %d, moved %d documents from %s, done %t %s", progress.Epoch, source.Moved, source.Endpoint, source.Done, source.Error)
+	}
+}
+
+// Move the documents not owned by the i-th source to their owners, batch by batch
+func (r *Rebalancer) moveFrom(ctx context.Context, progress *RebalanceProgress, i int, ring *ConsistentHash) {
+	r.lock.Lock()
+	source := progress.Sources[i]
+	r.lock.Unlock()
+	update := func() {
+		r.lock.Lock()
+		progress.Sources[i] = source
+		r.lock.Unlock()
+	}
+
+	failures := 0
+	for !source.Done && ctx.Err() == nil {
+		moved, next, err := r.moveBatch(ctx, source.Endpoint, source.Cursor, ring)
+		source.Moved += int64(moved)
+		if err != nil {
+			if ctx.Err() != nil {
+				break
+			}
+			failures++
+			source.Error = err.Error()
+			update()
+			if failures >= REBALANCE_MAX_RETRY {
+				util.Log.Printf("give up moving documents from %s after %d failures: %s", source.Endpoint, failures, err)
+				return
+			}
+			select { //指数退避后从cursor处重试
+			case <-time.After(time.Duration(100<<failures) * time.Millisecond):
+			case <-ctx.Done():
+			}
+			continue
+		}
+		failures = 0
+		source.Error = ""
+		source.Cursor = next
+		source.Done = len(next) == 0
+		update()
+	}
+}
+
+// Scan a batch of documents from source after cursor, move those not stored by source on the new ring. Return number of documents
+// deleted from source and the next cursor. The cursor is not advanced unless all documents in the batch are moved.
+func (r *Rebalancer) moveBatch(ctx context.Context, source string, cursor string, ring *ConsistentHash) (int, string, error) {
+	conn := r.conns.GetGrpcConn(source)
+	if conn == nil {
+		return 0, cursor, fmt.Errorf("connect to worker %s failed", source)
+	}
+	client := NewIndexServiceClient(conn)
+	result, err := client.Scan(ctx, &ScanRequest{Cursor: cursor, Limit: int32(r.batchSize), Endpoints: ring.Endpoints(), Owner: source, Replicas: int32(r.replicas)})
+	if err != nil {
+		return 0, cursor, err
+	}
+	if len(result.Docs) == 0 {
+		return 0, result.NextCursor, nil
+	}
+	if err := r.limiter.WaitN(ctx, len(result.Docs)); err != nil {
+		return 0, cursor, err
+	}
+
+	groups := make(map[string]*Documents) // new replica -> documents
+	for _, doc := range result.Docs {
+		for _, replica := range ring.GetN(doc.Id, r.replicas) {
+			if _, exists := groups[replica]; !exists {
+				groups[replica] = &Documents{}
+			}
+			groups[replica].Docs = append(groups[replica].Docs, doc)
+		}
+	}
+	for replica, docs := range groups {
+		conn := r.conns.GetGrpcConn(replica)
+		if conn == nil {
+			return 0, cursor, fmt.Errorf("connect to worker %s failed", replica)
+		}
+		if _, err := NewIndexServiceClient(conn).ImportDoc(ctx, docs); err != nil {
+			return 0, cursor, err
+		}
+	}
+	// 都导入到新的副本之后才从source上删除。标记为迁移，source不留墓碑，以后还能迁回来
+	moved := metadata.AppendToOutgoingContext(ctx, MOVED_DOC_METADATA, "1")
+	for i, doc := range result.Docs {
+		if _, err := client.DeleteDoc(moved, &DocId{doc.Id}); err != nil {
+			return i, cursor, err
+		}
+	}
+	return len(result.Docs), result.NextCursor, nil
+}
+
+func sortedCopy(ss []string) []string {
+	result := append([]string{}, ss...)
+	sort.Strings(result)
+	return result
+}
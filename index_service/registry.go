@@ -0,0 +1,263 @@
+package index_service
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/kisaragi77/TinyES/util"
+)
+
+// Endpoints of services kept in memory, shared by the registries not backed by etcd
+type localRegistry struct {
+	lock         sync.RWMutex
+	services     map[string]map[string]EndpointInfo    // Service -> endpoint -> metadata
+	listeners    map[string][]func(endpoints []string) // Service -> callbacks on endpoints change
+	loadBalancer LoadBalancer
+}
+
+func newLocalRegistry(options []HubOption) *localRegistry {
+	return &localRegistry{
+		services:     make(map[string]map[string]EndpointInfo),
+		listeners:    make(map[string][]func(endpoints []string)),
+		loadBalancer: newHubOptions(options).loadBalancer,
+	}
+}
+
+// Replace the endpoints of service, which are taken as ready
+func (registry *localRegistry) set(service string, endpoints []string) {
+	registry.update(service, func(infos map[string]EndpointInfo) {
+		for endpoint := range infos {
+			delete(infos, endpoint)
+		}
+		for _, endpoint := range endpoints {
+			infos[endpoint] = EndpointInfo{Endpoint: endpoint, Ready: true}
+		}
+	})
+}
+
+// Change the endpoints of service atomically, and call the listeners if the endpoints or their metadata changed
+func (registry *localRegistry) update(service string, change func(infos map[string]EndpointInfo)) {
+	registry.lock.Lock()
+	old := registry.services[service]
+	infos := make(map[string]EndpointInfo, len(old))
+	for endpoint, info := range old {
+		infos[endpoint] = info
+	}
+	change(infos)
+	if reflect.DeepEqual(old, infos) || len(old) == 0 && len(infos) == 0 {
+		registry.lock.Unlock()
+		return
+	}
+	if len(infos) > 0 {
+		registry.services[service] = infos
+	} else {
+		delete(registry.services, service)
+	}
+	if weighted, ok := registry.loadBalancer.(WeightedLoadBalancer); ok {
+		weighted.SetWeights(endpointWeights(registry.infos(service)))
+	}
+	endpoints := filterEndpoints(registry.infos(service), nil)
+	listeners := registry.listeners[service]
+	registry.lock.Unlock()
+	util.Log.Printf("Refresh Service %s Server -- %v\n", service, endpoints)
+	for _, fn := range listeners {
+		fn(endpoints)
+	}
+}
+
+// Metadata of endpoints of service, sorted by endpoint. The lock must be held
+func (registry *localRegistry) infos(service string) []EndpointInfo {
+	infos := make([]EndpointInfo, 0, len(registry.services[service]))
+	for _, info := range registry.services[service] {
+		infos = append(infos, info)
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Endpoint < infos[j].Endpoint })
+	return infos
+}
+
+func (registry *localRegistry) GetServiceEndpoints(service string) []string {
+	return filterEndpoints(registry.GetServiceEndpointInfos(service), nil)
+}
+
+func (registry *localRegistry) GetServiceEndpointInfos(service string) []EndpointInfo {
+	registry.lock.RLock()
+	defer registry.lock.RUnlock()
+	return registry.infos(service)
+}
+
+func (registry *localRegistry) GetServiceEndpoint(service string) string {
+	return registry.loadBalancer.Take(registry.GetServiceEndpoints(service))
+}
+
+// Report a request sent to the endpoint chosen by GetServiceEndpoint, see ServiceHub.Track
+func (registry *localRegistry) Track(endpoint string) func(err error) {
+	return trackRequest(registry.loadBalancer, endpoint)
+}
+
+func (registry *localRegistry) getLoadBalancer() LoadBalancer {
+	return registry.loadBalancer
+}
+
+// Register a callback, which is called with the latest endpoints when endpoints of the service or their metadata change
+func (registry *localRegistry) OnEndpointsChange(service string, fn func(endpoints []string)) {
+	registry.lock.Lock()
+	defer registry.lock.Unlock()
+	registry.listeners[service] = append(registry.listeners[service], fn)
+}
+
+// In-process registry, workers and Sentinel in the same process share it. Used in tests instead of etcd.
+type MemoryHub struct {
+	*localRegistry
+	leaseID int64
+}
+
+func NewMemoryHub(options ...HubOption) *MemoryHub {
+	return &MemoryHub{localRegistry: newLocalRegistry(options)}
+}
+
+// Register service. There is no lease expiration, endpoint stays until UnRegist
+func (hub *MemoryHub) Regist(service string, endpoint string, leaseID int64) (int64, error) {
+	return hub.RegistWithInfo(service, endpoint, leaseID, nil)
+}
+
+// Same as Regist, and publish the metadata of endpoint. nil info keeps the published metadata
+func (hub *MemoryHub) RegistWithInfo(service string, endpoint string, leaseID int64, info *EndpointInfo) (int64, error) {
+	if leaseID <= 0 {
+		leaseID = atomic.AddInt64(&hub.leaseID, 1)
+	}
+	hub.update(service, func(infos map[string]EndpointInfo) {
+		if info != nil {
+			published := *info
+			published.Endpoint = endpoint
+			infos[endpoint] = published
+		} else if _, exists := infos[endpoint]; !exists {
+			infos[endpoint] = EndpointInfo{Endpoint: endpoint, Ready: true}
+		}
+	})
+	return leaseID, nil
+}
+
+func (hub *MemoryHub) UnRegist(service string, endpoint string) error {
+	hub.update(service, func(infos map[string]EndpointInfo) {
+		delete(infos, endpoint)
+	})
+	return nil
+}
+
+// The hub may be shared by several workers and Sentinels, so closing it does nothing
+func (hub *MemoryHub) Close() {}
+
+// Registry with a fixed endpoint list of each service
+type StaticHub struct {
+	*localRegistry
+}
+
+// services : Service -> endpoints
+func NewStaticHub(services map[string][]string, options ...HubOption) *StaticHub {
+	hub := &StaticHub{localRegistry: newLocalRegistry(options)}
+	for service, endpoints := range services {
+		hub.set(service, endpoints)
+	}
+	return hub
+}
+
+// The endpoints are fixed, registering does nothing
+func (hub *StaticHub) Regist(service string, endpoint string, leaseID int64) (int64, error) {
+	return leaseID, nil
+}
+
+// The endpoints are fixed, unregistering does nothing
+func (hub *StaticHub) UnRegist(service string, endpoint string) error { return nil }
+
+func (hub *StaticHub) Close() {}
+
+// Registry reading endpoints from a local JSON file like {"index_service": ["127.0.0.1:5678", "127.0.0.1:5679"]}.
+// The file is checked every interval and listeners are called when the endpoints in it change.
+type FileHub struct {
+	*localRegistry
+	path    string
+	modTime time.Time
+	size    int64
+	stop    chan struct{}
+	once    sync.Once
+}
+
+// The file must exist and be valid when the hub is created. Later a broken file is logged and the last endpoints are kept.
+func NewFileHub(path string, interval time.Duration, options ...HubOption) (*FileHub, error) {
+	hub := &FileHub{localRegistry: newLocalRegistry(options), path: path, stop: make(chan struct{})}
+	if err := hub.reload(); err != nil {
+		return nil, err
+	}
+	if interval <= 0 {
+		interval = time.Second
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := hub.reload(); err != nil {
+					util.Log.Printf("reload registry file %s failed: %s", path, err)
+				}
+			case <-hub.stop:
+				return
+			}
+		}
+	}()
+	return hub, nil
+}
+
+// Read the file again if it has been modified
+func (hub *FileHub) reload() error {
+	info, err := os.Stat(hub.path)
+	if err != nil {
+		return err
+	}
+	if info.ModTime().Equal(hub.modTime) && info.Size() == hub.size {
+		return nil
+	}
+	content, err := os.ReadFile(hub.path)
+	if err != nil {
+		return err
+	}
+	services := make(map[string][]string)
+	if err := json.Unmarshal(content, &services); err != nil {
+		return fmt.Errorf("invalid registry file %s: %w", hub.path, err)
+	}
+	hub.modTime, hub.size = info.ModTime(), info.Size()
+	hub.lock.RLock()
+	removed := make([]string, 0)
+	for service := range hub.services {
+		if _, exists := services[service]; !exists {
+			removed = append(removed, service)
+		}
+	}
+	hub.lock.RUnlock()
+	for _, service := range removed {
+		hub.set(service, nil)
+	}
+	for service, endpoints := range services {
+		hub.set(service, endpoints)
+	}
+	return nil
+}
+
+// The endpoints are maintained by editing the file, registering does nothing
+func (hub *FileHub) Regist(service string, endpoint string, leaseID int64) (int64, error) {
+	return leaseID, nil
+}
+
+// The endpoints are maintained by editing the file, unregistering does nothing
+func (hub *FileHub) UnRegist(service string, endpoint string) error { return nil }
+
+// Stop watching the file
+func (hub *FileHub) Close() {
+	hub.once.Do(func() { close(hub.stop) })
+}
@@ -0,0 +1,257 @@
+package index_service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/kisaragi77/TinyES/util"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	LATENCY_WINDOW      = 1000 // Number of recent latencies kept for each RPC method
+	LATENCY_MIN_SAMPLES = 20   // MaxDelay of HedgePolicy is used until so many latencies are observed
+)
+
+// Returned by an attempt when the connection to the worker can't be established
+var ErrConnectFailed = errors.New("connect to worker failed")
+
+// Returned for a shard whose replicas are all registered but still loading index
+var ErrNoReadyReplica = errors.New("no replica is ready")
+
+// Retry policy of idempotent RPCs (Search, Count, GetDoc, MultiGetDoc).
+//
+// A failed attempt fails over to the next replica immediately. When all replicas failed with retryable errors,
+// they are tried again after an exponential backoff, at most MaxRetries times.
+type RetryPolicy struct {
+	MaxRetries     int           // Max number of retries after all replicas failed, 0 disables retrying
+	InitialBackoff time.Duration // Backoff before the first retry, 50ms if 0
+	MaxBackoff     time.Duration // Upper bound of backoff, 1s if 0
+	Multiplier     float64       // Backoff grows by Multiplier after each retry, 2 if <= 1
+}
+
+// Backoff before the n-th retry(starting from 1), with jitter of ±20%
+func (policy RetryPolicy) backoff(n int) time.Duration {
+	backoff, max, multiplier := policy.InitialBackoff, policy.MaxBackoff, policy.Multiplier
+	if backoff <= 0 {
+		backoff = 50 * time.Millisecond
+	}
+	if max <= 0 {
+		max = time.Second
+	}
+	if multiplier <= 1 {
+		multiplier = 2
+	}
+	for i := 1; i < n && backoff < max; i++ {
+		backoff = time.Duration(float64(backoff) * multiplier)
+	}
+	if backoff > max {
+		backoff = max
+	}
+	return time.Duration(float64(backoff) * (0.8 + 0.4*rand.Float64()))
+}
+
+// Hedging policy of idempotent RPCs.
+//
+// If a replica hasn't answered within the Percentile latency of the RPC method, the same request is sent to the next
+// replica, the first response is taken and the others are canceled.
+type HedgePolicy struct {
+	Percentile float64       // Percentile of recent latencies used as hedging delay, 0.95 if not in (0, 1)
+	MinDelay   time.Duration // Lower bound of hedging delay
+	MaxDelay   time.Duration // Upper bound of hedging delay, 1s if 0
+	MaxHedges  int           // Max number of extra requests sent for one call, 1 if 0
+}
+
+// Delay of hedging computed from the recent latencies
+func (policy HedgePolicy) delay(latencies *latencyTracker) time.Duration {
+	percentile, max := policy.Percentile, policy.MaxDelay
+	if percentile <= 0 || percentile >= 1 {
+		percentile = 0.95
+	}
+	if max <= 0 {
+		max = time.Second
+	}
+	delay, ok := latencies.Percentile(percentile)
+	if !ok || delay > max {
+		delay = max
+	}
+	if delay < policy.MinDelay {
+		delay = policy.MinDelay
+	}
+	return delay
+}
+
+func (policy HedgePolicy) maxHedges() int {
+	if policy.MaxHedges <= 0 {
+		return 1
+	}
+	return policy.MaxHedges
+}
+
+// Latencies of the recent successful calls of a RPC method
+type latencyTracker struct {
+	lock    sync.Mutex
+	samples []time.Duration // Ring buffer
+	next    int
+}
+
+func newLatencyTracker() *latencyTracker {
+	return &latencyTracker{samples: make([]time.Duration, 0, LATENCY_WINDOW)}
+}
+
+func (tracker *latencyTracker) Observe(latency time.Duration) {
+	tracker.lock.Lock()
+	defer tracker.lock.Unlock()
+	if len(tracker.samples) < LATENCY_WINDOW {
+		tracker.samples = append(tracker.samples, latency)
+		return
+	}
+	tracker.samples[tracker.next] = latency
+	tracker.next = (tracker.next + 1) % LATENCY_WINDOW
+}
+
+// The p-th percentile of recent latencies, false if there are not enough samples
+func (tracker *latencyTracker) Percentile(p float64) (time.Duration, bool) {
+	tracker.lock.Lock()
+	if len(tracker.samples) < LATENCY_MIN_SAMPLES {
+		tracker.lock.Unlock()
+		return 0, false
+	}
+	sorted := append([]time.Duration{}, tracker.samples...)
+	tracker.lock.Unlock()
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	return sorted[int(p*float64(len(sorted)-1))], true
+}
+
+// Whether the worker may succeed if the request is sent again
+func retryable(err error) bool {
+	if errors.Is(err, ErrConnectFailed) {
+		return true
+	}
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded, codes.ResourceExhausted, codes.Aborted:
+		return true
+	}
+	return false
+}
+
+// Result of calling an idempotent RPC on the replicas
+type invocation[T any] struct {
+	result   T
+	endpoint string           // The replica answered, empty if all failed
+	failures map[string]error // Failed replicas, including those still running when ctx is done
+	err      error            // nil if one of the replicas answered
+}
+
+// Call an idempotent RPC on candidates with the retry and hedging policy of sentinel, return the first success. Only the
+// ready candidates are called, the first is chosen by the load balancer of sentinel, then the others are tried in order.
+// Returns as soon as ctx is done, without waiting for the running attempts.
+func invoke[T any](ctx context.Context, sentinel *Sentinel, method string, candidates []string, call func(ctx context.Context, client IndexServiceClient) (T, error)) *invocation[T] {
+	inv := &invocation[T]{failures: make(map[string]error)}
+	if len(candidates) == 0 {
+		inv.err = fmt.Errorf("there is no alive index worker")
+		return inv
+	}
+	if candidates = sentinel.readyReplicas(candidates); len(candidates) == 0 {
+		inv.err = ErrNoReadyReplica
+		return inv
+	}
+	candidates = sentinel.orderReplicas(candidates)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel() //取消还在运行的对冲请求
+
+	type reply struct {
+		endpoint string
+		result   T
+		err      error
+	}
+	replies := make(chan reply)
+	latencies := sentinel.latencies(method)
+	running := make(map[string]bool) // 正在运行的请求
+	launched := 0                    // 本轮已经发往了几个副本
+	launch := func() {
+		endpoint := candidates[launched%len(candidates)]
+		launched++
+		running[endpoint] = true
+		go func() {
+			r := reply{endpoint: endpoint}
+			begin := time.Now()
+			done := sentinel.track(endpoint)
+			if client, err := sentinel.getClient(endpoint); err != nil {
+				r.err = err
+			} else {
+				r.result, r.err = call(ctx, client)
+				sentinel.report(ctx, endpoint, r.err)
+			}
+			done(r.err)
+			if r.err == nil {
+				latencies.Observe(time.Since(begin))
+			}
+			select {
+			case replies <- r:
+			case <-ctx.Done():
+			}
+		}()
+	}
+
+	hedges, retries := 0, 0
+	var hedge <-chan time.Time
+	resetHedge := func() {
+		hedge = nil
+		if sentinel.hedgePolicy != nil && hedges < sentinel.hedgePolicy.maxHedges() && launched < len(candidates) {
+			hedge = time.After(sentinel.hedgePolicy.delay(latencies))
+		}
+	}
+	launch()
+	resetHedge()
+	for {
+		select {
+		case r := <-replies:
+			delete(running, r.endpoint)
+			if r.err == nil {
+				inv.result, inv.endpoint, inv.err = r.result, r.endpoint, nil
+				delete(inv.failures, r.endpoint) //重试之后成功了
+				return inv
+			}
+			util.Log.Printf("%s on worker %s failed: %s", method, r.endpoint, r.err)
+			inv.failures[r.endpoint], inv.err = r.err, r.err
+			if launched < len(candidates) { //换下一个副本
+				launch()
+				resetHedge()
+				continue
+			}
+			if len(running) > 0 { //等待还在运行的对冲请求
+				continue
+			}
+			if sentinel.retryPolicy == nil || retries >= sentinel.retryPolicy.MaxRetries || !retryable(r.err) {
+				return inv
+			}
+			retries++
+			select { //所有副本都失败了，指数退避后再试一遍
+			case <-time.After(sentinel.retryPolicy.backoff(retries)):
+			case <-ctx.Done():
+				inv.err = ctx.Err()
+				return inv
+			}
+			launched, hedges = 0, 0
+			launch()
+			resetHedge()
+		case <-hedge:
+			hedges++
+			launch()
+			resetHedge()
+		case <-ctx.Done():
+			for endpoint := range running {
+				inv.failures[endpoint] = ctx.Err()
+			}
+			inv.err = ctx.Err()
+			return inv
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package index_service
+
+import "github.com/kisaragi77/TinyES/util"
+
+// Key to rank a document in search results
+type rankKey struct {
+	Score float64
+	Id    string
+}
+
+// Return a function reporting whether a ranks before b under the sort specs.
+//
+// Ties are broken by Id, so that each worker and the sentinel agree on the same total order.
+func rankLess(specs []*SortSpec) func(a, b rankKey) bool {
+	if len(specs) == 0 {
+		specs = []*SortSpec{{By: SortBy_SCORE}}
+	}
+	return func(a, b rankKey) bool {
+		for _, spec := range specs {
+			var cmp int
+			switch spec.By {
+			case SortBy_ID:
+				cmp = compareString(a.Id, b.Id)
+			default:
+				cmp = -compareFloat(a.Score, b.Score) // Higher score first by default
+			}
+			if spec.By == SortBy_ID && spec.Order == SortOrder_DESC || spec.By != SortBy_ID && spec.Order == SortOrder_ASC {
+				cmp = -cmp
+			}
+			if cmp != 0 {
+				return cmp < 0
+			}
+		}
+		return a.Id < b.Id
+	}
+}
+
+func compareFloat(a, b float64) int {
+	if a < b {
+		return -1
+	} else if a > b {
+		return 1
+	}
+	return 0
+}
+
+func compareString(a, b string) int {
+	if a < b {
+		return -1
+	} else if a > b {
+		return 1
+	}
+	return 0
+}
+
+// Return offset and limit of the requested page. limit <= 0 means no limit.
+func pageOf(request *SearchRequest) (from int, size int) {
+	from = int(request.From)
+	if from < 0 {
+		from = 0
+	}
+	size = int(request.PageSize)
+	if size < 0 {
+		size = 0
+	}
+	return
+}
+
+// Collect the best documents of the requested page(From+PageSize documents at most)
+func newPageCollector[T any](request *SearchRequest, key func(T) rankKey) *util.TopK[T] {
+	from, size := pageOf(request)
+	k := 0
+	if size > 0 {
+		k = from + size
+	}
+	less := rankLess(request.Sort)
+	return util.NewTopK(k, func(a, b T) bool {
+		return less(key(a), key(b))
+	})
+}
@@ -12,43 +12,122 @@ import (
 )
 
 const (
-	SERVICE_ROOT_PATH = "/tinyes/index" //Prefix of etcd key
+	SERVICE_ROOT_PATH = "/tinyes/index" //Default prefix of etcd key
 )
 
 // Service Registry Center
 type ServiceHub struct {
 	client             *etcdv3.Client //etcd client
+	rootPath           string         //Prefix of etcd key
 	heartbeatFrequency int64          //Time Interval of Renewal Lease
 	watched            sync.Map       //Watched Services
-	loadBalancer       LoadBalancer   // Strategy of Load Balancing (RoundRobin/RandomSelect)
+	published          sync.Map       //etcd key -> value written by Regist, to write again only when metadata changes
+	loadBalancer       LoadBalancer   // Strategy of Load Balancing (RoundRobin/RandomSelect/WeightedRoundRobin/LeastOutstanding/P2CEWMA)
 }
 
-var (
-	serviceHub *ServiceHub // Single Instance of ServiceHub (Private)
-	hubOnce    sync.Once   //(Using sync.Once to ensure thread safety)
-)
+type hubOptions struct {
+	etcdServers  []string
+	rootPath     string
+	heartbeat    int64
+	qps          int
+	staleAfter   time.Duration
+	loadBalancer LoadBalancer
+}
 
-// Constructor of ServiceHub (Return serviceHub Public)
-func GetServiceHub(etcdServers []string, heartbeatFrequency int64) *ServiceHub {
-	if serviceHub == nil {
-		hubOnce.Do(func() {
-			if client, err := etcdv3.New(
-				etcdv3.Config{
-					Endpoints:   etcdServers,
-					DialTimeout: 3 * time.Second,
-				},
-			); err != nil {
-				util.Log.Fatalf("Can't connect to etcd server: %v", err) //When log.Fatal occurs, the go process will exit directly
-			} else {
-				serviceHub = &ServiceHub{
-					client:             client,
-					heartbeatFrequency: heartbeatFrequency, // The Validity Period of Lease
-					loadBalancer:       &RoundRobin{},
-				}
-			}
-		})
+// Option of ServiceHub and HubProxy. Registries not backed by etcd only use WithLoadBalancer
+type HubOption func(options *hubOptions)
+
+// Address of etcd servers, 127.0.0.1:2379 if empty
+func WithEtcdServers(etcdServers []string) HubOption {
+	return func(options *hubOptions) {
+		if len(etcdServers) > 0 {
+			options.etcdServers = etcdServers
+		}
+	}
+}
+
+// Prefix of etcd key, SERVICE_ROOT_PATH by default. Clusters sharing the same etcd use different root paths
+func WithRootPath(rootPath string) HubOption {
+	return func(options *hubOptions) {
+		options.rootPath = rootPath
+	}
+}
+
+// The Validity Period of Lease in seconds, 3 by default
+func WithHeartbeat(heartbeatFrequency int64) HubOption {
+	return func(options *hubOptions) {
+		options.heartbeat = heartbeatFrequency
+	}
+}
+
+// Max requests per second from HubProxy to etcd, 100 by default
+func WithRateLimit(qps int) HubOption {
+	return func(options *hubOptions) {
+		options.qps = qps
 	}
-	return serviceHub
+}
+
+// HubProxy revalidates the cached endpoints of a service if they haven't been synced with etcd for so long,
+// 1 minute by default. The stale endpoints are still served while revalidating
+func WithStaleAfter(staleAfter time.Duration) HubOption {
+	return func(options *hubOptions) {
+		options.staleAfter = staleAfter
+	}
+}
+
+// Strategy of load balancing used by GetServiceEndpoint, RoundRobin by default
+func WithLoadBalancer(loadBalancer LoadBalancer) HubOption {
+	return func(options *hubOptions) {
+		options.loadBalancer = loadBalancer
+	}
+}
+
+func newHubOptions(options []HubOption) *hubOptions {
+	opts := &hubOptions{
+		etcdServers:  []string{"127.0.0.1:2379"},
+		rootPath:     SERVICE_ROOT_PATH,
+		heartbeat:    3,
+		qps:          100,
+		staleAfter:   time.Minute,
+		loadBalancer: &RoundRobin{},
+	}
+	for _, option := range options {
+		option(opts)
+	}
+	return opts
+}
+
+// Constructor of ServiceHub. Each ServiceHub has its own etcd client, call Close when it's no longer used
+func NewServiceHub(options ...HubOption) (*ServiceHub, error) {
+	return newServiceHub(newHubOptions(options))
+}
+
+func newServiceHub(opts *hubOptions) (*ServiceHub, error) {
+	client, err := etcdv3.New(
+		etcdv3.Config{
+			Endpoints:   opts.etcdServers,
+			DialTimeout: 3 * time.Second,
+		},
+	)
+	if err != nil {
+		util.Log.Printf("Can't connect to etcd server: %v", err)
+		return nil, err
+	}
+	return &ServiceHub{
+		client:             client,
+		rootPath:           strings.TrimRight(opts.rootPath, "/"),
+		heartbeatFrequency: opts.heartbeat, // The Validity Period of Lease
+		loadBalancer:       opts.loadBalancer,
+	}, nil
+}
+
+func (hub *ServiceHub) leaseSeconds() int64 {
+	return hub.heartbeatFrequency
+}
+
+// Prefix of etcd keys of service
+func (hub *ServiceHub) servicePrefix(service string) string {
+	return hub.rootPath + "/" + service + "/"
 }
 
 // Register Service. The first time you register, write a key to etcd, and then renew lease
@@ -58,37 +137,57 @@ func GetServiceHub(etcdServers []string, heartbeatFrequency int64) *ServiceHub {
 // endpoint : Address of service
 //
 // leaseID : LeaseID of service, Initial value is 0
-func (hub *ServiceHub) Regist(service string, endpoint string, leaseID etcdv3.LeaseID) (etcdv3.LeaseID, error) {
+func (hub *ServiceHub) Regist(service string, endpoint string, leaseID int64) (int64, error) {
+	return hub.RegistWithInfo(service, endpoint, leaseID, nil)
+}
+
+// Same as Regist, and publish the metadata of endpoint. The value is written again when info changes,
+// nil info keeps the published metadata(an empty value if never published)
+func (hub *ServiceHub) RegistWithInfo(service string, endpoint string, leaseID int64, info *EndpointInfo) (int64, error) {
 	ctx := context.Background()
+	key := hub.servicePrefix(service) + endpoint
+	value := ""
+	if info != nil {
+		value = info.encode()
+	} else if v, exists := hub.published.Load(key); exists {
+		value = v.(string)
+	}
 	if leaseID <= 0 {
 		if lease, err := hub.client.Grant(ctx, hub.heartbeatFrequency); err != nil {
 			util.Log.Printf("Failed to Create Lease: %v", err)
 			return 0, err
 		} else {
-			key := strings.TrimRight(SERVICE_ROOT_PATH, "/") + "/" + service + "/" + endpoint
-			if _, err = hub.client.Put(ctx, key, "", etcdv3.WithLease(lease.ID)); err != nil {
+			if _, err = hub.client.Put(ctx, key, value, etcdv3.WithLease(lease.ID)); err != nil {
 				util.Log.Printf("Cannot Write to Service %s At Node %s: %v", service, endpoint, err)
-				return lease.ID, err
+				return int64(lease.ID), err
 			} else {
-				return lease.ID, nil
+				hub.published.Store(key, value)
+				return int64(lease.ID), nil
 			}
 		}
 	} else {
-		if _, err := hub.client.KeepAliveOnce(ctx, leaseID); err == rpctypes.ErrLeaseNotFound {
-			return hub.Regist(service, endpoint, 0)
+		if _, err := hub.client.KeepAliveOnce(ctx, etcdv3.LeaseID(leaseID)); err == rpctypes.ErrLeaseNotFound {
+			return hub.RegistWithInfo(service, endpoint, 0, info)
 		} else if err != nil {
 			util.Log.Printf("Renew Lease Failed: %v", err)
 			return 0, err
-		} else {
-			return leaseID, nil
 		}
+		if old, exists := hub.published.Load(key); !exists || old.(string) != value { //元数据变了，重新写入
+			if _, err := hub.client.Put(ctx, key, value, etcdv3.WithLease(etcdv3.LeaseID(leaseID))); err != nil {
+				util.Log.Printf("Cannot Write to Service %s At Node %s: %v", service, endpoint, err)
+				return leaseID, err
+			}
+			hub.published.Store(key, value)
+		}
+		return leaseID, nil
 	}
 }
 
 // Unregister Service
 func (hub *ServiceHub) UnRegist(service string, endpoint string) error {
 	ctx := context.Background()
-	key := strings.TrimRight(SERVICE_ROOT_PATH, "/") + "/" + service + "/" + endpoint
+	key := hub.servicePrefix(service) + endpoint
+	hub.published.Delete(key)
 	if _, err := hub.client.Delete(ctx, key); err != nil {
 		util.Log.Printf("Failed to Unregister Service %s At Node %s: %v", service, endpoint, err)
 		return err
@@ -102,20 +201,41 @@ func (hub *ServiceHub) UnRegist(service string, endpoint string) error {
 //
 // The client queries etcd to obtain a set of servers, and then selects a server before RPC calls.
 func (hub *ServiceHub) GetServiceEndpoints(service string) []string {
-	ctx := context.Background()
-	prefix := strings.TrimRight(SERVICE_ROOT_PATH, "/") + "/" + service + "/"
-	if resp, err := hub.client.Get(ctx, prefix, etcdv3.WithPrefix()); err != nil { //Get all nodes under the prefix
+	return filterEndpoints(hub.GetServiceEndpointInfos(service), nil)
+}
+
+// Service Discovery with the metadata published by endpoints
+func (hub *ServiceHub) GetServiceEndpointInfos(service string) []EndpointInfo {
+	infos, _, err := hub.loadEndpointInfos(context.Background(), service)
+	if err != nil {
 		util.Log.Printf("Failed to Get Nodes of Service %s: %v", service, err)
 		return nil
-	} else {
-		endpoints := make([]string, 0, len(resp.Kvs))
-		for _, kv := range resp.Kvs {
-			path := strings.Split(string(kv.Key), "/")
-			endpoints = append(endpoints, path[len(path)-1])
-		}
-		util.Log.Printf("Refresh Service %s Server -- %v\n", service, endpoints)
-		return endpoints
 	}
+	return infos
+}
+
+// Read the metadata of endpoints of service from etcd, and the revision of etcd when they are read
+func (hub *ServiceHub) loadEndpointInfos(ctx context.Context, service string) ([]EndpointInfo, int64, error) {
+	prefix := hub.servicePrefix(service)
+	resp, err := hub.client.Get(ctx, prefix, etcdv3.WithPrefix()) //Get all nodes under the prefix
+	if err != nil {
+		return nil, 0, err
+	}
+	infos := make([]EndpointInfo, 0, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		infos = append(infos, parseEndpointInfo(endpointOfKey(kv.Key), kv.Value))
+	}
+	if weighted, ok := hub.loadBalancer.(WeightedLoadBalancer); ok {
+		weighted.SetWeights(endpointWeights(infos))
+	}
+	util.Log.Printf("Refresh Service %s Server -- %v\n", service, filterEndpoints(infos, nil))
+	return infos, resp.Header.Revision, nil
+}
+
+// The last part of etcd key is the endpoint
+func endpointOfKey(key []byte) string {
+	path := strings.Split(string(key), "/")
+	return path[len(path)-1]
 }
 
 // Select a serveraccording to load balancing
@@ -123,6 +243,16 @@ func (hub *ServiceHub) GetServiceEndpoint(service string) string {
 	return hub.loadBalancer.Take(hub.GetServiceEndpoints(service))
 }
 
+// Report a request sent to the endpoint chosen by GetServiceEndpoint, call the returned function with the result when
+// the request returns. Required by the load balancers choosing endpoints by load or latency (LeastOutstanding/P2CEWMA).
+func (hub *ServiceHub) Track(endpoint string) func(err error) {
+	return trackRequest(hub.loadBalancer, endpoint)
+}
+
+func (hub *ServiceHub) getLoadBalancer() LoadBalancer {
+	return hub.loadBalancer
+}
+
 // Close etcd client connection
 func (hub *ServiceHub) Close() {
 	hub.client.Close()
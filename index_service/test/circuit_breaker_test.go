@@ -0,0 +1,131 @@
+package test
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kisaragi77/TinyES/index_service"
+	"github.com/kisaragi77/TinyES/types"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	breakers := index_service.NewCircuitBreakers(index_service.CircuitBreakerConfig{FailureThreshold: 3, OpenTimeout: 100 * time.Millisecond})
+	const endpoint = "127.0.0.1:1"
+	expect := func(state index_service.BreakerState) {
+		if got := breakers.Status(endpoint).State; got != state {
+			t.Errorf("expect %s, got %s", state, got)
+		}
+	}
+	breakers.Failure(endpoint)
+	breakers.Failure(endpoint)
+	expect(index_service.BREAKER_CLOSED)
+	breakers.Failure(endpoint) //连续失败3次后熔断
+	expect(index_service.BREAKER_OPEN)
+	if breakers.Allow(endpoint) {
+		t.Errorf("open breaker should reject requests")
+	}
+
+	// 超时之后只放过一个探测请求，探测失败则重新熔断
+	time.Sleep(100 * time.Millisecond)
+	if !breakers.Allow(endpoint) || breakers.Allow(endpoint) {
+		t.Errorf("half-open breaker should allow exactly one probe")
+	}
+	expect(index_service.BREAKER_HALF_OPEN)
+	breakers.Failure(endpoint)
+	expect(index_service.BREAKER_OPEN)
+
+	// 探测成功则恢复
+	time.Sleep(100 * time.Millisecond)
+	balancer := &index_service.BreakerBalancer{LoadBalancer: &index_service.RoundRobin{}, Breakers: breakers}
+	if !breakers.Allow(endpoint) || balancer.Take([]string{endpoint, "127.0.0.1:2"}) != "127.0.0.1:2" {
+		t.Errorf("load balancer should skip the endpoint being probed")
+	}
+	breakers.Success(endpoint)
+	expect(index_service.BREAKER_CLOSED)
+	if !breakers.Allow(endpoint) {
+		t.Errorf("closed breaker should allow requests")
+	}
+}
+
+func TestSentinelCircuitBreaker(t *testing.T) {
+	const port = 5750
+	endpoint := fmt.Sprintf("127.0.0.1:%d", port)
+	sentinel := newSentinel(t, index_service.WithServiceHub(staticHub([]string{endpoint})),
+		index_service.WithCircuitBreaker(index_service.CircuitBreakerConfig{FailureThreshold: 2, OpenTimeout: 300 * time.Millisecond}))
+	defer sentinel.Close()
+
+	// worker没启动，连续2次连接失败后熔断，之后不再建连接
+	for i := 0; i < 2; i++ {
+		sentinel.GetDoc("doc")
+	}
+	if status := sentinel.BreakerStatuses()[endpoint]; status.State != index_service.BREAKER_OPEN || status.Failures != 2 {
+		t.Errorf("breaker should be open, got %+v", status)
+	}
+	begin := time.Now()
+	if _, err := sentinel.GetDocContext(context.Background(), "doc"); err == nil || time.Since(begin) > 50*time.Millisecond {
+		t.Errorf("request should be rejected immediately, got %v after %s", err, time.Since(begin))
+	}
+
+	// worker启动后，探测成功，熔断恢复
+	worker, server := startLocalWorker(t, port)
+	defer worker.Close()
+	defer server.Stop()
+	worker.Indexer.AddDoc(types.Document{Id: "doc"})
+	time.Sleep(300 * time.Millisecond)
+	if doc := sentinel.GetDoc("doc"); doc == nil {
+		t.Errorf("probe should succeed")
+	}
+	if status := sentinel.BreakerStatuses()[endpoint]; status.State != index_service.BREAKER_CLOSED {
+		t.Errorf("breaker should be closed, got %+v", status)
+	}
+}
+
+// 记录每次从哪些节点中选择的LoadBalancer，总是选第一个
+type recordingBalancer struct {
+	lock  sync.Mutex
+	takes [][]string
+}
+
+func (b *recordingBalancer) Take(endpoints []string) string {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.takes = append(b.takes, append([]string{}, endpoints...))
+	return endpoints[0]
+}
+
+// 熔断的副本不参与负载均衡
+func TestBreakerBalancedReplicas(t *testing.T) {
+	dead := "127.0.0.1:5751"
+	worker, server := startLocalWorker(t, 5752)
+	defer worker.Close()
+	defer server.Stop()
+	live := "127.0.0.1:5752"
+	worker.Indexer.AddDoc(types.Document{Id: "doc"})
+	balancer := &recordingBalancer{}
+	hub := index_service.NewStaticHub(map[string][]string{index_service.INDEX_SERVICE: {dead, live}}, index_service.WithLoadBalancer(balancer))
+	sentinel := newSentinel(t, index_service.WithServiceHub(hub), index_service.WithReplicationFactor(2),
+		index_service.WithCircuitBreaker(index_service.CircuitBreakerConfig{FailureThreshold: 1, OpenTimeout: time.Minute}))
+	defer sentinel.Close()
+
+	for i := 0; i < 3; i++ {
+		if doc := sentinel.GetDoc("doc"); doc == nil {
+			t.Fatal("doc should be found on the live replica")
+		}
+	}
+	if status := sentinel.BreakerStatuses()[dead]; status.State != index_service.BREAKER_OPEN {
+		t.Fatalf("breaker of %s should be open, got %+v", dead, status)
+	}
+	balancer.lock.Lock()
+	defer balancer.lock.Unlock()
+	last := balancer.takes[len(balancer.takes)-1]
+	if len(last) != 1 || last[0] != live {
+		t.Errorf("only %s should be balanced, got %v", live, last)
+	}
+}
+
+// go test -v ./index_service/test -run=^TestCircuitBreaker$ -count=1
+// go test -v ./index_service/test -run=^TestSentinelCircuitBreaker$ -count=1
+// go test -v ./index_service/test -run=^TestBreakerBalancedReplicas$ -count=1
@@ -0,0 +1,153 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kisaragi77/TinyES/index_service"
+	"github.com/kisaragi77/TinyES/types"
+	"google.golang.org/grpc"
+)
+
+// 统计文档数很慢的worker
+type slowWorker struct {
+	index_service.UnimplementedIndexServiceServer
+	delay time.Duration
+}
+
+func (worker *slowWorker) Count(ctx context.Context, request *index_service.CountRequest) (*index_service.AffectedCount, error) {
+	select {
+	case <-time.After(worker.delay):
+	case <-ctx.Done():
+	}
+	return &index_service.AffectedCount{Count: 1}, nil
+}
+
+func TestClusterCount(t *testing.T) {
+	ports := []int{5720, 5721, 5722}
+	endpoints := make([]string, 0, len(ports))
+	stop := make(map[string]func(), len(ports))
+	for _, port := range ports {
+		worker, server := startLocalWorker(t, port)
+		defer worker.Close()
+		defer server.Stop()
+		endpoint := "127.0.0.1:" + strconv.Itoa(port)
+		endpoints = append(endpoints, endpoint)
+		stop[endpoint] = server.Stop
+	}
+	sentinel := newSentinel(t, index_service.WithServiceHub(staticHub(endpoints)), index_service.WithReplicationFactor(2))
+	defer sentinel.Close()
+
+	const N = 30
+	for i := 0; i < N; i++ {
+		if _, err := sentinel.AddDoc(types.Document{Id: fmt.Sprintf("doc%02d", i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 每个doc有2个副本，但只被计数一次
+	result := sentinel.ClusterCount(context.Background())
+	fmt.Printf("%+v\n", result)
+	if result.Total != N || !result.Complete() || len(result.Failures) > 0 {
+		t.Errorf("expect %d documents, got %+v", N, result)
+	}
+	if sentinel.Count() != N {
+		t.Errorf("expect %d documents, got %d", N, sentinel.Count())
+	}
+
+	// 一台worker宕机后，它负责的分片由其他副本统计，访问过宕机的worker时结果里报告它。先访问哪个副本由负载均衡决定，多统计几次
+	down := endpoints[1]
+	stop[down]()
+	reported := false
+	for i := 0; i < 4; i++ {
+		result = sentinel.ClusterCount(context.Background())
+		fmt.Printf("%+v\n", result)
+		if result.Total != N || !result.Complete() {
+			t.Errorf("expect %d documents, got %+v", N, result)
+		}
+		if _, failed := result.Failures[down]; failed {
+			reported = true
+		}
+	}
+	if !reported {
+		t.Errorf("failure of %s should be reported", down)
+	}
+
+	// 超时的worker不再等待
+	lis, err := net.Listen("tcp", "127.0.0.1:5723")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := grpc.NewServer()
+	index_service.RegisterIndexServiceServer(server, &slowWorker{delay: 5 * time.Second})
+	go server.Serve(lis)
+	defer server.Stop()
+	slow := "127.0.0.1:5723"
+	sentinel2 := newSentinel(t, index_service.WithServiceHub(staticHub([]string{endpoints[0], slow})))
+	defer sentinel2.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	begin := time.Now()
+	result = sentinel2.ClusterCount(ctx)
+	fmt.Printf("%+v, use time %s\n", result, time.Since(begin))
+	if time.Since(begin) > 2*time.Second {
+		t.Errorf("count should return at the deadline")
+	}
+	if len(result.TimedOut) != 1 || result.TimedOut[0] != slow || result.Complete() || result.FailedShards[0] != slow {
+		t.Errorf("%s should time out, got %+v", slow, result)
+	}
+	if _, counted := result.Workers[endpoints[0]]; !counted {
+		t.Errorf("%s should be counted", endpoints[0])
+	}
+}
+
+func TestIncompleteResult(t *testing.T) {
+	ports := []int{5724, 5725}
+	endpoints := make([]string, 0, len(ports))
+	stop := make(map[string]func(), len(ports))
+	for _, port := range ports {
+		worker, server := startLocalWorker(t, port)
+		defer worker.Close()
+		defer server.Stop()
+		endpoint := "127.0.0.1:" + strconv.Itoa(port)
+		endpoints = append(endpoints, endpoint)
+		stop[endpoint] = server.Stop
+	}
+	sentinel := newSentinel(t, index_service.WithServiceHub(staticHub(endpoints)))
+	defer sentinel.Close()
+	const N = 30
+	docIds := make([]string, 0, N)
+	for i := 0; i < N; i++ {
+		docIds = append(docIds, fmt.Sprintf("doc%02d", i))
+		if _, err := sentinel.AddDoc(types.Document{Id: docIds[i]}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 只有一个副本的分片宕机后，结果不完整，返回的错误里列出失败的分片
+	down := endpoints[1]
+	stop[down]()
+	n, err := sentinel.CountContext(context.Background())
+	if !errors.Is(err, index_service.ErrShardsFailed) || !strings.Contains(err.Error(), down) || n >= N {
+		t.Errorf("count should fail on shard %s, got %d %v", down, n, err)
+	}
+	docs, err := sentinel.MultiGetDocContext(context.Background(), docIds)
+	if !errors.Is(err, index_service.ErrShardsFailed) || !strings.Contains(err.Error(), down) || len(docs) >= N {
+		t.Errorf("multi get should fail on shard %s, got %d documents %v", down, len(docs), err)
+	}
+	recorder := httptest.NewRecorder()
+	index_service.NewHttpServer(sentinel).ServeHTTP(recorder, httptest.NewRequest("GET", "/_count", nil))
+	if recorder.Code != http.StatusServiceUnavailable {
+		t.Errorf("expect status 503, got %d %s", recorder.Code, recorder.Body.String())
+	}
+}
+
+// go test -v ./index_service/test -run=^TestClusterCount$ -count=1
+// go test -v ./index_service/test -run=^TestIncompleteResult$ -count=1
@@ -0,0 +1,55 @@
+package test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/kisaragi77/TinyES/index_service"
+)
+
+func TestConsistentHash(t *testing.T) {
+	const N = 30000
+	nodes := []string{"127.0.0.1:5600", "127.0.0.1:5601", "127.0.0.1:5602"}
+	ring := index_service.NewConsistentHash(nodes, index_service.VIRTUAL_NODES)
+	if !ring.Same([]string{"127.0.0.1:5602", "127.0.0.1:5600", "127.0.0.1:5601"}) {
+		t.Errorf("ring should be the same regardless of the order of endpoints")
+	}
+
+	owners := make(map[string]string, N)
+	count := make(map[string]int, len(nodes))
+	for i := 0; i < N; i++ {
+		key := fmt.Sprintf("doc%d", i)
+		owner := ring.Get(key)
+		if owner != ring.Get(key) {
+			t.Fatalf("owner of %s is not stable", key)
+		}
+		owners[key] = owner
+		count[owner]++
+	}
+	for node, c := range count {
+		fmt.Println(node, c)
+		if c < N/len(nodes)*7/10 || c > N/len(nodes)*13/10 { //虚拟节点保证数据大体均匀
+			t.Errorf("%s owns %d keys, too unbalanced", node, c)
+		}
+	}
+
+	// 加入一个节点，只有被新节点接管的key会移动
+	newNode := "127.0.0.1:5603"
+	ring = index_service.NewConsistentHash(append(nodes, newNode), index_service.VIRTUAL_NODES)
+	moved := 0
+	for key, owner := range owners {
+		if newOwner := ring.Get(key); newOwner != owner {
+			moved++
+			if newOwner != newNode {
+				t.Errorf("%s moved from %s to %s", key, owner, newOwner)
+			}
+		}
+	}
+	fmt.Printf("%d of %d keys moved\n", moved, N)
+
+	if index_service.NewConsistentHash(nil, index_service.VIRTUAL_NODES).Get("doc") != "" {
+		t.Errorf("empty ring should own nothing")
+	}
+}
+
+// go test -v ./index_service/test -run=^TestConsistentHash$ -count=1
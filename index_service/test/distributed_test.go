@@ -1,6 +1,7 @@
 package test
 
 import (
+	"context"
 	"fmt"
 	"net"
 	"strconv"
@@ -18,10 +19,13 @@ var (
 	workPorts   = []int{5678, 5679, 5660}
 	etcdServers = []string{"127.0.0.1:2379"}
 	workers     []*index_service.IndexServiceWorker
+	servers     []*grpc.Server
+	clusterHub  = index_service.NewMemoryHub() // workers和sentinel在同一个进程里，不依赖etcd
 )
 
 func StartWorkers() {
 	workers = make([]*index_service.IndexServiceWorker, 0, len(workPorts))
+	servers = make([]*grpc.Server, 0, len(workPorts))
 	for i, port := range workPorts {
 		lis, err := net.Listen("tcp", "127.0.0.1:"+strconv.Itoa(port))
 		if err != nil {
@@ -31,25 +35,27 @@ func StartWorkers() {
 		server := grpc.NewServer()
 		service := new(index_service.IndexServiceWorker)
 		service.Init(50000, kvdb.BADGER, util.RootPath+"data/local_db/book_badger_"+strconv.Itoa(i))
-		service.Indexer.LoadFromIndexFile()
 		index_service.RegisterIndexServiceServer(server, service)
-		service.Regist(etcdServers, port)
+		service.Host = "127.0.0.1"
+		service.RegistHub(clusterHub, port)
+		service.LoadFromIndexFile() //加载期间注册为未就绪，sentinel不会把请求发过来
+		workers = append(workers, service)
+		servers = append(servers, server)
 		go func(port int) {
 			fmt.Printf("start grpc server on port %d\n", port)
-			err = server.Serve(lis)
-			if err != nil {
-				service.Close()
+			if err := server.Serve(lis); err != nil {
 				fmt.Printf("start grpc server on port %d failed: %s\n", port, err)
-			} else {
-				workers = append(workers, service)
 			}
 		}(port)
 	}
 }
 
+// 先注销，等正在处理的请求结束后再关闭索引
 func StopWorkers() {
-	for _, worker := range workers {
-		worker.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	for i, worker := range workers {
+		worker.Shutdown(ctx, servers[i])
 	}
 }
 
@@ -58,7 +64,7 @@ func TestIndexCluster(t *testing.T) {
 	time.Sleep(3 * time.Second)
 	defer StopWorkers()
 
-	sentinel := index_service.NewSentinel(etcdServers)
+	sentinel := newSentinel(t, index_service.WithServiceHub(clusterHub))
 	book := Book{
 		ISBN:    "436246383",
 		Title:   "上下五千年",
@@ -81,16 +87,16 @@ func TestIndexCluster(t *testing.T) {
 	}
 	query := types.NewTermQuery("content", "文物")
 	query = query.And(types.NewTermQuery("content", "唐朝"))
-	docs := sentinel.Search(query, 0, 0, nil)
+	result := sentinel.Search(&index_service.SearchRequest{Query: query})
 	if err != nil {
 		fmt.Println(err)
 		t.Fail()
 	} else {
 		docId := ""
-		if len(docs) == 0 {
+		if len(result.Results) == 0 {
 			fmt.Println("无搜索结果")
 		} else {
-			for _, doc := range docs {
+			for _, doc := range result.Results {
 				book := DeserializeBook(doc.Bytes)
 				if book != nil {
 					fmt.Printf("%s %s %s %s %.1f\n", doc.Id, book.ISBN, book.Title, book.Author, book.Price)
@@ -103,11 +109,11 @@ func TestIndexCluster(t *testing.T) {
 			fmt.Printf("删除%d个doc\n", n)
 		}
 
-		docs := sentinel.Search(query, 0, 0, nil)
-		if len(docs) == 0 {
+		result := sentinel.Search(&index_service.SearchRequest{Query: query})
+		if len(result.Results) == 0 {
 			fmt.Println("无搜索结果")
 		} else {
-			for _, doc := range docs {
+			for _, doc := range result.Results {
 				book := DeserializeBook(doc.Bytes)
 				if book != nil {
 					fmt.Printf("%s %s %s %s %.1f\n", doc.Id, book.ISBN, book.Title, book.Author, book.Price)
@@ -0,0 +1,160 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/kisaragi77/TinyES/index_service"
+	"github.com/kisaragi77/TinyES/util"
+)
+
+// Send a request to the http server, decode the json response into result
+func httpDo(t *testing.T, method, url, body string, result any) int {
+	request, err := http.NewRequest(method, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	bs, _ := io.ReadAll(resp.Body)
+	fmt.Printf("%s %s %d %s", method, url, resp.StatusCode, string(bs))
+	if result != nil {
+		if err := json.Unmarshal(bs, result); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return resp.StatusCode
+}
+
+func TestHttpServer(t *testing.T) {
+	path := util.RootPath + "data/local_db/http_badger"
+	os.RemoveAll(path)
+	indexer := new(index_service.Indexer)
+	if err := indexer.Init(100, dbType, path); err != nil {
+		t.Fatal(err)
+	}
+	defer indexer.Close()
+	server := httptest.NewServer(index_service.NewHttpServer(indexer))
+	defer server.Close()
+
+	httpDo(t, "PUT", server.URL+"/_doc/1", `{"bits_feature": 1, "keywords": [{"field": "category", "word": "phone"}, {"field": "brand", "word": "acme"}]}`, nil)
+	bulk := `{"index": {"_id": "2"}}
+{"keywords": [{"field": "category", "word": "phone"}, {"field": "brand", "word": "other"}], "bytes": "aGVsbG8="}
+{"index": {"_id": "3"}}
+{"keywords": [{"field": "category", "word": "phone"}]}
+{"index": {"_id": "4"}}
+{"keywords": [{"field": "category", "word": "tablet"}]}
+{"delete": {"_id": "4"}}
+`
+	var bulkResult struct {
+		Errors bool             `json:"errors"`
+		Items  []map[string]any `json:"items"`
+	}
+	httpDo(t, "POST", server.URL+"/_bulk", bulk, &bulkResult)
+	if bulkResult.Errors || len(bulkResult.Items) != 4 {
+		t.Errorf("unexpected bulk result %v", bulkResult)
+	}
+
+	var searchResult struct {
+		Hits struct {
+			Total int64 `json:"total"`
+			Hits  []struct {
+				Id     string  `json:"_id"`
+				Score  float64 `json:"_score"`
+				Source struct {
+					Bytes []byte `json:"bytes"`
+				} `json:"_source"`
+			} `json:"hits"`
+		} `json:"hits"`
+	}
+	query := `{"query": {"bool": {"must": {"term": {"category": "phone"}}, "must_not": [{"term": {"brand": "acme"}}]}}, "sort": ["_id"]}`
+	httpDo(t, "POST", server.URL+"/_search", query, &searchResult)
+	if searchResult.Hits.Total != 2 || len(searchResult.Hits.Hits) != 2 || searchResult.Hits.Hits[0].Id != "2" || string(searchResult.Hits.Hits[0].Source.Bytes) != "hello" {
+		t.Errorf("unexpected search result %v", searchResult)
+	}
+	query = `{"query": {"query_string": {"query": "category:phone -brand:acme"}}, "size": 1}`
+	httpDo(t, "POST", server.URL+"/_search", query, &searchResult)
+	if searchResult.Hits.Total != 2 || len(searchResult.Hits.Hits) != 1 {
+		t.Errorf("unexpected search result %v", searchResult)
+	}
+	var errResult struct {
+		Status int `json:"status"`
+	}
+	if httpDo(t, "POST", server.URL+"/_search", `{"query": {"query_string": {"query": "(category:phone"}}}`, &errResult) != http.StatusBadRequest {
+		t.Errorf("invalid query should fail")
+	}
+
+	var countResult struct {
+		Count int64 `json:"count"`
+	}
+	httpDo(t, "GET", server.URL+"/_count", "", &countResult)
+	if countResult.Count != 3 {
+		t.Errorf("expect 3 documents, got %d", countResult.Count)
+	}
+	httpDo(t, "POST", server.URL+"/_count", `{"query": {"term": {"brand": "acme"}}}`, &countResult)
+	if countResult.Count != 1 {
+		t.Errorf("expect 1 document, got %d", countResult.Count)
+	}
+
+	var getResult struct {
+		Found  bool `json:"found"`
+		Source struct {
+			Bytes []byte `json:"bytes"`
+		} `json:"_source"`
+	}
+	if httpDo(t, "GET", server.URL+"/_doc/2", "", &getResult) != http.StatusOK || !getResult.Found || string(getResult.Source.Bytes) != "hello" {
+		t.Errorf("unexpected doc 2 %v", getResult)
+	}
+	if httpDo(t, "GET", server.URL+"/_doc/4", "", nil) != http.StatusNotFound {
+		t.Errorf("doc 4 should be deleted")
+	}
+
+	if httpDo(t, "DELETE", server.URL+"/_doc/1", "", nil) != http.StatusOK {
+		t.Errorf("delete doc 1 failed")
+	}
+	if httpDo(t, "DELETE", server.URL+"/_doc/1", "", nil) != http.StatusNotFound {
+		t.Errorf("doc 1 should be deleted")
+	}
+}
+
+func TestHttpServerCanceled(t *testing.T) {
+	path := util.RootPath + "data/local_db/http_cancel_badger"
+	os.RemoveAll(path)
+	indexer := new(index_service.Indexer)
+	if err := indexer.Init(100, dbType, path); err != nil {
+		t.Fatal(err)
+	}
+	defer indexer.Close()
+	server := index_service.NewHttpServer(indexer)
+
+	// 客户端已经断开，请求不会到达索引
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	for _, c := range []struct{ method, url, body string }{
+		{"PUT", "/_doc/1", `{"keywords": [{"field": "category", "word": "phone"}]}`},
+		{"POST", "/_search", `{"query": {"term": {"category": "phone"}}}`},
+		{"GET", "/_count", ""},
+	} {
+		recorder := httptest.NewRecorder()
+		server.ServeHTTP(recorder, httptest.NewRequest(c.method, c.url, strings.NewReader(c.body)).WithContext(ctx))
+		if recorder.Code != index_service.STATUS_CLIENT_CLOSED_REQUEST {
+			t.Errorf("%s %s should be canceled, got %d %s", c.method, c.url, recorder.Code, recorder.Body.String())
+		}
+	}
+	if indexer.GetDoc("1") != nil {
+		t.Error("doc 1 should not be added by a canceled request")
+	}
+}
+
+// go test -v ./index_service/test -run=^TestHttpServer$ -count=1
+// go test -v ./index_service/test -run=^TestHttpServerCanceled$ -count=1
@@ -10,7 +10,11 @@ import (
 
 func TestGetServiceEndpointsByProxy(t *testing.T) {
 	const qps = 10
-	proxy := index_service.GetServiceHubProxy(etcdServers, 3, qps)
+	proxy, err := index_service.NewHubProxy(index_service.WithEtcdServers(etcdServers), index_service.WithHeartbeat(3), index_service.WithRateLimit(qps))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer proxy.Close()
 
 	endpoint := "127.0.0.1:5000"
 	proxy.Regist(serviceName, endpoint, 0)
@@ -31,9 +35,15 @@ func TestGetServiceEndpointsByProxy(t *testing.T) {
 	fmt.Printf("endpoints %v\n", endpoints)
 
 	time.Sleep(1 * time.Second)
+	if sync := proxy.LastSyncTime(serviceName); time.Since(sync) > 5*time.Second {
+		t.Errorf("endpoints of %s should be synced, last sync time %s", serviceName, sync)
+	}
 	for i := 0; i < qps+5; i++ {
 		endpoints = proxy.GetServiceEndpoints(serviceName)
 		fmt.Printf("%d endpoints %v\n", i, endpoints)
+		if len(endpoints) != 3 { //命中缓存不受限流影响
+			t.Errorf("expect 3 endpoints, got %v", endpoints)
+		}
 	}
 
 	time.Sleep(1 * time.Second)
@@ -41,6 +51,54 @@ func TestGetServiceEndpointsByProxy(t *testing.T) {
 		endpoints = proxy.GetServiceEndpoints(serviceName)
 		fmt.Printf("%d endpoints %v\n", i, endpoints)
 	}
+	fmt.Printf("%+v\n", proxy.Stats())
+	if stats := proxy.Stats(); stats.Throttled > 0 {
+		t.Errorf("cache hits should not be throttled, %+v", stats)
+	}
+	if stats := proxy.Stats(); stats.CacheMisses != 1 || stats.Resyncs != 0 { //watch从未命中时读到的revision开始，不再读一遍etcd
+		t.Errorf("expect 1 read of etcd on the first miss, %+v", stats)
+	}
+}
+
+// 连不上etcd时，通过LastSyncTime能发现缓存没有同步过
+func TestHubProxyUnsynced(t *testing.T) {
+	proxy, err := index_service.NewHubProxy(index_service.WithEtcdServers([]string{"127.0.0.1:2"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	proxy.OnEndpointsChange(serviceName, func(endpoints []string) {
+		t.Errorf("etcd is unreachable, endpoints should not change")
+	})
+	time.Sleep(500 * time.Millisecond)
+	if sync := proxy.LastSyncTime(serviceName); !sync.IsZero() {
+		t.Errorf("endpoints should not be synced, last sync time %s", sync)
+	}
+	if sync := proxy.LastSyncTime("not_watched"); !sync.IsZero() {
+		t.Errorf("service not watched, last sync time %s", sync)
+	}
+	proxy.Close() //停止监听，不会阻塞
+}
+
+// 没有缓存时才读etcd，超过限流的读取直接返回
+func TestHubProxyThrottle(t *testing.T) {
+	proxy, err := index_service.NewHubProxy(index_service.WithEtcdServers([]string{"127.0.0.1:2"}), index_service.WithRateLimit(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	go proxy.GetServiceEndpoints(serviceName) //连不上etcd，一直等到Close
+	time.Sleep(100 * time.Millisecond)
+	begin := time.Now()
+	if endpoints := proxy.GetServiceEndpoints(serviceName); len(endpoints) != 0 || time.Since(begin) > 100*time.Millisecond {
+		t.Errorf("lookup should be throttled, got %v in %s", endpoints, time.Since(begin))
+	}
+	stats := proxy.Stats()
+	fmt.Printf("%+v\n", stats)
+	if stats.CacheMisses != 2 || stats.Throttled != 1 || stats.CacheHits != 0 || stats.Resyncs != 0 {
+		t.Errorf("expect 2 misses and 1 throttled, got %+v", stats)
+	}
+	proxy.Close()
 }
 
 // go test -v ./index_service/test -run=^TestGetServiceEndpointsByProxy$ -count=1
+// go test -v ./index_service/test -run=^TestHubProxyUnsynced$ -count=1
+// go test -v ./index_service/test -run=^TestHubProxyThrottle$ -count=1
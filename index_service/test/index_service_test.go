@@ -20,7 +20,7 @@ var (
 	servicePort = 5678
 )
 
-func StartService() {
+func StartService() (*index_service.IndexServiceWorker, *grpc.Server) {
 	lis, err := net.Listen("tcp", "127.0.0.1:"+strconv.Itoa(servicePort))
 	if err != nil {
 		panic(err)
@@ -38,10 +38,12 @@ func StartService() {
 			panic(err)
 		}
 	}()
+	return service, server
 }
 
 func TestIndexService(t *testing.T) {
-	StartService()
+	service, server := StartService()
+	defer service.Shutdown(context.Background(), server)
 	time.Sleep(1 * time.Second)
 
 	conn, err := grpc.DialContext(
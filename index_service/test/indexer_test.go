@@ -2,13 +2,18 @@ package test
 
 import (
 	"bytes"
+	"context"
 	"encoding/gob"
+	"errors"
 	"fmt"
+	"os"
 	"strings"
+	"sync"
 	"testing"
 
 	"github.com/kisaragi77/TinyES/index_service"
 	"github.com/kisaragi77/TinyES/internal/kvdb"
+	"github.com/kisaragi77/TinyES/internal/wal"
 	"github.com/kisaragi77/TinyES/types"
 	"github.com/kisaragi77/TinyES/util"
 )
@@ -121,31 +126,31 @@ func TestSearch(t *testing.T) {
 	var onFlag uint64 = 0b10000
 	var offFlag uint64 = 0b01000
 	orFlags := []uint64{uint64(0b00010), uint64(0b00101)}
-	docs := radic.Search(q8, onFlag, offFlag, orFlags) //检索
-	for _, doc := range docs {
+	result := radic.Search(&index_service.SearchRequest{Query: q8, OnFlag: onFlag, OffFlag: offFlag, OrFlags: orFlags}) //检索
+	for i, doc := range result.Results {
 		book := DeserializeBook(doc.Bytes) //检索的结果是二进流，需要自反序列化
 		if book != nil {
-			fmt.Printf("%s %s %s %.1f\n", book.ISBN, book.Title, book.Author, book.Price)
+			fmt.Printf("%s %s %s %.1f score %.4f\n", book.ISBN, book.Title, book.Author, book.Price, result.Scores[i])
 		}
 	}
 	fmt.Println(strings.Repeat("-", 50))
 
 	radic.DeleteDoc(doc2.Id)
-	docs = radic.Search(q8, onFlag, offFlag, orFlags) //检索
-	for _, doc := range docs {
+	result = radic.Search(&index_service.SearchRequest{Query: q8, OnFlag: onFlag, OffFlag: offFlag, OrFlags: orFlags}) //检索
+	for i, doc := range result.Results {
 		book := DeserializeBook(doc.Bytes) //检索的结果是二进流，需要自反序列化
 		if book != nil {
-			fmt.Printf("%s %s %s %.1f\n", book.ISBN, book.Title, book.Author, book.Price)
+			fmt.Printf("%s %s %s %.1f score %.4f\n", book.ISBN, book.Title, book.Author, book.Price, result.Scores[i])
 		}
 	}
 	fmt.Println(strings.Repeat("-", 50))
 
 	radic.AddDoc(doc2)
-	docs = radic.Search(q8, onFlag, offFlag, orFlags) //检索
-	for _, doc := range docs {
+	result = radic.Search(&index_service.SearchRequest{Query: q8, OnFlag: onFlag, OffFlag: offFlag, OrFlags: orFlags}) //检索
+	for i, doc := range result.Results {
 		book := DeserializeBook(doc.Bytes) //检索的结果是二进流，需要自反序列化
 		if book != nil {
-			fmt.Printf("%s %s %s %.1f\n", book.ISBN, book.Title, book.Author, book.Price)
+			fmt.Printf("%s %s %s %.1f score %.4f\n", book.ISBN, book.Title, book.Author, book.Price, result.Scores[i])
 		}
 	}
 	fmt.Println(strings.Repeat("-", 50))
@@ -182,11 +187,11 @@ func TestLoadFromIndexFile(t *testing.T) {
 	var onFlag uint64 = 0b10000
 	var offFlag uint64 = 0b01000
 	orFlags := []uint64{uint64(0b00010), uint64(0b00101)}
-	docs := indexer.Search(q8, onFlag, offFlag, orFlags) //检索
-	for _, doc := range docs {
+	result := indexer.Search(&index_service.SearchRequest{Query: q8, OnFlag: onFlag, OffFlag: offFlag, OrFlags: orFlags}) //检索
+	for i, doc := range result.Results {
 		book := DeserializeBook(doc.Bytes) //检索的结果是二进流，需要自反序列化
 		if book != nil {
-			fmt.Printf("%s %s %s %.1f\n", book.ISBN, book.Title, book.Author, book.Price)
+			fmt.Printf("%s %s %s %.1f score %.4f\n", book.ISBN, book.Title, book.Author, book.Price, result.Scores[i])
 		}
 	}
 	fmt.Println(strings.Repeat("-", 50))
@@ -206,25 +211,310 @@ func TestLoadFromIndexFile(t *testing.T) {
 	}
 
 	indexer.DeleteDoc(doc2.Id)
-	docs = indexer.Search(q8, onFlag, offFlag, orFlags) //检索
-	for _, doc := range docs {
+	result = indexer.Search(&index_service.SearchRequest{Query: q8, OnFlag: onFlag, OffFlag: offFlag, OrFlags: orFlags}) //检索
+	for i, doc := range result.Results {
 		book := DeserializeBook(doc.Bytes) //检索的结果是二进流，需要自反序列化
 		if book != nil {
-			fmt.Printf("%s %s %s %.1f\n", book.ISBN, book.Title, book.Author, book.Price)
+			fmt.Printf("%s %s %s %.1f score %.4f\n", book.ISBN, book.Title, book.Author, book.Price, result.Scores[i])
 		}
 	}
 	fmt.Println(strings.Repeat("-", 50))
 
 	indexer.AddDoc(doc2)
-	docs = indexer.Search(q8, onFlag, offFlag, orFlags) //检索
-	for _, doc := range docs {
+	result = indexer.Search(&index_service.SearchRequest{Query: q8, OnFlag: onFlag, OffFlag: offFlag, OrFlags: orFlags}) //检索
+	for i, doc := range result.Results {
 		book := DeserializeBook(doc.Bytes) //检索的结果是二进流，需要自反序列化
 		if book != nil {
-			fmt.Printf("%s %s %s %.1f\n", book.ISBN, book.Title, book.Author, book.Price)
+			fmt.Printf("%s %s %s %.1f score %.4f\n", book.ISBN, book.Title, book.Author, book.Price, result.Scores[i])
 		}
 	}
 	fmt.Println(strings.Repeat("-", 50))
 }
 
+func TestSearchPage(t *testing.T) {
+	path := util.RootPath + "data/local_db/page_badger"
+	os.RemoveAll(path)
+	indexer := new(index_service.Indexer)
+	if err := indexer.Init(100, dbType, path); err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	defer indexer.Close()
+
+	const N = 20
+	for i := 0; i < N; i++ {
+		keywords := []*types.Keyword{{Field: "content", Word: "文物"}}
+		for j := 0; j < i%5; j++ { //文物出现的次数越多，得分越高
+			keywords = append(keywords, &types.Keyword{Field: "content", Word: "文物"})
+		}
+		indexer.AddDoc(types.Document{Id: fmt.Sprintf("doc%02d", i), Keywords: keywords})
+	}
+
+	query := types.NewTermQuery("content", "文物")
+	all := indexer.Search(&index_service.SearchRequest{Query: query})
+	if all.TotalHits != N || len(all.Results) != N {
+		t.Fatalf("expect %d hits, got %d/%d", N, all.TotalHits, len(all.Results))
+	}
+	// 逐页读取，拼起来应该与一次读取全部的结果一致
+	for from := 0; from < N; from += 7 {
+		page := indexer.Search(&index_service.SearchRequest{Query: query, From: int32(from), PageSize: 7})
+		if page.TotalHits != N {
+			t.Errorf("expect total hits %d, got %d", N, page.TotalHits)
+		}
+		for i, doc := range page.Results {
+			fmt.Printf("%s %.4f\n", doc.Id, page.Scores[i])
+			if doc.Id != all.Results[from+i].Id {
+				t.Errorf("%d-th document should be %s, got %s", from+i, all.Results[from+i].Id, doc.Id)
+			}
+		}
+	}
+	for i := 1; i < N; i++ {
+		if all.Scores[i] > all.Scores[i-1] {
+			t.Errorf("results are not sorted by score")
+		}
+	}
+
+	// 按Id降序
+	byId := indexer.Search(&index_service.SearchRequest{Query: query, PageSize: 3, Sort: []*index_service.SortSpec{{By: index_service.SortBy_ID, Order: index_service.SortOrder_DESC}}})
+	if len(byId.Results) != 3 || byId.Results[0].Id != "doc19" || byId.Results[2].Id != "doc17" {
+		t.Errorf("unexpected results sorted by id")
+	}
+
+	empty := indexer.Search(&index_service.SearchRequest{Query: query, From: N, PageSize: 10})
+	if len(empty.Results) != 0 || empty.TotalHits != N {
+		t.Errorf("page beyond the last hit should be empty")
+	}
+}
+
+func TestGetDoc(t *testing.T) {
+	path := util.RootPath + "data/local_db/get_badger"
+	os.RemoveAll(path)
+	indexer := new(index_service.Indexer)
+	if err := indexer.Init(100, dbType, path); err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	defer indexer.Close()
+
+	for i := 0; i < 5; i++ {
+		book := Book{ISBN: fmt.Sprintf("isbn%d", i), Title: fmt.Sprintf("title%d", i)}
+		indexer.AddDoc(types.Document{Id: book.ISBN, Keywords: []*types.Keyword{{Field: "title", Word: book.Title}}, Bytes: book.Serialize()})
+	}
+	indexer.DeleteDoc("isbn3")
+
+	doc := indexer.GetDoc("isbn1")
+	if doc == nil {
+		t.Fatal("isbn1 should exist")
+	}
+	if book := DeserializeBook(doc.Bytes); book == nil || book.Title != "title1" {
+		t.Errorf("unexpected document %v", doc)
+	}
+	if indexer.GetDoc("isbn3") != nil || indexer.GetDoc("not_exist") != nil {
+		t.Errorf("deleted or unknown document should be nil")
+	}
+
+	docs := indexer.MultiGetDoc([]string{"isbn4", "isbn3", "not_exist", "isbn0"})
+	if len(docs) != 2 || docs[0].Id != "isbn4" || docs[1].Id != "isbn0" {
+		t.Errorf("unexpected documents %v", docs)
+	}
+}
+
+func TestRestartIntId(t *testing.T) {
+	path := util.RootPath + "data/local_db/restart_badger"
+	os.RemoveAll(path)
+	indexer := new(index_service.Indexer)
+	if err := indexer.Init(100, dbType, path); err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	for i := 0; i < 5; i++ {
+		indexer.AddDoc(types.Document{Id: fmt.Sprintf("old%d", i), Keywords: []*types.Keyword{{Field: "tag", Word: "old"}}})
+	}
+	indexer.Close()
+
+	// 重启后新加入的doc不能复用已有doc的IntId
+	indexer = new(index_service.Indexer)
+	if err := indexer.Init(100, dbType, path); err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	defer indexer.Close()
+	if n := indexer.LoadFromIndexFile(); n != 5 {
+		t.Fatalf("expect 5 documents loaded, got %d", n)
+	}
+	for i := 0; i < 5; i++ {
+		indexer.AddDoc(types.Document{Id: fmt.Sprintf("new%d", i), Keywords: []*types.Keyword{{Field: "tag", Word: "new"}}})
+	}
+
+	intIds := make(map[uint64]string)
+	for _, doc := range indexer.MultiGetDoc([]string{"old0", "old1", "old2", "old3", "old4", "new0", "new1", "new2", "new3", "new4"}) {
+		if other, exists := intIds[doc.IntId]; exists {
+			t.Errorf("%s and %s share IntId %d", other, doc.Id, doc.IntId)
+		}
+		intIds[doc.IntId] = doc.Id
+	}
+	for _, word := range []string{"old", "new"} {
+		result := indexer.Search(&index_service.SearchRequest{Query: types.NewTermQuery("tag", word)})
+		if result.TotalHits != 5 {
+			t.Errorf("expect 5 %s documents, got %d", word, result.TotalHits)
+		}
+		for _, doc := range result.Results {
+			if !strings.HasPrefix(doc.Id, word) {
+				t.Errorf("%s should not match tag:%s", doc.Id, word)
+			}
+		}
+	}
+}
+
+func TestWalReplay(t *testing.T) {
+	path := util.RootPath + "data/local_db/wal_badger"
+	os.RemoveAll(path)
+	os.Remove(path + index_service.WAL_SUFFIX)
+	indexer := new(index_service.Indexer)
+	if err := indexer.Init(100, dbType, path); err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	indexer.AddDoc(types.Document{Id: "doc1", Keywords: []*types.Keyword{{Field: "tag", Word: "go"}}})
+	indexer.AddDoc(types.Document{Id: "doc2", Keywords: []*types.Keyword{{Field: "tag", Word: "go"}}})
+	indexer.Close()
+
+	// 模拟写完wal后、更新索引前进程崩溃：只写wal
+	log, err := wal.Open(path + index_service.WAL_SUFFIX)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var value bytes.Buffer
+	gob.NewEncoder(&value).Encode(types.Document{Id: "doc3", IntId: 100, Keywords: []*types.Keyword{{Field: "tag", Word: "go"}}})
+	log.Append(wal.OP_PUT, []byte("doc3"), value.Bytes())
+	log.Append(wal.OP_DELETE, []byte("doc1"), nil)
+	log.Close()
+
+	indexer = new(index_service.Indexer)
+	if err := indexer.Init(100, dbType, path); err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	defer indexer.Close()
+	if n := indexer.LoadFromIndexFile(); n != 2 {
+		t.Errorf("expect 2 documents after replay, got %d", n)
+	}
+	result := indexer.Search(&index_service.SearchRequest{Query: types.NewTermQuery("tag", "go"), Sort: []*index_service.SortSpec{{By: index_service.SortBy_ID}}})
+	if len(result.Results) != 2 || result.Results[0].Id != "doc2" || result.Results[1].Id != "doc3" {
+		t.Errorf("unexpected search result %v", result.Results)
+	}
+	if info, err := os.Stat(path + index_service.WAL_SUFFIX); err != nil || info.Size() != 0 {
+		t.Errorf("wal should be truncated after checkpoint")
+	}
+	if n, _ := indexer.AddDoc(types.Document{Id: "doc4"}); n != 1 || indexer.GetDoc("doc4").IntId <= 100 {
+		t.Errorf("IntId of replayed document should be restored")
+	}
+}
+
+func TestConcurrentUpsert(t *testing.T) {
+	path := util.RootPath + "data/local_db/upsert_badger"
+	os.RemoveAll(path)
+	indexer := new(index_service.Indexer)
+	if err := indexer.Init(100, dbType, path); err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	defer indexer.Close()
+
+	// 多个协程并发地upsert、删除少数几个doc，同一个doc的操作会激烈竞争
+	const P, N, DOCS = 8, 200, 5
+	wg := sync.WaitGroup{}
+	wg.Add(P)
+	for i := 0; i < P; i++ {
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < N; j++ {
+				docId := fmt.Sprintf("doc%d", (i+j)%DOCS)
+				if j%7 == 0 {
+					indexer.DeleteDoc(docId)
+				} else {
+					indexer.AddDoc(types.Document{Id: docId, Keywords: []*types.Keyword{{Field: "tag", Word: "race"}}})
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	// 倒排索引里每个doc最多只能有一个IntId，且与正排索引一致
+	result := indexer.Search(&index_service.SearchRequest{Query: types.NewTermQuery("tag", "race")})
+	if int(result.TotalHits) != indexer.Count() {
+		t.Errorf("%d hits in reverse index, but %d documents in forward index", result.TotalHits, indexer.Count())
+	}
+	seen := make(map[string]bool)
+	for _, doc := range result.Results {
+		if seen[doc.Id] {
+			t.Errorf("ghost hit of %s", doc.Id)
+		}
+		seen[doc.Id] = true
+	}
+}
+
+var _ index_service.IContextIndexer = (*index_service.Indexer)(nil)
+var _ index_service.IContextIndexer = (*index_service.Sentinel)(nil)
+
+func TestIndexerContext(t *testing.T) {
+	path := util.RootPath + "data/local_db/context_badger"
+	os.RemoveAll(path)
+	os.Remove(path + index_service.WAL_SUFFIX)
+	indexer := new(index_service.Indexer)
+	if err := indexer.Init(100, dbType, path); err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	defer indexer.Close()
+
+	ctx := context.Background()
+	for i := 0; i < 10; i++ {
+		if _, err := indexer.AddDocContext(ctx, types.Document{Id: fmt.Sprintf("doc%d", i), Keywords: []*types.Keyword{{Field: "tag", Word: "ctx"}}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	request := &index_service.SearchRequest{Query: types.NewTermQuery("tag", "ctx")}
+	if result, err := indexer.SearchContext(ctx, request); err != nil || len(result.Results) != 10 {
+		t.Errorf("expect 10 results, got %v", err)
+	}
+	if n, err := indexer.CountContext(ctx); err != nil || n != 10 {
+		t.Errorf("expect 10 documents, got %d %v", n, err)
+	}
+
+	// ctx结束之后，读写都放弃并返回ctx.Err()
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := indexer.SearchContext(canceled, request); !errors.Is(err, context.Canceled) {
+		t.Errorf("search should be canceled, got %v", err)
+	}
+	if _, err := indexer.MultiGetDocContext(canceled, []string{"doc1", "doc2"}); !errors.Is(err, context.Canceled) {
+		t.Errorf("multi get should be canceled, got %v", err)
+	}
+	if _, err := indexer.GetDocContext(canceled, "doc1"); !errors.Is(err, context.Canceled) {
+		t.Errorf("get should be canceled, got %v", err)
+	}
+	if _, err := indexer.DeleteDocContext(canceled, "doc1"); !errors.Is(err, context.Canceled) || indexer.GetDoc("doc1") == nil {
+		t.Errorf("delete should be canceled, got %v", err)
+	}
+	if _, err := indexer.AddDocContext(canceled, types.Document{Id: "doc10"}); !errors.Is(err, context.Canceled) || indexer.GetDoc("doc10") != nil {
+		t.Errorf("add should be canceled, got %v", err)
+	}
+}
+
 // go test -v ./index_service/test -run=^TestSearch$ -count=1
+// go test -v ./index_service/test -run=^TestSearchPage$ -count=1
 // go test -v ./index_service/test -run=^TestLoadFromIndexFile$ -count=1
+// go test -v ./index_service/test -run=^TestGetDoc$ -count=1
+// go test -v ./index_service/test -run=^TestRestartIntId$ -count=1
+// go test -v ./index_service/test -run=^TestWalReplay$ -count=1
+// go test -race -v ./index_service/test -run=^TestConcurrentUpsert$ -count=1
+// go test -v ./index_service/test -run=^TestIndexerContext$ -count=1
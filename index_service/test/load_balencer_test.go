@@ -1,6 +1,7 @@
 package test
 
 import (
+	"errors"
 	"fmt"
 	"math/rand"
 	"sync"
@@ -63,5 +64,91 @@ func TestRoudRobin(t *testing.T) {
 	testLB(balancer)
 }
 
+func TestWeightedRoundRobin(t *testing.T) {
+	balancer := new(index_service.WeightedRoundRobin)
+	balancer.SetWeights(map[string]int{endpoints[0]: 1, endpoints[1]: 2, endpoints[2]: 3})
+	testLB(balancer)
+
+	cm := make(map[string]int, len(endpoints))
+	for i := 0; i < 600; i++ {
+		cm[balancer.Take(endpoints)]++
+	}
+	fmt.Println(cm)
+	if cm[endpoints[0]] != 100 || cm[endpoints[1]] != 200 || cm[endpoints[2]] != 300 {
+		t.Errorf("takes should be proportional to weights, got %v", cm)
+	}
+	// 平滑加权，权重最大的节点不会连续被选中太多次
+	run := 0
+	for i := 0; i < 12; i++ {
+		if balancer.Take(endpoints) == endpoints[2] {
+			run++
+		} else {
+			run = 0
+		}
+		if run >= 3 {
+			t.Errorf("%s taken 3 times in a row", endpoints[2])
+		}
+	}
+
+	// 新的权重替换旧的，不在其中的节点恢复默认权重
+	balancer.SetWeights(map[string]int{endpoints[1]: 1})
+	cm = make(map[string]int, len(endpoints))
+	for i := 0; i < 300; i++ {
+		cm[balancer.Take(endpoints)]++
+	}
+	if cm[endpoints[0]] != 100 || cm[endpoints[1]] != 100 || cm[endpoints[2]] != 100 {
+		t.Errorf("weights should be replaced, got %v", cm)
+	}
+}
+
+func TestLeastOutstanding(t *testing.T) {
+	balancer := new(index_service.LeastOutstanding)
+	testLB(balancer)
+
+	balancer.Begin(endpoints[0])
+	balancer.Begin(endpoints[1])
+	balancer.Begin(endpoints[1])
+	for i := 0; i < 10; i++ {
+		if endpoint := balancer.Take(endpoints); endpoint != endpoints[2] {
+			t.Errorf("expect %s, got %s", endpoints[2], endpoint)
+		}
+	}
+	balancer.End(endpoints[0], time.Millisecond, nil)
+	balancer.Begin(endpoints[2])
+	if endpoint := balancer.Take(endpoints); endpoint != endpoints[0] {
+		t.Errorf("expect %s, got %s", endpoints[0], endpoint)
+	}
+}
+
+func TestP2CEWMA(t *testing.T) {
+	balancer := new(index_service.P2CEWMA)
+	testLB(balancer)
+
+	slow, fast := endpoints[0], endpoints[1]
+	for i := 0; i < 10; i++ {
+		balancer.Begin(slow)
+		balancer.End(slow, 100*time.Millisecond, nil)
+		balancer.Begin(fast)
+		balancer.End(fast, time.Millisecond, nil)
+	}
+	// 只有两个节点时每次都比较这两个节点
+	for i := 0; i < 10; i++ {
+		if endpoint := balancer.Take([]string{slow, fast}); endpoint != fast {
+			t.Errorf("expect %s, got %s", fast, endpoint)
+		}
+	}
+	// 失败的请求按惩罚延迟计算
+	for i := 0; i < 5; i++ {
+		balancer.Begin(fast)
+		balancer.End(fast, time.Millisecond, errors.New("unavailable"))
+	}
+	if endpoint := balancer.Take([]string{slow, fast}); endpoint != slow {
+		t.Errorf("expect %s, got %s", slow, endpoint)
+	}
+}
+
 // go test -v ./index_service/test -run=^TestRandomSelect$ -count=1
 // go test -v ./index_service/test -run=^TestRoudRobin$ -count=1
+// go test -v ./index_service/test -run=^TestWeightedRoundRobin$ -count=1
+// go test -v ./index_service/test -run=^TestLeastOutstanding$ -count=1
+// go test -v ./index_service/test -run=^TestP2CEWMA$ -count=1
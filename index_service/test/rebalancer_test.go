@@ -0,0 +1,148 @@
+package test
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/kisaragi77/TinyES/index_service"
+	"github.com/kisaragi77/TinyES/types"
+	"github.com/kisaragi77/TinyES/util"
+	"google.golang.org/grpc"
+)
+
+// 在本地启动一个IndexServiceWorker，不注册到etcd
+func startLocalWorker(t *testing.T, port int) (*index_service.IndexServiceWorker, *grpc.Server) {
+	return startWrappedWorker(t, port, nil)
+}
+
+// 在本地启动一个IndexServiceWorker，grpc请求由wrap包装后的server处理，wrap为nil时直接由worker处理
+func startWrappedWorker(t *testing.T, port int, wrap func(worker *index_service.IndexServiceWorker) index_service.IndexServiceServer) (*index_service.IndexServiceWorker, *grpc.Server) {
+	path := util.RootPath + "data/local_db/worker_" + strconv.Itoa(port)
+	os.RemoveAll(path)
+	os.Remove(path + index_service.WAL_SUFFIX)
+	lis, err := net.Listen("tcp", "127.0.0.1:"+strconv.Itoa(port))
+	if err != nil {
+		t.Fatal(err)
+	}
+	service := new(index_service.IndexServiceWorker)
+	if err := service.Init(1000, dbType, path); err != nil {
+		t.Fatal(err)
+	}
+	server := grpc.NewServer()
+	if wrap != nil {
+		index_service.RegisterIndexServiceServer(server, wrap(service))
+	} else {
+		index_service.RegisterIndexServiceServer(server, service)
+	}
+	go server.Serve(lis)
+	return service, server
+}
+
+func TestRebalance(t *testing.T) {
+	ports := []int{5700, 5701, 5702}
+	endpoints := make([]string, 0, len(ports))
+	workers := make(map[string]*index_service.IndexServiceWorker, len(ports))
+	for _, port := range ports {
+		worker, server := startLocalWorker(t, port)
+		defer worker.Close()
+		defer server.Stop()
+		endpoint := "127.0.0.1:" + strconv.Itoa(port)
+		endpoints = append(endpoints, endpoint)
+		workers[endpoint] = worker
+	}
+
+	// 起初集群里只有第一台worker，所有doc都在它上面
+	const N = 300
+	for i := 0; i < N; i++ {
+		workers[endpoints[0]].Indexer.AddDoc(types.Document{Id: fmt.Sprintf("doc%03d", i), Keywords: []*types.Keyword{{Field: "tag", Word: "rebalance"}}})
+	}
+
+	// 另外两台worker加入后，限流迁移，中途停止
+	sentinel := new(index_service.Sentinel)
+	rebalancer := index_service.NewRebalancer(sentinel, 300)
+	rebalancer.Start(endpoints[:1], endpoints)
+	for deadline := time.Now().Add(5 * time.Second); rebalancer.Progress().Sources[0].Moved == 0 && time.Now().Before(deadline); {
+		time.Sleep(10 * time.Millisecond)
+	}
+	rebalancer.Stop()
+	progress := rebalancer.Progress()
+	fmt.Printf("stopped: %+v\n", progress)
+	if progress.Running || progress.Finished() || progress.Sources[0].Moved == 0 {
+		t.Errorf("rebalance should be stopped in the middle")
+	}
+
+	// 从中断处继续
+	rebalancer.Resume()
+	rebalancer.Wait()
+	progress = rebalancer.Progress()
+	fmt.Printf("finished: %+v\n", progress)
+	if !progress.Finished() || progress.Epoch != 1 {
+		t.Errorf("rebalance should be resumed and finished")
+	}
+
+	ring := index_service.NewConsistentHash(endpoints, index_service.VIRTUAL_NODES)
+	total := 0
+	for endpoint, worker := range workers {
+		docs, _ := worker.Indexer.ScanDoc("", N, nil)
+		for _, doc := range docs {
+			if owner := ring.Get(doc.Id); owner != endpoint {
+				t.Errorf("%s should be moved from %s to %s", doc.Id, endpoint, owner)
+			}
+		}
+		fmt.Printf("%s has %d documents\n", endpoint, len(docs))
+		total += len(docs)
+	}
+	if total != N || int(progress.Sources[0].Moved) != N-workers[endpoints[0]].Indexer.Count() {
+		t.Errorf("expect %d documents in cluster, got %d", N, total)
+	}
+}
+
+func TestRebalanceDeleted(t *testing.T) {
+	ports := []int{5703, 5704}
+	endpoints := make([]string, 0, len(ports))
+	workers := make([]*index_service.IndexServiceWorker, 0, len(ports))
+	for _, port := range ports {
+		worker, server := startLocalWorker(t, port)
+		defer worker.Close()
+		defer server.Stop()
+		endpoints = append(endpoints, "127.0.0.1:"+strconv.Itoa(port))
+		workers = append(workers, worker)
+	}
+	const N = 100
+	for i := 0; i < N; i++ {
+		workers[0].Indexer.AddDoc(types.Document{Id: fmt.Sprintf("doc%03d", i)})
+	}
+
+	// 第二台worker加入后，客户端在迁移之前删除了一个归它所有的doc，删除请求只发到了新的owner上
+	ring := index_service.NewConsistentHash(endpoints, index_service.VIRTUAL_NODES)
+	deleted := ""
+	for i := 0; i < N && deleted == ""; i++ {
+		if id := fmt.Sprintf("doc%03d", i); ring.Get(id) == endpoints[1] {
+			deleted = id
+		}
+	}
+	workers[1].Indexer.DeleteDoc(deleted)
+	rebalancer := index_service.NewRebalancer(new(index_service.Sentinel), 1000)
+	rebalancer.Start(endpoints[:1], endpoints)
+	rebalancer.Wait()
+	if workers[0].Indexer.GetDoc(deleted) != nil || workers[1].Indexer.GetDoc(deleted) != nil {
+		t.Errorf("deleted %s should not be resurrected", deleted)
+	}
+	if total := workers[0].Indexer.Count() + workers[1].Indexer.Count(); total != N-1 {
+		t.Errorf("expect %d documents in cluster, got %d", N-1, total)
+	}
+
+	// 第二台worker离开，doc都迁回第一台worker，迁移时的删除不留墓碑
+	rebalancer.Start(endpoints[1:], endpoints[:1])
+	rebalancer.Wait()
+	if n := workers[0].Indexer.Count(); n != N-1 || workers[1].Indexer.Count() != 0 {
+		t.Errorf("expect %d documents moved back, got %d", N-1, n)
+	}
+}
+
+// go test -v ./index_service/test -run=^TestRebalance$ -count=1
+// go test -v ./index_service/test -run=^TestRebalanceDeleted$ -count=1
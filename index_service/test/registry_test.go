@@ -0,0 +1,323 @@
+package test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/kisaragi77/TinyES/index_service"
+	"github.com/kisaragi77/TinyES/types"
+)
+
+func TestMemoryHub(t *testing.T) {
+	hub := index_service.NewMemoryHub()
+	changes := make(chan []string, 10)
+	hub.OnEndpointsChange(serviceName, func(endpoints []string) { changes <- endpoints })
+
+	lease, err := hub.Regist(serviceName, "127.0.0.2:5000", 0)
+	if err != nil || lease <= 0 {
+		t.Fatalf("regist failed: %d %v", lease, err)
+	}
+	hub.Regist(serviceName, "127.0.0.1:5000", 0)
+	if renewed, _ := hub.Regist(serviceName, "127.0.0.2:5000", lease); renewed != lease {
+		t.Errorf("renew should keep lease %d, got %d", lease, renewed)
+	}
+	expect := []string{"127.0.0.1:5000", "127.0.0.2:5000"}
+	if endpoints := hub.GetServiceEndpoints(serviceName); !reflect.DeepEqual(endpoints, expect) {
+		t.Errorf("expect %v, got %v", expect, endpoints)
+	}
+	hub.UnRegist(serviceName, "127.0.0.2:5000")
+	if endpoints := hub.GetServiceEndpoints(serviceName); !reflect.DeepEqual(endpoints, expect[:1]) {
+		t.Errorf("expect %v, got %v", expect[:1], endpoints)
+	}
+	// 续约不算变化，只通知3次
+	if len(changes) != 3 {
+		t.Errorf("expect 3 changes, got %d", len(changes))
+	}
+
+	// sentinel通过MemoryHub发现worker，worker加入后立即可用
+	ports := []int{5760, 5761}
+	for _, port := range ports {
+		worker, server := startLocalWorker(t, port)
+		defer worker.Close()
+		defer server.Stop()
+	}
+	hub.Regist(index_service.INDEX_SERVICE, "127.0.0.1:"+strconv.Itoa(ports[0]), 0)
+	sentinel := newSentinel(t, index_service.WithServiceHub(hub), index_service.WithAutoRebalance(), index_service.WithRebalanceDelay(0))
+	defer sentinel.Close()
+	if _, err := sentinel.AddDoc(types.Document{Id: "doc1"}); err != nil {
+		t.Fatal(err)
+	}
+	hub.Regist(index_service.INDEX_SERVICE, "127.0.0.1:"+strconv.Itoa(ports[1]), 0)
+	if _, err := sentinel.AddDoc(types.Document{Id: "doc2"}); err != nil {
+		t.Fatal(err)
+	}
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if progress := sentinel.RebalanceProgress(); progress.Finished() { //迁移中的doc可能在两台worker上各有一份
+			break
+		}
+	}
+	if n := sentinel.Count(); n != 2 {
+		t.Errorf("expect 2 documents, got %d", n)
+	}
+}
+
+func TestFileHub(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "endpoints.json")
+	if _, err := index_service.NewFileHub(path, 0); err == nil {
+		t.Errorf("file not exists, NewFileHub should fail")
+	}
+	if err := os.WriteFile(path, []byte(`{"test_service": ["127.0.0.2:5000", "127.0.0.1:5000"]}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	hub, err := index_service.NewFileHub(path, 10*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer hub.Close()
+	expect := []string{"127.0.0.1:5000", "127.0.0.2:5000"}
+	if endpoints := hub.GetServiceEndpoints(serviceName); !reflect.DeepEqual(endpoints, expect) {
+		t.Errorf("expect %v, got %v", expect, endpoints)
+	}
+
+	changes := make(chan []string, 10)
+	hub.OnEndpointsChange(serviceName, func(endpoints []string) { changes <- endpoints })
+	// 文件损坏时保留原来的节点
+	os.WriteFile(path, []byte(`{"test_service": [`), 0644)
+	time.Sleep(50 * time.Millisecond)
+	if endpoints := hub.GetServiceEndpoints(serviceName); !reflect.DeepEqual(endpoints, expect) {
+		t.Errorf("expect %v, got %v", expect, endpoints)
+	}
+	os.WriteFile(path, []byte(`{"test_service": ["127.0.0.3:5000"]}`), 0644)
+	select {
+	case endpoints := <-changes:
+		if !reflect.DeepEqual(endpoints, []string{"127.0.0.3:5000"}) {
+			t.Errorf("expect [127.0.0.3:5000], got %v", endpoints)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("change of file not noticed")
+	}
+}
+
+func TestEndpointInfo(t *testing.T) {
+	hub := index_service.NewMemoryHub()
+	ports := []int{5762, 5763, 5764}
+	endpoints := make([]string, 0, len(ports))
+	workers := make([]*index_service.IndexServiceWorker, 0, len(ports))
+	for _, port := range ports {
+		worker, server := startLocalWorker(t, port)
+		defer worker.Close()
+		defer server.Stop()
+		endpoints = append(endpoints, "127.0.0.1:"+strconv.Itoa(port))
+		workers = append(workers, worker)
+	}
+	a, b, c := endpoints[0], endpoints[1], endpoints[2]
+	hub.RegistWithInfo(index_service.INDEX_SERVICE, a, 0, &index_service.EndpointInfo{Zone: "a", Version: "v2", Ready: true})
+	hub.RegistWithInfo(index_service.INDEX_SERVICE, b, 0, &index_service.EndpointInfo{Zone: "b", Version: "v1", Ready: true})
+	lease, _ := hub.RegistWithInfo(index_service.INDEX_SERVICE, c, 0, &index_service.EndpointInfo{Zone: "a", Version: "v2", Shards: []string{"s1"}})
+
+	infos := index_service.GetServiceEndpointInfos(hub, index_service.INDEX_SERVICE)
+	if len(infos) != 3 || infos[0].Endpoint != a || infos[2].Ready || infos[2].Shards[0] != "s1" {
+		t.Errorf("unexpected metadata %+v", infos)
+	}
+	for _, tc := range []struct {
+		filter index_service.EndpointFilter
+		expect []string
+	}{
+		{index_service.Ready, []string{a, b}},
+		{index_service.InZone("a"), []string{a, c}},
+		{index_service.MatchAll(index_service.Ready, index_service.OfVersion("v2")), []string{a}},
+		{index_service.OwnsShard("s1"), []string{c}},
+		{nil, []string{a, b, c}},
+	} {
+		if got := index_service.GetServiceEndpointsBy(hub, index_service.INDEX_SERVICE, tc.filter); !reflect.DeepEqual(got, tc.expect) {
+			t.Errorf("expect %v, got %v", tc.expect, got)
+		}
+	}
+	// 没有元数据的注册中心，节点都是就绪的
+	static := index_service.NewStaticHub(map[string][]string{index_service.INDEX_SERVICE: {a}})
+	if got := index_service.GetServiceEndpointsBy(static, index_service.INDEX_SERVICE, index_service.Ready); !reflect.DeepEqual(got, []string{a}) {
+		t.Errorf("expect [%s], got %v", a, got)
+	}
+
+	// 哈希环由可用区a里注册的worker组成，未就绪的c照常接收写入，但不处理查询
+	sentinel := newSentinel(t, index_service.WithServiceHub(hub), index_service.WithEndpointFilter(index_service.InZone("a")), index_service.WithAutoRebalance(), index_service.WithRebalanceDelay(0))
+	defer sentinel.Close()
+	const N = 20
+	for i := 0; i < N; i++ {
+		if _, err := sentinel.AddDoc(types.Document{Id: fmt.Sprintf("doc%02d", i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if workers[0].Indexer.Count() == 0 || workers[1].Indexer.Count() != 0 || workers[2].Indexer.Count() == 0 {
+		t.Errorf("documents should be on %s and %s", a, c)
+	}
+	if result := sentinel.ClusterCount(context.Background()); result.Complete() || result.Total != workers[0].Indexer.Count() {
+		t.Errorf("shards on %s should fail before it's ready, got %+v", c, result)
+	}
+	// c就绪后开始处理查询，哈希环没变，不迁移doc
+	hub.RegistWithInfo(index_service.INDEX_SERVICE, c, lease, &index_service.EndpointInfo{Zone: "a", Version: "v2", Ready: true})
+	if result := sentinel.ClusterCount(context.Background()); !result.Complete() || result.Total != N {
+		t.Errorf("expect %d documents, got %+v", N, result)
+	}
+	if epoch := sentinel.RebalanceProgress().Epoch; epoch != 0 {
+		t.Errorf("readiness change should not rebalance, got epoch %d", epoch)
+	}
+}
+
+func TestRebalanceDelay(t *testing.T) {
+	hub := index_service.NewMemoryHub()
+	ports := []int{5768, 5769}
+	endpoints := make([]string, 0, len(ports))
+	for _, port := range ports {
+		worker, server := startLocalWorker(t, port)
+		defer worker.Close()
+		defer server.Stop()
+		endpoint := "127.0.0.1:" + strconv.Itoa(port)
+		endpoints = append(endpoints, endpoint)
+		hub.Regist(index_service.INDEX_SERVICE, endpoint, 0)
+	}
+	sentinel := newSentinel(t, index_service.WithServiceHub(hub), index_service.WithAutoRebalance(), index_service.WithRebalanceDelay(300*time.Millisecond))
+	defer sentinel.Close()
+	const N = 20
+	for i := 0; i < N; i++ {
+		if _, err := sentinel.AddDoc(types.Document{Id: fmt.Sprintf("doc%02d", i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	waitRebalance := func(epoch int64) index_service.RebalanceProgress {
+		for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+			if progress := sentinel.RebalanceProgress(); progress.Epoch == epoch && progress.Finished() {
+				return progress
+			}
+		}
+		t.Fatalf("rebalance %d not finished", epoch)
+		return index_service.RebalanceProgress{}
+	}
+
+	// worker重启时很快重新注册，等待期间只扫描一遍，没有doc需要迁移
+	hub.UnRegist(index_service.INDEX_SERVICE, endpoints[1])
+	hub.Regist(index_service.INDEX_SERVICE, endpoints[1], 0)
+	if epoch := sentinel.RebalanceProgress().Epoch; epoch != 0 {
+		t.Errorf("rebalance should be delayed, got epoch %d", epoch)
+	}
+	for _, source := range waitRebalance(1).Sources {
+		if source.Moved != 0 {
+			t.Errorf("quick restart should not move documents, %d moved from %s", source.Moved, source.Endpoint)
+		}
+	}
+
+	// worker离开超过延迟后，它的doc迁到留下的worker上
+	hub.UnRegist(index_service.INDEX_SERVICE, endpoints[1])
+	waitRebalance(2)
+	if n := sentinel.Count(); n != N {
+		t.Errorf("expect %d documents, got %d", N, n)
+	}
+}
+
+// 记录Close调用次数的IServiceHub
+type closeCountingHub struct {
+	*index_service.MemoryHub
+	closed atomic.Int32
+}
+
+func (hub *closeCountingHub) Close() {
+	hub.closed.Add(1)
+}
+
+func TestSharedHub(t *testing.T) {
+	hub := &closeCountingHub{MemoryHub: index_service.NewMemoryHub()}
+	sentinel1 := newSentinel(t, index_service.WithServiceHub(hub))
+	sentinel2 := newSentinel(t, index_service.WithServiceHub(hub))
+	// 传入的hub可能被别的sentinel或worker共享，由调用方关闭
+	sentinel1.Close()
+	sentinel2.Close()
+	if n := hub.closed.Load(); n != 0 {
+		t.Errorf("hub passed by WithServiceHub should not be closed by sentinel, closed %d times", n)
+	}
+}
+
+// 可以模拟查询失败(比如被限流)的IServiceHub，失败时返回nil
+type failingHub struct {
+	*index_service.MemoryHub
+	failing atomic.Bool
+}
+
+func (hub *failingHub) GetServiceEndpoints(service string) []string {
+	if hub.failing.Load() {
+		return nil
+	}
+	return hub.MemoryHub.GetServiceEndpoints(service)
+}
+
+func (hub *failingHub) GetServiceEndpointInfos(service string) []index_service.EndpointInfo {
+	if hub.failing.Load() {
+		return nil
+	}
+	return hub.MemoryHub.GetServiceEndpointInfos(service)
+}
+
+func TestDeregisterAll(t *testing.T) {
+	hub := &failingHub{MemoryHub: index_service.NewMemoryHub()}
+	ports := []int{5706, 5707}
+	endpoints := make([]string, 0, len(ports))
+	for _, port := range ports {
+		worker, server := startLocalWorker(t, port)
+		defer worker.Close()
+		defer server.Stop()
+		endpoint := "127.0.0.1:" + strconv.Itoa(port)
+		endpoints = append(endpoints, endpoint)
+		hub.Regist(index_service.INDEX_SERVICE, endpoint, 0)
+	}
+	sentinel := newSentinel(t, index_service.WithServiceHub(hub), index_service.WithAutoRebalance(), index_service.WithRebalanceDelay(0))
+	defer sentinel.Close()
+	if _, err := sentinel.AddDoc(types.Document{Id: "doc1"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// 查询失败时沿用老的哈希环
+	hub.failing.Store(true)
+	if _, err := sentinel.AddDoc(types.Document{Id: "doc2"}); err != nil {
+		t.Errorf("failed lookup should keep the ring: %s", err)
+	}
+	if n, err := sentinel.CountContext(context.Background()); err != nil || n != 2 {
+		t.Errorf("expect 2 documents, got %d %v", n, err)
+	}
+	hub.failing.Store(false)
+
+	// worker都注销后清空哈希环，不再访问它们，也不迁移到它们上
+	for _, endpoint := range endpoints {
+		hub.UnRegist(index_service.INDEX_SERVICE, endpoint)
+	}
+	if _, err := sentinel.AddDoc(types.Document{Id: "doc3"}); err == nil {
+		t.Errorf("no worker is registered, AddDoc should fail")
+	}
+	if result := sentinel.ClusterCount(context.Background()); len(result.Workers) != 0 || result.Total != 0 {
+		t.Errorf("deregistered workers should not be counted, got %+v", result)
+	}
+	sentinel.Rebalance()
+	time.Sleep(100 * time.Millisecond)
+	if epoch := sentinel.RebalanceProgress().Epoch; epoch != 0 {
+		t.Errorf("should not rebalance to an empty ring, got epoch %d", epoch)
+	}
+
+	// worker重新注册后恢复
+	hub.Regist(index_service.INDEX_SERVICE, endpoints[0], 0)
+	if _, err := sentinel.AddDoc(types.Document{Id: "doc3"}); err != nil {
+		t.Error(err)
+	}
+}
+
+// go test -v ./index_service/test -run=^TestMemoryHub$ -count=1
+// go test -v ./index_service/test -run=^TestFileHub$ -count=1
+// go test -v ./index_service/test -run=^TestEndpointInfo$ -count=1
+// go test -v ./index_service/test -run=^TestRebalanceDelay$ -count=1
+// go test -v ./index_service/test -run=^TestSharedHub$ -count=1
+// go test -v ./index_service/test -run=^TestDeregisterAll$ -count=1
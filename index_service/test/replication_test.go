@@ -0,0 +1,169 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/kisaragi77/TinyES/index_service"
+	"github.com/kisaragi77/TinyES/types"
+)
+
+// 固定worker集合的IServiceHub，不依赖etcd
+func staticHub(endpoints []string) index_service.IServiceHub {
+	return index_service.NewStaticHub(map[string][]string{index_service.INDEX_SERVICE: endpoints})
+}
+
+// 创建Sentinel，失败时结束测试
+func newSentinel(t *testing.T, options ...index_service.SentinelOption) *index_service.Sentinel {
+	sentinel, err := index_service.NewSentinel(nil, options...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sentinel
+}
+
+func TestReplication(t *testing.T) {
+	ports := []int{5710, 5711, 5712}
+	endpoints := make([]string, 0, len(ports))
+	workers := make(map[string]*index_service.IndexServiceWorker, len(ports))
+	stop := make(map[string]func(), len(ports))
+	for _, port := range ports {
+		worker, server := startLocalWorker(t, port)
+		defer worker.Close()
+		defer server.Stop()
+		endpoint := "127.0.0.1:" + strconv.Itoa(port)
+		endpoints = append(endpoints, endpoint)
+		workers[endpoint] = worker
+		stop[endpoint] = server.Stop
+	}
+	sentinel := newSentinel(t, index_service.WithServiceHub(staticHub(endpoints)), index_service.WithReplicationFactor(2))
+	defer sentinel.Close()
+
+	const N = 30
+	for i := 0; i < N; i++ {
+		if _, err := sentinel.AddDoc(types.Document{Id: fmt.Sprintf("doc%02d", i), Keywords: []*types.Keyword{{Field: "tag", Word: "replica"}}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 每个doc恰好在它的2个副本上
+	ring := index_service.NewConsistentHash(endpoints, index_service.VIRTUAL_NODES)
+	for i := 0; i < N; i++ {
+		docId := fmt.Sprintf("doc%02d", i)
+		replicas := ring.GetN(docId, 2)
+		for endpoint, worker := range workers {
+			stored := worker.Indexer.GetDoc(docId) != nil
+			if stored != (endpoint == replicas[0] || endpoint == replicas[1]) {
+				t.Errorf("%s stored on %s: %t, replicas %v", docId, endpoint, stored, replicas)
+			}
+		}
+	}
+
+	query := &index_service.SearchRequest{Query: types.NewTermQuery("tag", "replica")}
+	checkSearch := func() {
+		result := sentinel.Search(query)
+		seen := make(map[string]bool)
+		for _, doc := range result.Results {
+			if seen[doc.Id] {
+				t.Errorf("%s returned by more than one replica", doc.Id)
+			}
+			seen[doc.Id] = true
+		}
+		if result.TotalHits != N || len(seen) != N {
+			t.Errorf("expect %d hits, got %d/%d", N, result.TotalHits, len(seen))
+		}
+	}
+	checkSearch()
+
+	// 一台worker宕机后，检索切换到其他副本，读不受影响；副本包含宕机worker的doc写不成多数
+	down := endpoints[1]
+	stop[down]()
+	checkSearch()
+	if doc := sentinel.GetDoc("doc00"); doc == nil {
+		t.Errorf("doc00 should be read from another replica")
+	}
+	failed := 0
+	for i := N; i < 2*N; i++ {
+		doc := types.Document{Id: fmt.Sprintf("doc%02d", i)}
+		result := sentinel.AddDocWithQuorum(context.Background(), doc)
+		_, hasFailure := result.Failures[down]
+		if result.Ok() == hasFailure || result.Quorum != 2 {
+			t.Errorf("unexpected write result of %s: %+v", doc.Id, result)
+		}
+		if !result.Ok() {
+			failed++
+		}
+	}
+	fmt.Printf("%d of %d writes failed to reach quorum\n", failed, N)
+}
+
+func TestShardFailures(t *testing.T) {
+	ports := []int{5730, 5731, 5732}
+	endpoints := make([]string, 0, len(ports))
+	stop := make(map[string]func(), len(ports))
+	for _, port := range ports {
+		worker, server := startLocalWorker(t, port)
+		defer worker.Close()
+		defer server.Stop()
+		endpoint := "127.0.0.1:" + strconv.Itoa(port)
+		endpoints = append(endpoints, endpoint)
+		stop[endpoint] = server.Stop
+	}
+	hub := staticHub(endpoints)
+	sentinel := newSentinel(t, index_service.WithServiceHub(hub))
+	defer sentinel.Close()
+	const N = 30
+	for i := 0; i < N; i++ {
+		if _, err := sentinel.AddDoc(types.Document{Id: fmt.Sprintf("doc%02d", i), Keywords: []*types.Keyword{{Field: "tag", Word: "shard"}}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	query := &index_service.SearchRequest{Query: types.NewTermQuery("tag", "shard")}
+	result := sentinel.Search(query)
+	if result.TotalShards != 3 || result.SuccessfulShards != 3 || len(result.ShardFailures) > 0 || result.TotalHits != N {
+		t.Errorf("all shards should succeed, got %d/%d %v", result.SuccessfulShards, result.TotalShards, result.ShardFailures)
+	}
+
+	// 没有副本的分片宕机后，返回部分结果，并说明是哪个分片失败了
+	down := endpoints[2]
+	stop[down]()
+	result = sentinel.Search(query)
+	fmt.Printf("%d hits, %d of %d shards succeeded, failures %v\n", result.TotalHits, result.SuccessfulShards, result.TotalShards, result.ShardFailures)
+	if result.TotalShards != 3 || result.SuccessfulShards != 2 || len(result.ShardFailures) != 1 || result.ShardFailures[0].Shard != down {
+		t.Errorf("shard %s should fail", down)
+	}
+	if result.TotalHits == 0 || result.TotalHits >= N || len(result.Results) != int(result.TotalHits) {
+		t.Errorf("expect partial results, got %d hits", result.TotalHits)
+	}
+
+	// 要求所有分片都成功时，整个请求失败
+	strict := newSentinel(t, index_service.WithServiceHub(hub), index_service.WithMinSuccessfulShards(3))
+	defer strict.Close()
+	result, err := strict.SearchContext(context.Background(), query)
+	if !errors.Is(err, index_service.ErrTooFewShards) || len(result.Results) > 0 || result.SuccessfulShards != 2 {
+		t.Errorf("search should fail with too few shards, got %v", err)
+	}
+
+	// 通过http检索时返回503，而不是200和空结果
+	recorder := httptest.NewRecorder()
+	request := httptest.NewRequest("POST", "/_search", strings.NewReader(`{"query": {"term": {"tag": "shard"}}}`))
+	index_service.NewHttpServer(strict).ServeHTTP(recorder, request)
+	var response struct {
+		Shards struct {
+			Failed int `json:"failed"`
+		} `json:"_shards"`
+	}
+	json.Unmarshal(recorder.Body.Bytes(), &response)
+	if recorder.Code != http.StatusServiceUnavailable || response.Shards.Failed != 1 {
+		t.Errorf("expect 503 with 1 failed shard, got %d %s", recorder.Code, recorder.Body.String())
+	}
+}
+
+// go test -v ./index_service/test -run=^TestReplication$ -count=1
+// go test -v ./index_service/test -run=^TestShardFailures$ -count=1
@@ -0,0 +1,156 @@
+package test
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/kisaragi77/TinyES/index_service"
+	"github.com/kisaragi77/TinyES/types"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// 检索很慢的worker
+type delayedWorker struct {
+	*index_service.IndexServiceWorker
+	delay time.Duration
+}
+
+func (worker *delayedWorker) Search(ctx context.Context, request *index_service.SearchRequest) (*index_service.SearchResult, error) {
+	select {
+	case <-time.After(worker.delay):
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	return worker.IndexServiceWorker.Search(ctx, request)
+}
+
+// 前failures次统计会失败的worker
+type flakyWorker struct {
+	*index_service.IndexServiceWorker
+	failures int32
+}
+
+func (worker *flakyWorker) Count(ctx context.Context, request *index_service.CountRequest) (*index_service.AffectedCount, error) {
+	if atomic.AddInt32(&worker.failures, -1) >= 0 {
+		return nil, status.Error(codes.Unavailable, "temporarily unavailable")
+	}
+	return worker.IndexServiceWorker.Count(ctx, request)
+}
+
+// 统计很慢、记录调用次数的worker
+type countedWorker struct {
+	*index_service.IndexServiceWorker
+	delay time.Duration
+	calls atomic.Int32
+}
+
+func (worker *countedWorker) Count(ctx context.Context, request *index_service.CountRequest) (*index_service.AffectedCount, error) {
+	worker.calls.Add(1)
+	time.Sleep(worker.delay)
+	return worker.IndexServiceWorker.Count(ctx, request)
+}
+
+// 每个分片先访问哪个副本由hub的负载均衡策略决定，P2CEWMA根据每次请求的延迟避开慢的副本
+func TestBalancedReplicas(t *testing.T) {
+	counted := make([]*countedWorker, 0, 2)
+	endpoints := make([]string, 0, 2)
+	for i, port := range []int{5766, 5767} {
+		delay := time.Duration(1+i*50) * time.Millisecond
+		worker, server := startWrappedWorker(t, port, func(worker *index_service.IndexServiceWorker) index_service.IndexServiceServer {
+			w := &countedWorker{IndexServiceWorker: worker, delay: delay}
+			counted = append(counted, w)
+			return w
+		})
+		defer worker.Close()
+		defer server.Stop()
+		endpoints = append(endpoints, "127.0.0.1:"+strconv.Itoa(port))
+	}
+	hub := index_service.NewStaticHub(map[string][]string{index_service.INDEX_SERVICE: endpoints}, index_service.WithLoadBalancer(&index_service.P2CEWMA{}))
+	sentinel := newSentinel(t, index_service.WithServiceHub(hub), index_service.WithReplicationFactor(2))
+	defer sentinel.Close()
+	for i := 0; i < 20; i++ {
+		if result := sentinel.ClusterCount(context.Background()); !result.Complete() {
+			t.Fatalf("count failed: %+v", result)
+		}
+	}
+	fast, slow := counted[0].calls.Load(), counted[1].calls.Load()
+	fmt.Printf("fast worker called %d times, slow worker called %d times\n", fast, slow)
+	if fast+slow != 40 || slow > 5 {
+		t.Errorf("most counts should go to the fast worker, fast %d slow %d", fast, slow)
+	}
+}
+
+func TestHedgedSearch(t *testing.T) {
+	slow, server := startWrappedWorker(t, 5740, func(worker *index_service.IndexServiceWorker) index_service.IndexServiceServer {
+		return &delayedWorker{IndexServiceWorker: worker, delay: 2 * time.Second}
+	})
+	defer slow.Close()
+	defer server.Stop()
+	fast, server := startLocalWorker(t, 5741)
+	defer fast.Close()
+	defer server.Stop()
+	endpoints := []string{"127.0.0.1:5740", "127.0.0.1:5741"}
+
+	// 2个副本，每台worker上都有全部的doc
+	sentinel := newSentinel(t, index_service.WithServiceHub(staticHub(endpoints)), index_service.WithReplicationFactor(2),
+		index_service.WithHedgePolicy(index_service.HedgePolicy{Percentile: 0.9, MaxDelay: 50 * time.Millisecond}))
+	defer sentinel.Close()
+	const N = 20
+	for i := 0; i < N; i++ {
+		if _, err := sentinel.AddDoc(types.Document{Id: fmt.Sprintf("doc%02d", i), Keywords: []*types.Keyword{{Field: "tag", Word: "hedge"}}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 慢worker迟迟不返回，对冲请求发给另一个副本
+	begin := time.Now()
+	result, err := sentinel.SearchContext(context.Background(), &index_service.SearchRequest{Query: types.NewTermQuery("tag", "hedge")})
+	elapsed := time.Since(begin)
+	fmt.Printf("search %d hits, use time %s\n", result.TotalHits, elapsed)
+	if err != nil || result.TotalHits != N || result.SuccessfulShards != 2 {
+		t.Errorf("expect %d hits from 2 shards, got %d %v", N, result.TotalHits, err)
+	}
+	if elapsed > time.Second {
+		t.Errorf("hedged search should not wait for the slow worker")
+	}
+}
+
+func TestRetry(t *testing.T) {
+	port := 5742
+	worker, server := startWrappedWorker(t, port, func(worker *index_service.IndexServiceWorker) index_service.IndexServiceServer {
+		return &flakyWorker{IndexServiceWorker: worker, failures: 2}
+	})
+	defer worker.Close()
+	defer server.Stop()
+	hub := staticHub([]string{"127.0.0.1:" + strconv.Itoa(port)})
+	const N = 10
+	for i := 0; i < N; i++ {
+		worker.Indexer.AddDoc(types.Document{Id: fmt.Sprintf("doc%02d", i)})
+	}
+
+	// 不重试时，失败一次就放弃
+	sentinel := newSentinel(t, index_service.WithServiceHub(hub))
+	defer sentinel.Close()
+	if result := sentinel.ClusterCount(context.Background()); result.Complete() {
+		t.Errorf("count should fail without retry, got %+v", result)
+	}
+
+	// 重试时，第二次失败之后的重试成功
+	sentinel = newSentinel(t, index_service.WithServiceHub(hub),
+		index_service.WithRetryPolicy(index_service.RetryPolicy{MaxRetries: 3, InitialBackoff: 10 * time.Millisecond}))
+	defer sentinel.Close()
+	result := sentinel.ClusterCount(context.Background())
+	fmt.Printf("%+v\n", result)
+	if !result.Complete() || result.Total != N {
+		t.Errorf("count should succeed after retry, got %+v", result)
+	}
+}
+
+// go test -v ./index_service/test -run=^TestBalancedReplicas$ -count=1
+// go test -v ./index_service/test -run=^TestHedgedSearch$ -count=1
+// go test -v ./index_service/test -run=^TestRetry$ -count=1
@@ -12,7 +12,11 @@ var (
 )
 
 func TestGetServiceEndpoints(t *testing.T) {
-	hub := index_service.GetServiceHub(etcdServers, 3)
+	hub, err := index_service.NewServiceHub(index_service.WithEtcdServers(etcdServers), index_service.WithHeartbeat(3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer hub.Close()
 	endpoint := "127.0.0.1:5000"
 	hub.Regist(serviceName, endpoint, 0)
 	defer hub.UnRegist(serviceName, endpoint)
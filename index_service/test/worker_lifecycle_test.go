@@ -0,0 +1,133 @@
+package test
+
+import (
+	"context"
+	"reflect"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kisaragi77/TinyES/index_service"
+	"github.com/kisaragi77/TinyES/types"
+	"github.com/kisaragi77/TinyES/util"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+func TestWorkerLifecycle(t *testing.T) {
+	port := 5765
+	endpoint := "127.0.0.1:" + strconv.Itoa(port)
+	worker, server := startWrappedWorker(t, port, func(worker *index_service.IndexServiceWorker) index_service.IndexServiceServer {
+		return &delayedWorker{IndexServiceWorker: worker, delay: 300 * time.Millisecond}
+	})
+	defer server.Stop()
+	worker.Host = "127.0.0.1"
+	if _, err := worker.Indexer.AddDoc(types.Document{Id: "doc1", Keywords: []*types.Keyword{{Field: "content", Word: "唐朝"}}}); err != nil {
+		t.Fatal(err)
+	}
+	// 重启worker，磁盘上有doc还没加载
+	worker.Indexer.Close()
+	if err := worker.Init(1000, dbType, util.RootPath+"data/local_db/worker_"+strconv.Itoa(port)); err != nil {
+		t.Fatal(err)
+	}
+	if worker.Ready() {
+		t.Error("worker should not be ready before loading")
+	}
+
+	// 记录每次变化时worker发布的就绪状态
+	hub := index_service.NewMemoryHub()
+	var lock sync.Mutex
+	readiness := make([]bool, 0)
+	hub.OnEndpointsChange(index_service.INDEX_SERVICE, func(endpoints []string) {
+		lock.Lock()
+		defer lock.Unlock()
+		for _, info := range hub.GetServiceEndpointInfos(index_service.INDEX_SERVICE) {
+			if info.Endpoint == endpoint {
+				readiness = append(readiness, info.Ready)
+			}
+		}
+	})
+	if err := worker.RegistHub(hub, port); err != nil {
+		t.Fatal(err)
+	}
+
+	// 注册时还没有加载磁盘上的doc，是未就绪的，加载完立即发布为就绪
+	if n := worker.LoadFromIndexFile(); n != 1 {
+		t.Errorf("expect 1 document loaded, got %d", n)
+	}
+	lock.Lock()
+	if expect := []bool{false, true}; !reflect.DeepEqual(readiness, expect) {
+		t.Errorf("expect readiness %v, got %v", expect, readiness)
+	}
+	lock.Unlock()
+	if !worker.Ready() {
+		t.Error("worker should be ready after loading")
+	}
+
+	// 关闭时先注销，再等正在处理的请求结束
+	conn, err := grpc.DialContext(context.Background(), endpoint, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	client := index_service.NewIndexServiceClient(conn)
+	searched := make(chan error, 1)
+	go func() {
+		_, err := client.Search(context.Background(), &index_service.SearchRequest{Query: types.NewTermQuery("content", "唐朝")})
+		searched <- err
+	}()
+	time.Sleep(100 * time.Millisecond) //等请求到达worker
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	begin := time.Now()
+	if err := worker.Shutdown(ctx, server); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(begin); elapsed < 100*time.Millisecond {
+		t.Errorf("shutdown should wait for the in-flight search, returned in %s", elapsed)
+	}
+	if err := <-searched; err != nil {
+		t.Errorf("in-flight search should succeed: %s", err)
+	}
+	if endpoints := hub.GetServiceEndpoints(index_service.INDEX_SERVICE); len(endpoints) != 0 {
+		t.Errorf("worker should be deregistered, got %v", endpoints)
+	}
+	if err := worker.Close(); err != nil { //重复关闭不报错
+		t.Error(err)
+	}
+}
+
+func TestWorkerReadyWithoutLoading(t *testing.T) {
+	hub := index_service.NewMemoryHub()
+	port := 5705
+	endpoint := "127.0.0.1:" + strconv.Itoa(port)
+	worker, server := startLocalWorker(t, port)
+	defer worker.Shutdown(context.Background(), server)
+	worker.Host = "127.0.0.1"
+
+	// 磁盘上没有doc要加载，注册后直接是就绪的
+	if err := worker.RegistHub(hub, port); err != nil {
+		t.Fatal(err)
+	}
+	infos := hub.GetServiceEndpointInfos(index_service.INDEX_SERVICE)
+	if len(infos) != 1 || infos[0].Endpoint != endpoint || !infos[0].Ready {
+		t.Fatalf("worker should be published as ready, got %+v", infos)
+	}
+
+	sentinel := newSentinel(t, index_service.WithServiceHub(hub))
+	defer sentinel.Close()
+	if _, err := sentinel.AddDoc(types.Document{Id: "doc1", Keywords: []*types.Keyword{{Field: "content", Word: "唐朝"}}}); err != nil {
+		t.Fatal(err)
+	}
+	result, err := sentinel.SearchContext(context.Background(), &index_service.SearchRequest{Query: types.NewTermQuery("content", "唐朝")})
+	if err != nil || len(result.Results) != 1 {
+		t.Errorf("expect 1 document, got %+v %v", result, err)
+	}
+	if count := sentinel.ClusterCount(context.Background()); !count.Complete() || count.Workers[endpoint] != 1 {
+		t.Errorf("worker should serve queries, got %+v", count)
+	}
+}
+
+// go test -v ./index_service/test -run=^TestWorkerLifecycle$ -count=1
+// go test -v ./index_service/test -run=^TestWorkerReadyWithoutLoading$ -count=1
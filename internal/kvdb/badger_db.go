@@ -225,6 +225,30 @@ func (s *Badger) IterKey(fn func(k []byte) error) int64 {
 	return atomic.LoadInt64(&total)
 }
 
+// Seek 从第一个>=start的key开始按key的顺序遍历，直到fn返回false。传给fn的k和v是拷贝，可以在fn之外使用
+func (s *Badger) Seek(start []byte, fn func(k, v []byte) bool) {
+	s.db.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+		for it.Seek(start); it.Valid(); it.Next() {
+			item := it.Item()
+			v, err := item.ValueCopy(nil)
+			if err != nil {
+				continue
+			}
+			if !fn(item.KeyCopy(nil), v) {
+				break
+			}
+		}
+		return nil
+	})
+}
+
+// Sync 把已写入的数据fsync到磁盘。badger默认不同步写，调用Sync之后之前的写入才能在进程崩溃后保留
+func (s *Badger) Sync() error {
+	return s.db.Sync()
+}
+
 // Close 把内存中的数据flush到磁盘，同时释放文件锁。如果没有close，再open时会丢失很多数据
 func (s *Badger) Close() error {
 	return s.db.Close()
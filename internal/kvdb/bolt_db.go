@@ -180,6 +180,26 @@ func (s *Bolt) IterKey(fn func(k []byte) error) int64 {
 	return atomic.LoadInt64(&total)
 }
 
+// Seek iterates in key order from the first key >= start, until fn returns false. k and v are copied,
+// so they can be used outside fn.
+func (s *Bolt) Seek(start []byte, fn func(k, v []byte) bool) {
+	s.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(s.bucket).Cursor()
+		for k, v := c.Seek(start); k != nil; k, v = c.Next() {
+			if !fn(append([]byte{}, k...), append([]byte{}, v...)) {
+				break
+			}
+		}
+		return nil
+	})
+}
+
+// Sync executes fdatasync() against the database file. Every committed transaction is already synced
+// unless NoSync is set.
+func (s *Bolt) Sync() error {
+	return s.db.Sync()
+}
+
 // Close releases all database resources. All transactions must be closed before closing the database.
 func (s *Bolt) Close() error {
 	return s.db.Close()
@@ -14,18 +14,20 @@ const (
 )
 
 type IKeyValueDB interface {
-	Open() error                              // Initialize Database
-	GetDbPath() string                        /// Get path of Storage
-	Set(k, v []byte) error                    // Write <key, value>
-	BatchSet(keys, values [][]byte) error     // Write multiple <key, value> pairs
-	Get(k []byte) ([]byte, error)             // Read Value by Key
-	BatchGet(keys [][]byte) ([][]byte, error) // Read multiple values by keys (No order guarantee)
-	Delete(k []byte) error                    // Delete by Key
-	BatchDelete(keys [][]byte) error          // Delete multiple keys
-	Has(k []byte) bool                        // Check if the DB contains the given key
-	IterDB(fn func(k, v []byte) error) int64  // Iterate the whole DB with callback function
-	IterKey(fn func(k []byte) error) int64    // Iterate all keys with callback function
-	Close() error                             // Flush data in memory to disk and release file lock
+	Open() error                                  // Initialize Database
+	GetDbPath() string                            /// Get path of Storage
+	Set(k, v []byte) error                        // Write <key, value>
+	BatchSet(keys, values [][]byte) error         // Write multiple <key, value> pairs
+	Get(k []byte) ([]byte, error)                 // Read Value by Key
+	BatchGet(keys [][]byte) ([][]byte, error)     // Read multiple values by keys (No order guarantee)
+	Delete(k []byte) error                        // Delete by Key
+	BatchDelete(keys [][]byte) error              // Delete multiple keys
+	Has(k []byte) bool                            // Check if the DB contains the given key
+	IterDB(fn func(k, v []byte) error) int64      // Iterate the whole DB with callback function
+	IterKey(fn func(k []byte) error) int64        // Iterate all keys with callback function
+	Seek(start []byte, fn func(k, v []byte) bool) // Iterate in key order from the first key >= start, until fn returns false
+	Sync() error                                  // Flush written data to disk
+	Close() error                                 // Flush data in memory to disk and release file lock
 }
 
 // Factory Of KeyValueDB
@@ -133,6 +133,24 @@ func testIterDB(db kvdb.IKeyValueDB) error {
 	return nil
 }
 
+func testSeek(db kvdb.IKeyValueDB) error {
+	keys := [][]byte{[]byte("s1"), []byte("s2"), []byte("s3"), []byte("s4")}
+	db.BatchSet(keys, keys)
+	defer db.BatchDelete(keys)
+
+	fmt.Println("从s2开始遍历")
+	seen := make([]string, 0, 2)
+	db.Seek([]byte("s2"), func(k, v []byte) bool {
+		fmt.Printf("key=%s value=%s\n", string(k), string(v))
+		seen = append(seen, string(k))
+		return len(seen) < 2
+	})
+	if len(seen) != 2 || seen[0] != "s2" || seen[1] != "s3" {
+		return fmt.Errorf("seek from s2 got %v", seen)
+	}
+	return nil
+}
+
 func testPipeline(t *testing.T) { //整个测试流
 	defer teardown()
 	setup()
@@ -160,4 +178,11 @@ func testPipeline(t *testing.T) { //整个测试流
 		t.Fail()
 	}
 	fmt.Println()
+
+	err = testSeek(db)
+	if err != nil {
+		fmt.Println(err)
+		t.Fail()
+	}
+	fmt.Println()
 }
@@ -1,9 +1,22 @@
 package reverseindex
 
-import "github.com/kisaragi77/TinyES/types"
+import (
+	"context"
+
+	"github.com/kisaragi77/TinyES/types"
+)
 
 type IReverseIndexer interface {
-	Add(doc types.Document)                                                              // Add a doc to the reverse index
-	Delete(IntId uint64, keyword *types.Keyword)                                         // Delete a keyword from the reverse index
-	Search(q *types.TermQuery, onFlag uint64, offFlag uint64, orFlags []uint64) []string // Find the query in the reverse index, return unique Id
+	Add(doc types.Document)                                                                 // Add a doc to the reverse index
+	Delete(IntId uint64, keyword *types.Keyword)                                            // Delete a keyword from the reverse index
+	Search(q *types.TermQuery, onFlag uint64, offFlag uint64, orFlags []uint64) []SearchHit // Find the query in the reverse index, return hits with BM25 score
+	// Same as Search, but give up and return ctx.Err() if ctx is done before finished
+	SearchContext(ctx context.Context, q *types.TermQuery, onFlag uint64, offFlag uint64, orFlags []uint64) ([]SearchHit, error)
+}
+
+// A document matched by the query
+type SearchHit struct {
+	IntId uint64
+	Id    string  // Unique Id of the document
+	Score float64 // BM25 relevance score
 }
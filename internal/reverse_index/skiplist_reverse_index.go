@@ -1,6 +1,8 @@
 package reverseindex
 
 import (
+	"context"
+	"math"
 	"runtime"
 	"sync"
 
@@ -10,9 +12,27 @@ import (
 	farmhash "github.com/leemcloughlin/gofarmhash"
 )
 
+// Parameters of BM25
+const (
+	BM25_K1 = 1.2
+	BM25_B  = 0.75
+)
+
+// Check cancellation of the context once every so many nodes when traversing a SkipList
+const CANCEL_CHECK_INTERVAL = 1024
+
 type SkipListReverseIndex struct {
 	table *util.ConcurrentHashMap // Store the reverse index with Concurrent HashMap
 	locks []sync.RWMutex          // Locks for each map,. the same key need to compete for one lock
+	stats *docStats               // Collection statistics used by BM25
+}
+
+// Statistics of the documents in the reverse index
+type docStats struct {
+	sync.RWMutex
+	postings map[uint64]int // IntId -> number of keywords still in the index
+	docCount int            // Number of documents
+	totalLen int            // Sum of the length of all documents
 }
 
 // DocNumEstimate : the estimated number of documents
@@ -20,6 +40,7 @@ func NewSkipListReverseIndex(DocNumEstimate int) *SkipListReverseIndex {
 	indexer := new(SkipListReverseIndex)
 	indexer.table = util.NewConcurrentHashMap(runtime.NumCPU(), DocNumEstimate)
 	indexer.locks = make([]sync.RWMutex, 1000)
+	indexer.stats = &docStats{postings: make(map[uint64]int, DocNumEstimate)}
 	return indexer
 }
 
@@ -31,14 +52,28 @@ func (indexer SkipListReverseIndex) getLock(key string) *sync.RWMutex {
 type SkipListValue struct {
 	Id          string
 	BitsFeature uint64
+	TermFreq    int     // Occurrences of the keyword in the document
+	DocLen      int     // Number of keywords in the document
+	Score       float64 // Relevance score, only filled in search results
 }
 
 func (indexer *SkipListReverseIndex) Add(doc types.Document) {
+	termFreq := make(map[string]int, len(doc.Keywords))
 	for _, keyword := range doc.Keywords {
-		key := keyword.ToString()
+		termFreq[keyword.ToString()]++
+	}
+	indexer.stats.Lock()
+	if _, exists := indexer.stats.postings[doc.IntId]; !exists {
+		indexer.stats.docCount++
+		indexer.stats.totalLen += len(doc.Keywords)
+	}
+	indexer.stats.postings[doc.IntId] = len(termFreq)
+	indexer.stats.Unlock()
+
+	for key, tf := range termFreq {
 		lock := indexer.getLock(key)
 		lock.Lock()
-		sklValue := SkipListValue{doc.Id, doc.BitsFeature}
+		sklValue := SkipListValue{Id: doc.Id, BitsFeature: doc.BitsFeature, TermFreq: tf, DocLen: len(doc.Keywords)}
 		if value, exists := indexer.table.Get(key); exists {
 			list := value.(*skiplist.SkipList)
 			list.Set(doc.IntId, sklValue) // Key : IntId ; Value : uniqueId and BitsFeature
@@ -56,11 +91,57 @@ func (indexer *SkipListReverseIndex) Delete(IntId uint64, keyword *types.Keyword
 	key := keyword.ToString()
 	lock := indexer.getLock(key)
 	lock.Lock()
+	var removed *skiplist.Element
 	if value, exists := indexer.table.Get(key); exists {
 		list := value.(*skiplist.SkipList)
-		list.Remove(IntId)
+		removed = list.Remove(IntId)
 	}
 	lock.Unlock()
+
+	if removed != nil {
+		indexer.stats.Lock()
+		if n, exists := indexer.stats.postings[IntId]; exists {
+			if n <= 1 { // The last keyword of the document is gone
+				delete(indexer.stats.postings, IntId)
+				indexer.stats.docCount--
+				indexer.stats.totalLen -= removed.Value.(SkipListValue).DocLen
+			} else {
+				indexer.stats.postings[IntId] = n - 1
+			}
+		}
+		indexer.stats.Unlock()
+	}
+}
+
+// BM25 score of a keyword in a document.
+//
+// df : number of documents containing the keyword
+func (indexer SkipListReverseIndex) bm25(tf, docLen, df int) float64 {
+	indexer.stats.RLock()
+	n, totalLen := indexer.stats.docCount, indexer.stats.totalLen
+	indexer.stats.RUnlock()
+	if n == 0 || tf == 0 {
+		return 0
+	}
+	avgLen := float64(totalLen) / float64(n)
+	idf := math.Log(1 + (float64(n)-float64(df)+0.5)/(float64(df)+0.5))
+	norm := 1 - BM25_B
+	if avgLen > 0 {
+		norm += BM25_B * float64(docLen) / avgLen
+	}
+	return idf * float64(tf) * (BM25_K1 + 1) / (float64(tf) + BM25_K1*norm)
+}
+
+// Merge the values of the same IntId from different SkipLists, the scores are accumulated.
+func mergeValue(a, b any) any {
+	va, ok := a.(SkipListValue)
+	if !ok {
+		return a
+	}
+	if vb, ok := b.(SkipListValue); ok {
+		va.Score += vb.Score
+	}
+	return va
 }
 
 // Get intersection of SkipLists
@@ -91,7 +172,11 @@ func IntersectionOfSkipList(lists ...*skiplist.SkipList) *skiplist.SkipList {
 			}
 		}
 		if len(maxList) == len(currNodes) {
-			result.Set(currNodes[0].Key(), currNodes[0].Value)
+			value := currNodes[0].Value
+			for _, node := range currNodes[1:] {
+				value = mergeValue(value, node.Value)
+			}
+			result.Set(currNodes[0].Key(), value)
 			for i, node := range currNodes {
 				currNodes[i] = node.Next()
 				if currNodes[i] == nil {
@@ -111,7 +196,7 @@ func IntersectionOfSkipList(lists ...*skiplist.SkipList) *skiplist.SkipList {
 	}
 }
 
-// Get unionset of SkipLists
+// Get unionset of SkipLists, the scores of the same IntId are accumulated
 func UnionsetOfSkipList(lists ...*skiplist.SkipList) *skiplist.SkipList {
 	if len(lists) == 0 {
 		return nil
@@ -119,21 +204,83 @@ func UnionsetOfSkipList(lists ...*skiplist.SkipList) *skiplist.SkipList {
 	if len(lists) == 1 {
 		return lists[0]
 	}
+	return MinMatchOfSkipList(1, lists...)
+}
+
+// Get the IntIds contained in at least minMatch of the SkipLists, the scores of the same IntId are accumulated
+func MinMatchOfSkipList(minMatch int, lists ...*skiplist.SkipList) *skiplist.SkipList {
+	if len(lists) == 0 || minMatch > len(lists) {
+		return nil
+	}
 	result := skiplist.New(skiplist.Uint64)
-	keySet := make(map[any]struct{}, 1000)
+	keySet := make(map[any]*skiplist.Element, 1000)
+	matchCount := make(map[any]int, 1000) // Number of lists containing the key
 	for _, list := range lists {
 		if list == nil {
 			continue
 		}
 		node := list.Front()
 		for node != nil {
-			if _, exists := keySet[node.Key()]; !exists {
-				result.Set(node.Key(), node.Value)
-				keySet[node.Key()] = struct{}{}
+			if elem, exists := keySet[node.Key()]; !exists {
+				keySet[node.Key()] = result.Set(node.Key(), node.Value)
+			} else {
+				elem.Value = mergeValue(elem.Value, node.Value)
 			}
+			matchCount[node.Key()]++
 			node = node.Next()
 		}
 	}
+	if minMatch > 1 {
+		for key, n := range matchCount {
+			if n < minMatch {
+				result.Remove(key)
+			}
+		}
+	}
+	return result
+}
+
+// Multiply the scores in the SkipList by boost
+func boostSkipList(list *skiplist.SkipList, boost float32) {
+	if list == nil || boost <= 0 || boost == 1 {
+		return
+	}
+	for node := list.Front(); node != nil; node = node.Next() {
+		if skv, ok := node.Value.(SkipListValue); ok {
+			skv.Score *= float64(boost)
+			node.Value = skv
+		}
+	}
+}
+
+// Get the elements of list which are not in any of the excludes
+func DifferenceOfSkipList(list *skiplist.SkipList, excludes ...*skiplist.SkipList) *skiplist.SkipList {
+	if list == nil {
+		return nil
+	}
+	result := skiplist.New(skiplist.Uint64)
+	currNodes := make([]*skiplist.Element, 0, len(excludes))
+	for _, exclude := range excludes {
+		if exclude != nil && exclude.Len() > 0 {
+			currNodes = append(currNodes, exclude.Front())
+		}
+	}
+	for node := list.Front(); node != nil; node = node.Next() {
+		key := node.Key().(uint64)
+		excluded := false
+		for i, curr := range currNodes {
+			for curr != nil && curr.Key().(uint64) < key { //Both lists are sorted, move forward till not less than key
+				curr = curr.Next()
+			}
+			currNodes[i] = curr
+			if curr != nil && curr.Key().(uint64) == key {
+				excluded = true
+			}
+		}
+		if !excluded {
+			result.Set(key, node.Value)
+		}
+	}
 	return result
 }
 
@@ -156,54 +303,92 @@ func (indexer SkipListReverseIndex) FilterByBits(bits uint64, onFlag uint64, off
 	return true
 }
 
-// Return the SkipList of the query(Private method)
-func (indexer SkipListReverseIndex) search(q *types.TermQuery, onFlag uint64, offFlag uint64, orFlags []uint64) *skiplist.SkipList {
+// Return the SkipList of the query(Private method). Return nil as soon as ctx is done, the caller should check ctx.Err()
+func (indexer SkipListReverseIndex) search(ctx context.Context, q *types.TermQuery, onFlag uint64, offFlag uint64, orFlags []uint64) *skiplist.SkipList {
+	if ctx.Err() != nil {
+		return nil
+	}
+	var result *skiplist.SkipList
+	excludes := make([]*types.TermQuery, 0, len(q.MustNot))
+	excludes = append(excludes, q.MustNot...)
 	if q.Keyword != nil {
 		Keyword := q.Keyword.ToString()
 		if value, exists := indexer.table.Get(Keyword); exists {
-			result := skiplist.New(skiplist.Uint64)
+			result = skiplist.New(skiplist.Uint64)
 			list := value.(*skiplist.SkipList)
 			// util.Log.Printf("retrive %d docs by key %s", list.Len(), Keyword)
+			df := list.Len()
 			node := list.Front()
-			for node != nil {
+			for i := 1; node != nil; i++ {
+				if i%CANCEL_CHECK_INTERVAL == 0 && ctx.Err() != nil {
+					return nil
+				}
 				intId := node.Key().(uint64)
 				skv, _ := node.Value.(SkipListValue)
 				flag := skv.BitsFeature
 				if intId > 0 && indexer.FilterByBits(flag, onFlag, offFlag, orFlags) { //确保有效元素都大于0
+					skv.Score = indexer.bm25(skv.TermFreq, skv.DocLen, df)
 					result.Set(intId, skv)
 				}
 				node = node.Next()
 			}
-			return result
 		}
 	} else if len(q.Must) > 0 {
 		results := make([]*skiplist.SkipList, 0, len(q.Must))
 		for _, q := range q.Must {
-			results = append(results, indexer.search(q, onFlag, offFlag, orFlags))
+			if q.Keyword == nil && len(q.Must) == 0 && len(q.Should) == 0 { //Pure negation like A&-B, exclude it from the intersection
+				excludes = append(excludes, q.MustNot...)
+				continue
+			}
+			results = append(results, indexer.search(ctx, q, onFlag, offFlag, orFlags))
 		}
-		return IntersectionOfSkipList(results...)
+		result = IntersectionOfSkipList(results...)
 	} else if len(q.Should) > 0 {
 		results := make([]*skiplist.SkipList, 0, len(q.Should))
 		for _, q := range q.Should {
-			results = append(results, indexer.search(q, onFlag, offFlag, orFlags))
+			results = append(results, indexer.search(ctx, q, onFlag, offFlag, orFlags))
+		}
+		if q.MinimumShouldMatch > 1 {
+			result = MinMatchOfSkipList(int(q.MinimumShouldMatch), results...)
+		} else {
+			result = UnionsetOfSkipList(results...)
 		}
-		return UnionsetOfSkipList(results...)
 	}
-	return nil
+	if ctx.Err() != nil {
+		return nil
+	}
+	boostSkipList(result, q.Boost)           //Lists returned by search are always newly created, so it's safe to modify them
+	if result == nil || len(excludes) == 0 { //A query with only MustNot matches nothing
+		return result
+	}
+	lists := make([]*skiplist.SkipList, 0, len(excludes))
+	for _, q := range excludes {
+		lists = append(lists, indexer.search(ctx, q, onFlag, offFlag, orFlags))
+	}
+	return DifferenceOfSkipList(result, lists...)
 }
 
-// Return DocId array of the query using 'search' method.
-func (indexer SkipListReverseIndex) Search(query *types.TermQuery, onFlag uint64, offFlag uint64, orFlags []uint64) []string {
-	result := indexer.search(query, onFlag, offFlag, orFlags)
+// Return hits of the query in IntId order using 'search' method.
+func (indexer SkipListReverseIndex) Search(query *types.TermQuery, onFlag uint64, offFlag uint64, orFlags []uint64) []SearchHit {
+	hits, _ := indexer.SearchContext(context.Background(), query, onFlag, offFlag, orFlags)
+	return hits
+}
+
+// Same as Search, but give up and return ctx.Err() when ctx is done
+func (indexer SkipListReverseIndex) SearchContext(ctx context.Context, query *types.TermQuery, onFlag uint64, offFlag uint64, orFlags []uint64) ([]SearchHit, error) {
+	result := indexer.search(ctx, query, onFlag, offFlag, orFlags)
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 	if result == nil {
-		return nil
+		return nil, nil
 	}
-	arr := make([]string, 0, result.Len())
+	arr := make([]SearchHit, 0, result.Len())
 	node := result.Front()
 	for node != nil {
 		skv, _ := node.Value.(SkipListValue)
-		arr = append(arr, skv.Id)
+		arr = append(arr, SearchHit{IntId: node.Key().(uint64), Id: skv.Id, Score: skv.Score})
 		node = node.Next()
 	}
-	return arr
+	return arr, nil
 }
@@ -1,12 +1,16 @@
 package test
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"math"
 	"strings"
 	"testing"
 
 	"github.com/huandu/skiplist"
 	reverseindex "github.com/kisaragi77/TinyES/internal/reverse_index"
+	"github.com/kisaragi77/TinyES/types"
 )
 
 func TestIntersectionOfSkipList(t *testing.T) {
@@ -113,6 +117,165 @@ func TestIntersectionOfSkipList(t *testing.T) {
 		}
 	}
 	fmt.Println("\n" + strings.Repeat("-", 50))
+
+	diff := reverseindex.DifferenceOfSkipList(l1, l2, l3) // 1 11
+	if diff != nil {
+		node := diff.Front()
+		for node != nil {
+			fmt.Printf("%d ", node.Key().(uint64))
+			node = node.Next()
+		}
+	}
+	fmt.Println("\n" + strings.Repeat("-", 50))
+}
+
+func TestSearchScore(t *testing.T) {
+	indexer := reverseindex.NewSkipListReverseIndex(100)
+	go1 := &types.Keyword{Field: "title", Word: "go"}
+	rust := &types.Keyword{Field: "title", Word: "rust"}
+	pike := &types.Keyword{Field: "author", Word: "pike"}
+	indexer.Add(types.Document{Id: "a", IntId: 1, Keywords: []*types.Keyword{go1, go1, pike}}) //go出现2次
+	indexer.Add(types.Document{Id: "b", IntId: 2, Keywords: []*types.Keyword{go1, rust, rust, pike}})
+	indexer.Add(types.Document{Id: "c", IntId: 3, Keywords: []*types.Keyword{rust}})
+
+	hits := indexer.Search(&types.TermQuery{Keyword: go1}, 0, 0, nil)
+	for _, hit := range hits {
+		fmt.Printf("%s %.4f\n", hit.Id, hit.Score)
+	}
+	if len(hits) != 2 || hits[0].Score <= hits[1].Score {
+		t.Errorf("doc a should score higher than doc b on title:go")
+	}
+
+	// Must的得分是各子句得分之和
+	single := indexer.Search(&types.TermQuery{Keyword: pike}, 0, 0, nil)
+	must := indexer.Search(types.NewTermQuery("title", "go").And(types.NewTermQuery("author", "pike")), 0, 0, nil)
+	if len(must) != 2 {
+		t.Fatalf("expect 2 hits, got %d", len(must))
+	}
+	for i := range must {
+		if math.Abs(must[i].Score-hits[i].Score-single[i].Score) > 1e-9 {
+			t.Errorf("score of %s is not accumulated", must[i].Id)
+		}
+	}
+
+	// Should只匹配1个子句的文档，得分低于匹配2个子句的文档
+	should := indexer.Search(types.NewTermQuery("title", "go").Or(types.NewTermQuery("title", "rust")), 0, 0, nil)
+	for _, hit := range should {
+		fmt.Printf("%s %.4f\n", hit.Id, hit.Score)
+	}
+	if len(should) != 3 || should[1].Score <= should[2].Score {
+		t.Errorf("doc b should score higher than doc c on title:go|title:rust")
+	}
+
+	// 删除文档之后，title:rust变得更稀有，idf随之变大
+	indexer.Delete(3, rust)
+	after := indexer.Search(&types.TermQuery{Keyword: rust}, 0, 0, nil)
+	before := should[1].Score - hits[1].Score
+	if len(after) != 1 || after[0].Score <= before {
+		t.Errorf("idf of title:rust should increase after deleting doc c")
+	}
+}
+
+func TestMustNot(t *testing.T) {
+	indexer := reverseindex.NewSkipListReverseIndex(100)
+	phone := &types.Keyword{Field: "category", Word: "phone"}
+	acme := &types.Keyword{Field: "brand", Word: "acme"}
+	red := &types.Keyword{Field: "color", Word: "red"}
+	indexer.Add(types.Document{Id: "a", IntId: 1, Keywords: []*types.Keyword{phone, acme}})
+	indexer.Add(types.Document{Id: "b", IntId: 2, Keywords: []*types.Keyword{phone, red}})
+	indexer.Add(types.Document{Id: "c", IntId: 3, Keywords: []*types.Keyword{phone}})
+	indexer.Add(types.Document{Id: "d", IntId: 4, Keywords: []*types.Keyword{acme, red}})
+
+	expect := func(q *types.TermQuery, ids ...string) {
+		hits := indexer.Search(q, 0, 0, nil)
+		fmt.Printf("%s:", q.ToString())
+		for _, hit := range hits {
+			fmt.Printf(" %s", hit.Id)
+		}
+		fmt.Println()
+		if len(hits) != len(ids) {
+			t.Errorf("expect %v, got %d hits", ids, len(hits))
+			return
+		}
+		for i, hit := range hits {
+			if hit.Id != ids[i] {
+				t.Errorf("expect %v, got %s at %d", ids, hit.Id, i)
+			}
+		}
+	}
+	expect(types.NewTermQuery("category", "phone").Not(types.NewTermQuery("brand", "acme")), "b", "c")
+	expect(types.NewTermQuery("category", "phone").Not(types.NewTermQuery("brand", "acme"), types.NewTermQuery("color", "red")), "c")
+	// 纯否定的子句与其他子句And在一起
+	expect(types.NewTermQuery("color", "red").And(new(types.TermQuery).Not(types.NewTermQuery("brand", "acme"))), "b")
+	// 只有否定子句的查询什么都不匹配
+	expect(new(types.TermQuery).Not(types.NewTermQuery("brand", "acme")))
+}
+
+func TestMinimumShouldMatchAndBoost(t *testing.T) {
+	indexer := reverseindex.NewSkipListReverseIndex(100)
+	a := &types.Keyword{Field: "tag", Word: "a"}
+	b := &types.Keyword{Field: "tag", Word: "b"}
+	c := &types.Keyword{Field: "tag", Word: "c"}
+	indexer.Add(types.Document{Id: "1", IntId: 1, Keywords: []*types.Keyword{a}})
+	indexer.Add(types.Document{Id: "2", IntId: 2, Keywords: []*types.Keyword{a, b}})
+	indexer.Add(types.Document{Id: "3", IntId: 3, Keywords: []*types.Keyword{a, b, c}})
+	indexer.Add(types.Document{Id: "4", IntId: 4, Keywords: []*types.Keyword{b, c}})
+
+	q := types.NewTermQuery("tag", "a").Or(types.NewTermQuery("tag", "b"), types.NewTermQuery("tag", "c"))
+	for n := 1; n <= 4; n++ {
+		hits := indexer.Search(q.WithMinimumShouldMatch(n), 0, 0, nil)
+		fmt.Printf("%s:", q.ToString())
+		for _, hit := range hits {
+			fmt.Printf(" %s", hit.Id)
+		}
+		fmt.Println()
+		expect := []int{4, 3, 1, 0}[n-1]
+		if len(hits) != expect {
+			t.Errorf("minimum should match %d, expect %d hits, got %d", n, expect, len(hits))
+		}
+	}
+
+	// 提升tag:c的权重后，文档4的得分超过文档2
+	q = types.NewTermQuery("tag", "a").Or(types.NewTermQuery("tag", "b"), types.NewTermQuery("tag", "c").WithBoost(10))
+	hits := indexer.Search(q, 0, 0, nil)
+	fmt.Printf("%s:", q.ToString())
+	for _, hit := range hits {
+		fmt.Printf(" %s(%.4f)", hit.Id, hit.Score)
+	}
+	fmt.Println()
+	if len(hits) != 4 || hits[3].Score <= hits[1].Score {
+		t.Errorf("boosted doc 4 should score higher than doc 2")
+	}
+	plain := indexer.Search(types.NewTermQuery("tag", "a"), 0, 0, nil)
+	boosted := indexer.Search(types.NewTermQuery("tag", "a").WithBoost(2), 0, 0, nil)
+	if math.Abs(boosted[0].Score-2*plain[0].Score) > 1e-9 {
+		t.Errorf("boost should multiply the score")
+	}
+}
+
+func TestSearchContext(t *testing.T) {
+	indexer := reverseindex.NewSkipListReverseIndex(10000)
+	kw := &types.Keyword{Field: "tag", Word: "a"}
+	for i := 1; i <= 10000; i++ {
+		indexer.Add(types.Document{Id: fmt.Sprint(i), IntId: uint64(i), Keywords: []*types.Keyword{kw}})
+	}
+	q := types.NewTermQuery("tag", "a")
+	hits, err := indexer.SearchContext(context.Background(), q, 0, 0, nil)
+	if err != nil || len(hits) != 10000 {
+		t.Errorf("expect 10000 hits, got %d %v", len(hits), err)
+	}
+
+	// 已取消的ctx，检索立即放弃
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	hits, err = indexer.SearchContext(ctx, q.Or(types.NewTermQuery("tag", "b")), 0, 0, nil)
+	if !errors.Is(err, context.Canceled) || hits != nil {
+		t.Errorf("search should be canceled, got %d hits %v", len(hits), err)
+	}
 }
 
 //  go test -v ./internal/reverse_index/test -run=^TestIntersectionOfSkipList$ -count=1
+//  go test -v ./internal/reverse_index/test -run=^TestSearchScore$ -count=1
+//  go test -v ./internal/reverse_index/test -run=^TestMustNot$ -count=1
+//  go test -v ./internal/reverse_index/test -run=^TestMinimumShouldMatchAndBoost$ -count=1
+//  go test -v ./internal/reverse_index/test -run=^TestSearchContext$ -count=1
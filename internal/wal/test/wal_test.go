@@ -0,0 +1,101 @@
+package test
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/kisaragi77/TinyES/internal/wal"
+	"github.com/kisaragi77/TinyES/util"
+)
+
+func TestWal(t *testing.T) {
+	path := util.RootPath + "data/wal/test.wal"
+	os.Remove(path)
+	log, err := wal.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 并发写入，由group commit合并fsync
+	const P, N = 10, 100
+	wg := sync.WaitGroup{}
+	wg.Add(P)
+	for i := 0; i < P; i++ {
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < N; j++ {
+				key := []byte(fmt.Sprintf("k%d_%d", i, j))
+				if err := log.Append(wal.OP_PUT, key, []byte("value")); err != nil {
+					t.Error(err)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	log.Append(wal.OP_DELETE, []byte("k0_0"), nil)
+	log.Close()
+	if err := log.Append(wal.OP_PUT, []byte("k"), nil); err != wal.ErrClosed {
+		t.Errorf("append to closed wal should fail")
+	}
+
+	// 模拟写到一半时崩溃
+	size := fileSize(path)
+	f, _ := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0o644)
+	f.Write([]byte{100, 0, 0, 0, 1, 2, 3})
+	f.Close()
+
+	log, err = wal.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var lastSeq uint64
+	keys := make(map[string]bool)
+	n, err := log.Replay(func(record *wal.Record) error {
+		if record.Seq != lastSeq+1 {
+			t.Errorf("expect seq %d, got %d", lastSeq+1, record.Seq)
+		}
+		lastSeq = record.Seq
+		switch record.Op {
+		case wal.OP_PUT:
+			keys[string(record.Key)] = true
+		case wal.OP_DELETE:
+			delete(keys, string(record.Key))
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != P*N+1 || len(keys) != P*N-1 {
+		t.Errorf("expect %d records and %d keys, got %d and %d", P*N+1, P*N-1, n, len(keys))
+	}
+	if fileSize(path) != size {
+		t.Errorf("torn record should be truncated")
+	}
+
+	if err := log.Truncate(); err != nil {
+		t.Fatal(err)
+	}
+	log.Append(wal.OP_PUT, []byte("after_truncate"), []byte("v"))
+	n, _ = log.Replay(func(record *wal.Record) error {
+		if string(record.Key) != "after_truncate" || record.Seq != lastSeq+1 {
+			t.Errorf("unexpected record %d %s", record.Seq, record.Key)
+		}
+		return nil
+	})
+	if n != 1 {
+		t.Errorf("expect 1 record after truncate, got %d", n)
+	}
+	log.Close()
+}
+
+func fileSize(path string) int64 {
+	info, err := os.Stat(path)
+	if err != nil {
+		return -1
+	}
+	return info.Size()
+}
+
+// go test -v ./internal/wal/test -run=^TestWal$ -count=1
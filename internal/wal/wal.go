@@ -0,0 +1,284 @@
+package wal
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/kisaragi77/TinyES/util"
+)
+
+// Types of mutation recorded in the log
+const (
+	OP_PUT    byte = iota + 1 // Set Key to Value
+	OP_DELETE                 // Delete Key
+)
+
+const (
+	HEADER_SIZE    = 8       // length(4 bytes) + crc32 of the payload(4 bytes)
+	MAX_BATCH_SIZE = 1024    // Max number of records written by one fsync
+	MAX_RECORD     = 1 << 30 // A larger length in the header means the record is corrupted
+)
+
+var (
+	ErrClosed  = errors.New("wal is closed")
+	crc32Table = crc32.MakeTable(crc32.Castagnoli)
+)
+
+// A mutation in the log
+type Record struct {
+	Seq   uint64 // Sequence number, increases by 1 for each record
+	Op    byte
+	Key   []byte
+	Value []byte // Empty for OP_DELETE
+}
+
+// Write-ahead log in a single file. Each record is framed as
+//
+//	| length uint32 | crc32 uint32 | seq uint64 | op byte | key length uvarint | key | value |
+//
+// where length and crc32 cover everything after the header.
+//
+// Append is safe for concurrent use. Concurrent appends are group committed: a background goroutine
+// writes all the pending records and fsyncs the file once for them.
+type WAL struct {
+	path   string
+	file   *os.File
+	writer *bufio.Writer
+	size   int64
+	seq    uint64
+	lock   sync.Mutex // Guard file, writer, size and seq
+
+	queue     chan *appendRequest
+	closed    bool
+	closeLock sync.RWMutex
+	done      chan struct{}
+}
+
+type appendRequest struct {
+	record *Record
+	result chan error
+}
+
+// Open the log file, create it if not exists
+func Open(path string) (*WAL, error) {
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	w := &WAL{
+		path:   path,
+		file:   file,
+		writer: bufio.NewWriterSize(file, 64*1024),
+		size:   info.Size(),
+		queue:  make(chan *appendRequest, MAX_BATCH_SIZE),
+		done:   make(chan struct{}),
+	}
+	go w.commitLoop()
+	return w, nil
+}
+
+func (w *WAL) Path() string {
+	return w.path
+}
+
+// Size of the log file in bytes
+func (w *WAL) Size() int64 {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	return w.size
+}
+
+// Append a record and wait until it is synced to disk
+func (w *WAL) Append(op byte, key, value []byte) error {
+	request := &appendRequest{
+		record: &Record{Op: op, Key: key, Value: value},
+		result: make(chan error, 1),
+	}
+	w.closeLock.RLock()
+	if w.closed {
+		w.closeLock.RUnlock()
+		return ErrClosed
+	}
+	w.queue <- request
+	w.closeLock.RUnlock()
+	return <-request.result
+}
+
+// Collect the pending requests into one batch, write and fsync them together
+func (w *WAL) commitLoop() {
+	defer close(w.done)
+	batch := make([]*appendRequest, 0, MAX_BATCH_SIZE)
+	for request := range w.queue {
+		batch = append(batch[:0], request)
+	collect:
+		for len(batch) < MAX_BATCH_SIZE {
+			select {
+			case request, ok := <-w.queue:
+				if !ok {
+					break collect
+				}
+				batch = append(batch, request)
+			default:
+				break collect
+			}
+		}
+		err := w.writeBatch(batch)
+		if err != nil {
+			util.Log.Printf("write %d records to wal %s failed: %s", len(batch), w.path, err)
+		}
+		for _, request := range batch {
+			request.result <- err
+		}
+	}
+}
+
+func (w *WAL) writeBatch(batch []*appendRequest) error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	for _, request := range batch {
+		w.seq++
+		request.record.Seq = w.seq
+		frame := encode(request.record)
+		if _, err := w.writer.Write(frame); err != nil {
+			return err
+		}
+		w.size += int64(len(frame))
+	}
+	if err := w.writer.Flush(); err != nil {
+		return err
+	}
+	return w.file.Sync()
+}
+
+func encode(record *Record) []byte {
+	payloadLen := 8 + 1 + binary.MaxVarintLen64 + len(record.Key) + len(record.Value)
+	buf := make([]byte, HEADER_SIZE+payloadLen)
+	payload := buf[HEADER_SIZE:]
+	binary.LittleEndian.PutUint64(payload, record.Seq)
+	payload[8] = record.Op
+	n := 9
+	n += binary.PutUvarint(payload[n:], uint64(len(record.Key)))
+	n += copy(payload[n:], record.Key)
+	n += copy(payload[n:], record.Value)
+	payload = payload[:n]
+	binary.LittleEndian.PutUint32(buf, uint32(n))
+	binary.LittleEndian.PutUint32(buf[4:], crc32.Checksum(payload, crc32Table))
+	return buf[:HEADER_SIZE+n]
+}
+
+func decode(payload []byte) (*Record, bool) {
+	if len(payload) < 10 {
+		return nil, false
+	}
+	record := &Record{Seq: binary.LittleEndian.Uint64(payload), Op: payload[8]}
+	keyLen, n := binary.Uvarint(payload[9:])
+	if n <= 0 || uint64(len(payload)-9-n) < keyLen {
+		return nil, false
+	}
+	payload = payload[9+n:]
+	record.Key = payload[:keyLen]
+	record.Value = payload[keyLen:]
+	return record, true
+}
+
+// Call fn on each record from the beginning of the log, return the number of records replayed.
+//
+// A torn or corrupted record means the process crashed while writing it, which was never acknowledged,
+// so the log is truncated there. Replay should be called before any Append.
+func (w *WAL) Replay(fn func(record *Record) error) (int, error) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if _, err := w.file.Seek(0, io.SeekStart); err != nil {
+		return 0, err
+	}
+	reader := bufio.NewReaderSize(w.file, 64*1024)
+	header := make([]byte, HEADER_SIZE)
+	var offset int64
+	n := 0
+	for {
+		if _, err := io.ReadFull(reader, header); err != nil {
+			if err != io.EOF {
+				util.Log.Printf("wal %s has a torn header at offset %d", w.path, offset)
+			}
+			break
+		}
+		length := binary.LittleEndian.Uint32(header)
+		if length > MAX_RECORD {
+			util.Log.Printf("wal %s has a corrupted record at offset %d", w.path, offset)
+			break
+		}
+		payload := make([]byte, length)
+		if _, err := io.ReadFull(reader, payload); err != nil {
+			util.Log.Printf("wal %s has a torn record at offset %d", w.path, offset)
+			break
+		}
+		record, ok := decode(payload)
+		if !ok || crc32.Checksum(payload, crc32Table) != binary.LittleEndian.Uint32(header[4:]) {
+			util.Log.Printf("wal %s has a corrupted record at offset %d", w.path, offset)
+			break
+		}
+		if err := fn(record); err != nil {
+			return n, err
+		}
+		n++
+		offset += HEADER_SIZE + int64(length)
+		if record.Seq > w.seq {
+			w.seq = record.Seq
+		}
+	}
+	if offset < w.size {
+		if err := w.file.Truncate(offset); err != nil {
+			return n, err
+		}
+		w.size = offset
+	}
+	return n, nil
+}
+
+// Discard all the records. Call it after the mutations in the log have been persisted elsewhere (a checkpoint).
+func (w *WAL) Truncate() error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if err := w.writer.Flush(); err != nil {
+		return err
+	}
+	if err := w.file.Truncate(0); err != nil {
+		return err
+	}
+	w.size = 0
+	return w.file.Sync()
+}
+
+// Wait for the pending appends and close the log file
+func (w *WAL) Close() error {
+	w.closeLock.Lock()
+	if w.closed {
+		w.closeLock.Unlock()
+		return nil
+	}
+	w.closed = true
+	close(w.queue)
+	w.closeLock.Unlock()
+	<-w.done
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if err := w.writer.Flush(); err != nil {
+		w.file.Close()
+		return err
+	}
+	return w.file.Close()
+}
@@ -7,3 +7,14 @@ func (kw Keyword) ToString() string {
 		return ""
 	}
 }
+
+// Return field:word with special characters escaped, the field is omitted if empty
+func (kw Keyword) toQueryString() string {
+	if len(kw.Word) == 0 {
+		return ""
+	}
+	if len(kw.Field) == 0 {
+		return escapeQueryTerm(kw.Word)
+	}
+	return escapeQueryTerm(kw.Field) + ":" + escapeQueryTerm(kw.Word)
+}
@@ -0,0 +1,323 @@
+package types
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Characters with special meaning in a query string
+const querySpecialChars = `()&|^~:"\`
+
+// Error of parsing a query string
+type QueryParseError struct {
+	Pos int // Byte offset in the query string where the error occurs
+	Msg string
+}
+
+func (e *QueryParseError) Error() string {
+	return fmt.Sprintf("parse query failed at position %d: %s", e.Pos, e.Msg)
+}
+
+// Parse a query string into TermQuery, the inverse of TermQuery.ToString. Syntax:
+//
+//	field:word   keyword. The field can be omitted, the word can be quoted like title:"hello world"
+//	a & b, a b   both a and b must match
+//	a | b        at least one of a and b must match
+//	-a           a must not match
+//	(a|b|c)~2    at least 2 of the clauses must match
+//	a^2          multiply the score of a by 2
+//
+// Special characters ()&|^~:"\ and spaces in field or word should be escaped with '\', so should '-' at the beginning.
+// Precedence from high to low: ^ ~, -, &, |
+func ParseTermQuery(query string) (*TermQuery, error) {
+	p := &queryParser{input: query}
+	p.skipSpace()
+	if p.eof() {
+		return &TermQuery{}, nil
+	}
+	q, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	p.skipSpace()
+	if !p.eof() {
+		return nil, p.errorf("unexpected '%c'", p.peek())
+	}
+	return q, nil
+}
+
+type queryParser struct {
+	input string
+	pos   int
+}
+
+func (p *queryParser) eof() bool {
+	return p.pos >= len(p.input)
+}
+
+func (p *queryParser) peek() rune {
+	r, _ := utf8.DecodeRuneInString(p.input[p.pos:])
+	return r
+}
+
+func (p *queryParser) next() rune {
+	r, size := utf8.DecodeRuneInString(p.input[p.pos:])
+	p.pos += size
+	return r
+}
+
+func (p *queryParser) skipSpace() {
+	for !p.eof() && unicode.IsSpace(p.peek()) {
+		p.next()
+	}
+}
+
+func (p *queryParser) errorf(format string, args ...any) error {
+	return &QueryParseError{Pos: p.pos, Msg: fmt.Sprintf(format, args...)}
+}
+
+// or := and ('|' and)*
+func (p *queryParser) parseOr() (*TermQuery, error) {
+	first, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	clauses := []*TermQuery{first}
+	for {
+		p.skipSpace()
+		if p.eof() || p.peek() != '|' {
+			break
+		}
+		p.next()
+		q, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		clauses = append(clauses, q)
+	}
+	if len(clauses) == 1 {
+		return first, nil
+	}
+	return &TermQuery{Should: clauses}, nil
+}
+
+// and := unary ('&'? unary)*
+func (p *queryParser) parseAnd() (*TermQuery, error) {
+	must := make([]*TermQuery, 0, 2)
+	mustNot := make([]*TermQuery, 0, 2)
+	for {
+		p.skipSpace()
+		if len(must)+len(mustNot) > 0 {
+			if p.eof() || p.peek() == '|' || p.peek() == ')' {
+				break
+			}
+			if p.peek() == '&' {
+				p.next()
+			}
+		}
+		q, negated, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		if negated {
+			mustNot = append(mustNot, q)
+		} else {
+			must = append(must, q)
+		}
+	}
+	if len(must) == 1 && len(mustNot) == 0 {
+		return must[0], nil
+	}
+	result := &TermQuery{}
+	if len(must) > 0 {
+		result.Must = must
+	}
+	if len(mustNot) > 0 {
+		result.MustNot = mustNot
+	}
+	return result, nil
+}
+
+// unary := '-' unary | postfix
+//
+// A pure negation alone has nothing to exclude from, so negating it gives its clauses back: --a is a, -(-a) is a,
+// and -(-a -b) is a|b.
+func (p *queryParser) parseUnary() (q *TermQuery, negated bool, err error) {
+	p.skipSpace()
+	if !p.eof() && p.peek() == '-' {
+		p.next()
+		q, negated, err = p.parseUnary()
+		if err != nil {
+			return nil, false, err
+		}
+		if negated { // --a
+			return q, false, nil
+		}
+		if isPureNegation(q) { // -(-a)
+			if len(q.MustNot) == 1 && q.Boost == 0 {
+				return q.MustNot[0], false, nil
+			}
+			return &TermQuery{Should: q.MustNot, Boost: q.Boost}, false, nil
+		}
+		return q, true, nil
+	}
+	q, err = p.parsePostfix()
+	return q, false, err
+}
+
+// Whether q only has MustNot clauses
+func isPureNegation(q *TermQuery) bool {
+	return q.Keyword == nil && len(q.Must) == 0 && len(q.Should) == 0 && len(q.MustNot) > 0
+}
+
+// postfix := primary ('^' float | '~' int)*
+func (p *queryParser) parsePostfix() (*TermQuery, error) {
+	q, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	for !p.eof() {
+		op := p.peek()
+		if op != '^' && op != '~' {
+			break
+		}
+		p.next()
+		start := p.pos
+		for !p.eof() && (p.peek() >= '0' && p.peek() <= '9' || p.peek() == '.') {
+			p.next()
+		}
+		number := p.input[start:p.pos]
+		if len(number) == 0 {
+			return nil, p.errorf("expect a number after '%c'", op)
+		}
+		if op == '^' {
+			boost, err := strconv.ParseFloat(number, 32)
+			if err != nil || boost <= 0 {
+				return nil, &QueryParseError{Pos: start, Msg: fmt.Sprintf("invalid boost '%s'", number)}
+			}
+			if q.Boost > 0 { // a^2^3, keep both weights
+				q = &TermQuery{Must: []*TermQuery{q}}
+			}
+			q.Boost = float32(boost)
+		} else {
+			n, err := strconv.Atoi(number)
+			if err != nil || n <= 0 {
+				return nil, &QueryParseError{Pos: start, Msg: fmt.Sprintf("invalid minimum should match '%s'", number)}
+			}
+			q.MinimumShouldMatch = int32(n)
+		}
+	}
+	return q, nil
+}
+
+// primary := '(' or ')' | term
+func (p *queryParser) parsePrimary() (*TermQuery, error) {
+	p.skipSpace()
+	if p.eof() {
+		return nil, p.errorf("unexpected end of query, expect a term")
+	}
+	if p.peek() == '(' {
+		open := p.pos
+		p.next()
+		p.skipSpace()
+		if !p.eof() && p.peek() == ')' {
+			return nil, p.errorf("empty parentheses")
+		}
+		q, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		p.skipSpace()
+		if p.eof() {
+			return nil, &QueryParseError{Pos: open, Msg: "unclosed '('"}
+		}
+		if p.peek() != ')' {
+			return nil, p.errorf("unexpected '%c', expect ')'", p.peek())
+		}
+		p.next()
+		return q, nil
+	}
+	return p.parseTerm()
+}
+
+// term := unit (':' unit)?
+func (p *queryParser) parseTerm() (*TermQuery, error) {
+	field, err := p.parseUnit()
+	if err != nil {
+		return nil, err
+	}
+	if !p.eof() && p.peek() == ':' {
+		p.next()
+		word, err := p.parseUnit()
+		if err != nil {
+			return nil, err
+		}
+		return NewTermQuery(field, word), nil
+	}
+	return NewTermQuery("", field), nil
+}
+
+// A quoted string or a run of characters with special characters escaped
+func (p *queryParser) parseUnit() (string, error) {
+	if p.eof() {
+		return "", p.errorf("unexpected end of query, expect a word")
+	}
+	start := p.pos
+	sb := strings.Builder{}
+	if p.peek() == '"' {
+		p.next()
+		for {
+			if p.eof() {
+				return "", &QueryParseError{Pos: start, Msg: "unterminated quoted string"}
+			}
+			r := p.next()
+			if r == '"' {
+				break
+			}
+			if r == '\\' {
+				if p.eof() {
+					return "", p.errorf("nothing to escape")
+				}
+				r = p.next()
+			}
+			sb.WriteRune(r)
+		}
+		if sb.Len() == 0 {
+			return "", &QueryParseError{Pos: start, Msg: "empty quoted string"}
+		}
+		return sb.String(), nil
+	}
+	for !p.eof() {
+		r := p.peek()
+		if unicode.IsSpace(r) || strings.ContainsRune(querySpecialChars, r) && r != '\\' {
+			break
+		}
+		p.next()
+		if r == '\\' {
+			if p.eof() {
+				return "", p.errorf("nothing to escape")
+			}
+			r = p.next()
+		}
+		sb.WriteRune(r)
+	}
+	if sb.Len() == 0 {
+		return "", p.errorf("unexpected '%c', expect a word", p.peek())
+	}
+	return sb.String(), nil
+}
+
+// Escape the special characters of a field or word
+func escapeQueryTerm(s string) string {
+	sb := strings.Builder{}
+	for i, r := range s {
+		if unicode.IsSpace(r) || strings.ContainsRune(querySpecialChars, r) || i == 0 && r == '-' {
+			sb.WriteByte('\\')
+		}
+		sb.WriteRune(r)
+	}
+	return sb.String()
+}
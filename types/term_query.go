@@ -1,6 +1,7 @@
 package types
 
 import (
+	"strconv"
 	"strings"
 )
 
@@ -9,7 +10,7 @@ func NewTermQuery(field, keyword string) *TermQuery {
 }
 
 func (q TermQuery) Empty() bool {
-	return q.Keyword == nil && len(q.Must) == 0 && len(q.Should) == 0
+	return q.Keyword == nil && len(q.Must) == 0 && len(q.Should) == 0 && len(q.MustNot) == 0
 }
 
 // Return a new TermQuery with the given querys as must
@@ -46,44 +47,98 @@ func (q *TermQuery) Or(querys ...*TermQuery) *TermQuery {
 	return &TermQuery{Should: array} //Only Should is not empty
 }
 
+// Return a new TermQuery matching q but none of the given querys
+func (q *TermQuery) Not(querys ...*TermQuery) *TermQuery {
+	if len(querys) == 0 {
+		return q
+	}
+	array := make([]*TermQuery, 0, len(querys))
+	for _, ele := range querys {
+		if !ele.Empty() {
+			array = append(array, ele)
+		}
+	}
+	if len(array) == 0 {
+		return q
+	}
+	if q.Empty() {
+		return &TermQuery{MustNot: array} //Match nothing unless it is And-ed with other querys
+	}
+	return &TermQuery{Must: []*TermQuery{q}, MustNot: array}
+}
+
+// Set the weight of the score of this query, return the query itself
+func (q *TermQuery) WithBoost(boost float32) *TermQuery {
+	q.Boost = boost
+	return q
+}
+
+// Require at least n of the Should querys to match, return the query itself
+func (q *TermQuery) WithMinimumShouldMatch(n int) *TermQuery {
+	q.MinimumShouldMatch = int32(n)
+	return q
+}
+
+// Return the query in the syntax of ParseTermQuery, e.g. ((title:go|title:rust)&author:pike&-lang:java)
 func (q TermQuery) ToString() string {
+	s := q.clauseString()
+	if len(s) == 0 {
+		return s
+	}
+	if q.Boost > 0 && q.Boost != 1 {
+		if s[0] == '-' { //-a^2 means -(a^2)
+			s = "(" + s + ")"
+		}
+		s += "^" + strconv.FormatFloat(float64(q.Boost), 'f', -1, 32)
+	}
+	return s
+}
+
+// String of the clauses, with MinimumShouldMatch attached to the Should group, without Boost.
+//
+// Only one of Keyword, Must and Should takes effect in search, in that order.
+func (q TermQuery) clauseString() string {
+	parts := make([]string, 0, len(q.Must)+len(q.MustNot)+1)
 	if q.Keyword != nil {
-		return q.Keyword.ToString()
+		parts = append(parts, q.Keyword.toQueryString())
 	} else if len(q.Must) > 0 {
-		if len(q.Must) == 1 {
-			return q.Must[0].ToString()
-		} else {
-			sb := strings.Builder{}
-			sb.WriteByte('(')
-			for _, e := range q.Must {
-				s := e.ToString()
-				if len(s) > 0 {
-					sb.WriteString(s)
-					sb.WriteByte('&')
-				}
-			}
-			s := sb.String()
-			s = s[0:len(s)-1] + ")"
-			return s
+		for _, e := range q.Must {
+			parts = append(parts, e.ToString())
 		}
 	} else if len(q.Should) > 0 {
-		if len(q.Should) == 1 {
-			return q.Should[0].ToString()
-		} else {
-			sb := strings.Builder{}
-			sb.WriteByte('(')
-			for _, e := range q.Should {
-				s := e.ToString()
-				if len(s) > 0 {
-					sb.WriteString(s)
-					sb.WriteByte('|')
-				}
+		should := make([]string, 0, len(q.Should))
+		for _, e := range q.Should {
+			if s := e.ToString(); len(s) > 0 {
+				should = append(should, s)
 			}
-			s := sb.String()
-			s = s[0:len(s)-1] + ")"
-			return s
 		}
+		group := joinClauses(should, "|")
+		if q.MinimumShouldMatch > 1 && len(should) > 1 { //(a|b|c)~2&-d, ~ binds to the Should group only
+			group += "~" + strconv.Itoa(int(q.MinimumShouldMatch))
+		}
+		parts = append(parts, group)
+	}
+	for _, e := range q.MustNot {
+		if s := e.ToString(); len(s) > 0 {
+			parts = append(parts, "-"+s)
+		}
+	}
+	return joinClauses(parts, "&")
+}
 
+// Join non-empty clauses with the operator, wrapped in parentheses if there are more than one
+func joinClauses(clauses []string, op string) string {
+	array := make([]string, 0, len(clauses))
+	for _, s := range clauses {
+		if len(s) > 0 {
+			array = append(array, s)
+		}
+	}
+	if len(array) == 1 {
+		return array[0]
+	}
+	if len(array) == 0 {
+		return ""
 	}
-	return ""
+	return "(" + strings.Join(array, op) + ")"
 }
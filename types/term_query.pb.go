@@ -4,6 +4,7 @@
 package types
 
 import (
+	encoding_binary "encoding/binary"
 	fmt "fmt"
 	proto "github.com/gogo/protobuf/proto"
 	io "io"
@@ -23,9 +24,12 @@ var _ = math.Inf
 const _ = proto.GoGoProtoPackageIsVersion3 // please upgrade the proto package
 
 type TermQuery struct {
-	Keyword *Keyword     `protobuf:"bytes,1,opt,name=Keyword,proto3" json:"Keyword,omitempty"`
-	Must    []*TermQuery `protobuf:"bytes,2,rep,name=Must,proto3" json:"Must,omitempty"`
-	Should  []*TermQuery `protobuf:"bytes,3,rep,name=Should,proto3" json:"Should,omitempty"`
+	Keyword            *Keyword     `protobuf:"bytes,1,opt,name=Keyword,proto3" json:"Keyword,omitempty"`
+	Must               []*TermQuery `protobuf:"bytes,2,rep,name=Must,proto3" json:"Must,omitempty"`
+	Should             []*TermQuery `protobuf:"bytes,3,rep,name=Should,proto3" json:"Should,omitempty"`
+	MustNot            []*TermQuery `protobuf:"bytes,4,rep,name=MustNot,proto3" json:"MustNot,omitempty"`
+	MinimumShouldMatch int32        `protobuf:"varint,5,opt,name=MinimumShouldMatch,proto3" json:"MinimumShouldMatch,omitempty"`
+	Boost              float32      `protobuf:"fixed32,6,opt,name=Boost,proto3" json:"Boost,omitempty"`
 }
 
 func (m *TermQuery) Reset()         { *m = TermQuery{} }
@@ -82,6 +86,27 @@ func (m *TermQuery) GetShould() []*TermQuery {
 	return nil
 }
 
+func (m *TermQuery) GetMustNot() []*TermQuery {
+	if m != nil {
+		return m.MustNot
+	}
+	return nil
+}
+
+func (m *TermQuery) GetMinimumShouldMatch() int32 {
+	if m != nil {
+		return m.MinimumShouldMatch
+	}
+	return 0
+}
+
+func (m *TermQuery) GetBoost() float32 {
+	if m != nil {
+		return m.Boost
+	}
+	return 0
+}
+
 func init() {
 	proto.RegisterType((*TermQuery)(nil), "types.TermQuery")
 }
@@ -89,18 +114,22 @@ func init() {
 func init() { proto.RegisterFile("term_query.proto", fileDescriptor_cbb9280914c3e3fe) }
 
 var fileDescriptor_cbb9280914c3e3fe = []byte{
-	// 168 bytes of a gzipped FileDescriptorProto
+	// 225 bytes of a gzipped FileDescriptorProto
 	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xe2, 0x12, 0x28, 0x49, 0x2d, 0xca,
 	0x8d, 0x2f, 0x2c, 0x4d, 0x2d, 0xaa, 0xd4, 0x2b, 0x28, 0xca, 0x2f, 0xc9, 0x17, 0x62, 0x2d, 0xa9,
-	0x2c, 0x48, 0x2d, 0x96, 0xe2, 0x4c, 0xc9, 0x4f, 0x86, 0x88, 0x28, 0xb5, 0x32, 0x72, 0x71, 0x86,
-	0xa4, 0x16, 0xe5, 0x06, 0x82, 0x54, 0x09, 0x69, 0x70, 0xb1, 0x7b, 0xa7, 0x56, 0x96, 0xe7, 0x17,
-	0xa5, 0x48, 0x30, 0x2a, 0x30, 0x6a, 0x70, 0x1b, 0xf1, 0xe9, 0x81, 0x75, 0xe8, 0x41, 0x45, 0x83,
-	0x60, 0xd2, 0x42, 0x2a, 0x5c, 0x2c, 0xbe, 0xa5, 0xc5, 0x25, 0x12, 0x4c, 0x0a, 0xcc, 0x1a, 0xdc,
-	0x46, 0x02, 0x50, 0x65, 0x70, 0x93, 0x82, 0xc0, 0xb2, 0x42, 0x1a, 0x5c, 0x6c, 0xc1, 0x19, 0xf9,
-	0xa5, 0x39, 0x29, 0x12, 0xcc, 0x38, 0xd4, 0x41, 0xe5, 0x9d, 0x24, 0x4e, 0x3c, 0x92, 0x63, 0xbc,
-	0xf0, 0x48, 0x8e, 0xf1, 0xc1, 0x23, 0x39, 0xc6, 0x09, 0x8f, 0xe5, 0x18, 0x2e, 0x3c, 0x96, 0x63,
-	0xb8, 0xf1, 0x58, 0x8e, 0x21, 0x89, 0x0d, 0xec, 0x50, 0x63, 0x40, 0x00, 0x00, 0x00, 0xff, 0xff,
-	0xfa, 0x3b, 0x80, 0x94, 0xce, 0x00, 0x00, 0x00,
+	0x2c, 0x48, 0x2d, 0x96, 0xe2, 0x4c, 0xc9, 0x4f, 0x86, 0x88, 0x28, 0x7d, 0x67, 0xe4, 0xe2, 0x0c,
+	0x49, 0x2d, 0xca, 0x0d, 0x04, 0xa9, 0x12, 0xd2, 0xe0, 0x62, 0xf7, 0x4e, 0xad, 0x2c, 0xcf, 0x2f,
+	0x4a, 0x91, 0x60, 0x54, 0x60, 0xd4, 0xe0, 0x36, 0xe2, 0xd3, 0x03, 0xeb, 0xd0, 0x83, 0x8a, 0x06,
+	0xc1, 0xa4, 0x85, 0x54, 0xb8, 0x58, 0x7c, 0x4b, 0x8b, 0x4b, 0x24, 0x98, 0x14, 0x98, 0x35, 0xb8,
+	0x8d, 0x04, 0xa0, 0xca, 0xe0, 0x26, 0x05, 0x81, 0x65, 0x85, 0x34, 0xb8, 0xd8, 0x82, 0x33, 0xf2,
+	0x4b, 0x73, 0x52, 0x24, 0x98, 0x71, 0xa8, 0x83, 0xca, 0x0b, 0x69, 0x71, 0xb1, 0x83, 0x74, 0xf8,
+	0xe5, 0x97, 0x48, 0xb0, 0xe0, 0x50, 0x0a, 0x53, 0x20, 0xa4, 0xc7, 0x25, 0xe4, 0x9b, 0x99, 0x97,
+	0x99, 0x5b, 0x9a, 0x0b, 0xd1, 0xec, 0x9b, 0x58, 0x92, 0x9c, 0x21, 0xc1, 0xaa, 0xc0, 0xa8, 0xc1,
+	0x1a, 0x84, 0x45, 0x46, 0x48, 0x84, 0x8b, 0xd5, 0x29, 0x3f, 0xbf, 0xb8, 0x44, 0x82, 0x4d, 0x81,
+	0x51, 0x83, 0x29, 0x08, 0xc2, 0x71, 0x92, 0x38, 0xf1, 0x48, 0x8e, 0xf1, 0xc2, 0x23, 0x39, 0xc6,
+	0x07, 0x8f, 0xe4, 0x18, 0x27, 0x3c, 0x96, 0x63, 0xb8, 0xf0, 0x58, 0x8e, 0xe1, 0xc6, 0x63, 0x39,
+	0x86, 0x24, 0x36, 0x70, 0xd0, 0x18, 0x03, 0x06, 0x00, 0xb6, 0xa1, 0x64, 0x91, 0x40, 0x01, 0x00,
+	0x00,
 }
 
 func (m *TermQuery) Marshal() (dAtA []byte, err error) {
@@ -123,6 +152,31 @@ func (m *TermQuery) MarshalToSizedBuffer(dAtA []byte) (int, error) {
 	_ = i
 	var l int
 	_ = l
+	if m.Boost != 0 {
+		i -= 4
+		encoding_binary.LittleEndian.PutUint32(dAtA[i:], uint32(math.Float32bits(float32(m.Boost))))
+		i--
+		dAtA[i] = 0x35
+	}
+	if m.MinimumShouldMatch != 0 {
+		i = encodeVarintTermQuery(dAtA, i, uint64(m.MinimumShouldMatch))
+		i--
+		dAtA[i] = 0x28
+	}
+	if len(m.MustNot) > 0 {
+		for iNdEx := len(m.MustNot) - 1; iNdEx >= 0; iNdEx-- {
+			{
+				size, err := m.MustNot[iNdEx].MarshalToSizedBuffer(dAtA[:i])
+				if err != nil {
+					return 0, err
+				}
+				i -= size
+				i = encodeVarintTermQuery(dAtA, i, uint64(size))
+			}
+			i--
+			dAtA[i] = 0x22
+		}
+	}
 	if len(m.Should) > 0 {
 		for iNdEx := len(m.Should) - 1; iNdEx >= 0; iNdEx-- {
 			{
@@ -199,6 +253,18 @@ func (m *TermQuery) Size() (n int) {
 			n += 1 + l + sovTermQuery(uint64(l))
 		}
 	}
+	if len(m.MustNot) > 0 {
+		for _, e := range m.MustNot {
+			l = e.Size()
+			n += 1 + l + sovTermQuery(uint64(l))
+		}
+	}
+	if m.MinimumShouldMatch != 0 {
+		n += 1 + sovTermQuery(uint64(m.MinimumShouldMatch))
+	}
+	if m.Boost != 0 {
+		n += 5
+	}
 	return n
 }
 
@@ -341,6 +407,70 @@ func (m *TermQuery) Unmarshal(dAtA []byte) error {
 				return err
 			}
 			iNdEx = postIndex
+		case 4:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field MustNot", wireType)
+			}
+			var msglen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowTermQuery
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				msglen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if msglen < 0 {
+				return ErrInvalidLengthTermQuery
+			}
+			postIndex := iNdEx + msglen
+			if postIndex < 0 {
+				return ErrInvalidLengthTermQuery
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.MustNot = append(m.MustNot, &TermQuery{})
+			if err := m.MustNot[len(m.MustNot)-1].Unmarshal(dAtA[iNdEx:postIndex]); err != nil {
+				return err
+			}
+			iNdEx = postIndex
+		case 5:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field MinimumShouldMatch", wireType)
+			}
+			m.MinimumShouldMatch = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowTermQuery
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.MinimumShouldMatch |= int32(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 6:
+			if wireType != 5 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Boost", wireType)
+			}
+			var v uint32
+			if (iNdEx + 4) > l {
+				return io.ErrUnexpectedEOF
+			}
+			v = uint32(encoding_binary.LittleEndian.Uint32(dAtA[iNdEx:]))
+			iNdEx += 4
+			m.Boost = float32(math.Float32frombits(v))
 		default:
 			iNdEx = preIndex
 			skippy, err := skipTermQuery(dAtA[iNdEx:])
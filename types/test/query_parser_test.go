@@ -0,0 +1,116 @@
+package test
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/kisaragi77/TinyES/types"
+)
+
+func TestParseTermQuery(t *testing.T) {
+	q, err := types.ParseTermQuery("(title:go | title:rust) & author:pike -lang:java")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fmt.Println(q.ToString())
+	if len(q.Must) != 2 || len(q.MustNot) != 1 || len(q.Must[0].Should) != 2 {
+		t.Fatalf("unexpected query structure %s", q.String())
+	}
+	if kw := q.MustNot[0].Keyword; kw.Field != "lang" || kw.Word != "java" {
+		t.Errorf("unexpected negative keyword %v", kw)
+	}
+
+	q, err = types.ParseTermQuery(`title:"hello world" | content:a\:b^2.5 | (tag:x | tag:y | tag:z)~2`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fmt.Println(q.ToString())
+	if q.Should[0].Keyword.Word != "hello world" || q.Should[1].Keyword.Word != "a:b" || q.Should[1].Boost != 2.5 || q.Should[2].MinimumShouldMatch != 2 {
+		t.Errorf("unexpected query %s", q.String())
+	}
+}
+
+func TestParseDoubleNegation(t *testing.T) {
+	cases := []struct {
+		query  string
+		expect string
+	}{
+		{"--a", "a"},
+		{"---a", "-a"},
+		{"b -(-a)", "b & a"},
+		{"-(-a -b)", "a | b"},
+		{"b --a", "b & a"},
+	}
+	for _, c := range cases {
+		q, err := types.ParseTermQuery(c.query)
+		if err != nil {
+			t.Errorf("parse %s failed: %s", c.query, err)
+			continue
+		}
+		fmt.Printf("%-10s %s\n", c.query, q.ToString())
+		expect, _ := types.ParseTermQuery(c.expect)
+		if q.ToString() != expect.ToString() {
+			t.Errorf("%s should be %s, got %s", c.query, expect.ToString(), q.ToString())
+		}
+	}
+}
+
+func TestTermQueryRoundTrip(t *testing.T) {
+	querys := []*types.TermQuery{
+		types.NewTermQuery("category", "phone").Not(types.NewTermQuery("brand", "acme")),
+		types.NewTermQuery("title", "go").Or(types.NewTermQuery("title", "rust")).And(types.NewTermQuery("author", "pike")).Not(types.NewTermQuery("lang", "java")),
+		types.NewTermQuery("tag", "a").Or(types.NewTermQuery("tag", "b"), types.NewTermQuery("tag", "c").WithBoost(3)).WithMinimumShouldMatch(2).WithBoost(0.5),
+		types.NewTermQuery("", "-dash (and) spaces").And(types.NewTermQuery("we:ird", `quo"te\`)),
+		new(types.TermQuery).Not(types.NewTermQuery("brand", "acme")).WithBoost(2),
+		types.NewTermQuery("title", "中文").WithBoost(2).WithBoost(1.5),
+		(&types.TermQuery{Should: []*types.TermQuery{types.NewTermQuery("tag", "a"), types.NewTermQuery("tag", "b"), types.NewTermQuery("tag", "c")}, MustNot: []*types.TermQuery{types.NewTermQuery("tag", "d")}}).WithMinimumShouldMatch(2),
+	}
+	for _, q := range querys {
+		s := q.ToString()
+		parsed, err := types.ParseTermQuery(s)
+		if err != nil {
+			t.Errorf("parse %s failed: %s", s, err)
+			continue
+		}
+		fmt.Println(s)
+		if parsed.ToString() != s {
+			t.Errorf("round trip failed: %s -> %s", s, parsed.ToString())
+		}
+		if len(q.MustNot) > 0 && q.MinimumShouldMatch > 1 && len(parsed.Must) > 0 && parsed.Must[0].MinimumShouldMatch != q.MinimumShouldMatch {
+			t.Errorf("minimum should match of %s lost, got %d", s, parsed.Must[0].MinimumShouldMatch)
+		}
+	}
+}
+
+func TestParseTermQueryError(t *testing.T) {
+	cases := []struct {
+		query string
+		pos   int
+	}{
+		{"(a | b", 0},
+		{"a | ", 4},
+		{"a & )", 4},
+		{"title:", 6},
+		{`title:"abc`, 6},
+		{"a^x", 2},
+		{"(a|b)~0", 6},
+		{"()", 1},
+		{"a b)", 3},
+	}
+	for _, c := range cases {
+		_, err := types.ParseTermQuery(c.query)
+		fmt.Printf("%-12s %v\n", c.query, err)
+		var parseErr *types.QueryParseError
+		if !errors.As(err, &parseErr) {
+			t.Errorf("%s should fail", c.query)
+		} else if parseErr.Pos != c.pos {
+			t.Errorf("%s should fail at %d, got %d", c.query, c.pos, parseErr.Pos)
+		}
+	}
+}
+
+// go test -v ./types/test -run=^TestParseTermQuery$ -count=1
+// go test -v ./types/test -run=^TestParseDoubleNegation$ -count=1
+// go test -v ./types/test -run=^TestTermQueryRoundTrip$ -count=1
+// go test -v ./types/test -run=^TestParseTermQueryError$ -count=1
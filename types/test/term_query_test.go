@@ -32,6 +32,14 @@ func TestTermQuery(t *testing.T) {
 	// ((A|B|C)&D)|E&((F|G)&H)
 	q = A.Or(B).Or(C).And(D).Or(E).And(F.Or(G)).And(H)
 	fmt.Println(q.ToString())
+
+	// (B|C)&-D&-F
+	q = B.Or(C).Not(D, F)
+	fmt.Println(q.ToString())
+
+	// (B|C|D^2)~2
+	q = B.Or(C, D.WithBoost(2)).WithMinimumShouldMatch(2)
+	fmt.Println(q.ToString())
 }
 
 // go test -v ./types/test -run=^TestTermQuery$ -count=1
@@ -0,0 +1,41 @@
+package test
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"testing"
+
+	"github.com/kisaragi77/TinyES/util"
+)
+
+func TestTopK(t *testing.T) {
+	const K = 10
+	arr := rand.Perm(1000)
+	topK := util.NewTopK(K, func(a, b int) bool { return a > b })
+	for _, e := range arr {
+		topK.Push(e)
+	}
+	result := topK.Sorted()
+	fmt.Println(result)
+
+	sort.Sort(sort.Reverse(sort.IntSlice(arr)))
+	if len(result) != K {
+		t.Fatalf("expect %d elements, got %d", K, len(result))
+	}
+	for i := range result {
+		if result[i] != arr[i] {
+			t.Errorf("%d-th element should be %d, got %d", i, arr[i], result[i])
+		}
+	}
+
+	all := util.NewTopK(0, func(a, b int) bool { return a > b }) //k<=0不限制个数
+	for _, e := range arr {
+		all.Push(e)
+	}
+	if all.Len() != len(arr) {
+		t.Errorf("expect %d elements, got %d", len(arr), all.Len())
+	}
+}
+
+// go test -v ./util/test -run=^TestTopK$ -count=1
@@ -0,0 +1,66 @@
+package util
+
+import (
+	"container/heap"
+	"sort"
+)
+
+// Keep the best k elements of a stream with a bounded heap
+type TopK[T any] struct {
+	k    int
+	less func(a, b T) bool // Return true if a ranks before b
+	h    *topKHeap[T]
+}
+
+// k : max number of elements to keep, unlimited if k <= 0
+//
+// less : return true if a ranks before b
+func NewTopK[T any](k int, less func(a, b T) bool) *TopK[T] {
+	return &TopK[T]{
+		k:    k,
+		less: less,
+		h:    &topKHeap[T]{less: less},
+	}
+}
+
+// Offer an element, drop it if it ranks after all the k elements kept
+func (t *TopK[T]) Push(e T) {
+	if t.k <= 0 || t.h.Len() < t.k {
+		heap.Push(t.h, e)
+	} else if t.less(e, t.h.data[0]) {
+		t.h.data[0] = e
+		heap.Fix(t.h, 0)
+	}
+}
+
+// Number of elements kept
+func (t *TopK[T]) Len() int {
+	return t.h.Len()
+}
+
+// Return the kept elements in rank order
+func (t *TopK[T]) Sorted() []T {
+	result := make([]T, t.h.Len())
+	copy(result, t.h.data)
+	sort.Slice(result, func(i, j int) bool {
+		return t.less(result[i], result[j])
+	})
+	return result
+}
+
+// Heap with the worst element on top
+type topKHeap[T any] struct {
+	data []T
+	less func(a, b T) bool
+}
+
+func (h topKHeap[T]) Len() int           { return len(h.data) }
+func (h topKHeap[T]) Less(i, j int) bool { return h.less(h.data[j], h.data[i]) }
+func (h topKHeap[T]) Swap(i, j int)      { h.data[i], h.data[j] = h.data[j], h.data[i] }
+func (h *topKHeap[T]) Push(x any)        { h.data = append(h.data, x.(T)) }
+func (h *topKHeap[T]) Pop() any {
+	n := len(h.data)
+	x := h.data[n-1]
+	h.data = h.data[:n-1]
+	return x
+}